@@ -1,8 +1,14 @@
 package variable
 
+import "github.com/go-ini/ini"
+
+// 全局配置，由 bootstrap 在启动时写入
+var Config *ini.File
+
 type UserSessionData struct {
-	Id       int
-	Username string
-	Nickname string
-	Email    string
+	Id             int
+	Username       string
+	Nickname       string
+	Email          string
+	SessionVersion int // 登录时用户的登录态版本号，与数据库不一致时Session失效
 }
\ No newline at end of file
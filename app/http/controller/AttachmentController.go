@@ -0,0 +1,436 @@
+package controller
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/go-ini/ini"
+	"go-chats/app/global/variable"
+	"go-chats/app/media"
+	"go-chats/app/model"
+	"go-chats/app/utils/audio"
+	"go-chats/app/utils/filer"
+	"go-chats/app/utils/imaging"
+	"go-chats/app/utils/storage"
+	"image"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 未配置 ATTACHMENT_ALLOWED_TYPES 时允许上传的文件类型
+const defaultAttachmentTypes = "image/*,audio/*,video/*,text/plain,application/pdf,application/zip,application/x-gzip,application/x-rar-compressed"
+
+// 附件上传与下载
+type AttachmentController struct {
+	BaseController
+}
+
+/**
+ * 上传附件，表单字段为 file，返回的附件ID在发送图片、文件消息时通过 attachment_ids 关联
+ * 文件类型按内容识别，不信任客户端提交的 Content-Type
+ * 要发到群里时可以传 group_id，上传时就检查群的存储配额，不用等到发送时才失败
+ * 录制的语音传 voice=1，上传时就检查格式、时长和大小，返回的附件带有时长（毫秒）和音量包络
+ */
+func (a *AttachmentController) Upload(c *gin.Context) {
+	user := a.AuthUser(c)
+	maxSize := attachmentMaxSize()
+	tooLarge := "文件大小不能超过 " + filer.FormatBytes(maxSize)
+
+	// 多留 1MB 给表单的其余部分
+	limit := maxSize + 1<<20
+	if c.Request.ContentLength > limit {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": tooLarge})
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "请选择要上传的文件"})
+		return
+	}
+	if header.Size > maxSize {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": tooLarge})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "读取上传文件失败"})
+		return
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "读取上传文件失败"})
+		return
+	}
+	head = head[:n]
+	mime := contentType(head)
+	if n == 0 || !allowedMime(mime) {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "不支持的文件类型"})
+		return
+	}
+
+	tmp, err := storage.TempFile()
+	if err != nil {
+		log.Printf("创建上传临时文件失败: %v", err)
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "上传失败，请稍后再试"})
+		return
+	}
+	size, err := io.Copy(tmp, io.MultiReader(bytes.NewReader(head), file))
+	tmp.Close()
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "上传失败，请稍后再试"})
+		return
+	}
+
+	saveAttachment(c, user.Id, header.Filename, tmp.Name(), "", size, mime)
+}
+
+// 下载附件，只有上传人和附件所在会话的成员可以下载；图片、语音直接显示或播放，其他文件作为附件下载
+func (a *AttachmentController) Show(c *gin.Context) {
+	attachment, ok := a.load(c)
+	if !ok {
+		return
+	}
+	disposition := "attachment"
+	if attachment.IsImage() || attachment.IsVoice() {
+		disposition = "inline"
+	}
+	serveObject(c, storage.Attachments, attachment.Path, attachment.Mime, disposition+"; filename*=UTF-8''"+url.PathEscape(attachment.Name), "private, max-age=86400")
+}
+
+/**
+ * 图片缩略图，size 为期望的长边像素，返回不小于该尺寸的最小缩略图
+ * 没有合适的缩略图（原图较小或还在生成）时返回原图
+ */
+func (a *AttachmentController) Thumbnail(c *gin.Context) {
+	attachment, ok := a.load(c)
+	if !ok {
+		return
+	}
+	if !attachment.IsImage() {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该附件不是图片"})
+		return
+	}
+
+	want, _ := strconv.Atoi(c.DefaultQuery("size", "0"))
+	best := 0
+	for _, s := range strings.Split(attachment.ThumbnailSizes, ",") {
+		size, err := strconv.Atoi(s)
+		if err == nil && size >= want && (best == 0 || size < best) {
+			best = size
+		}
+	}
+	if best == 0 {
+		a.Show(c)
+		return
+	}
+
+	serveObject(c, storage.Attachments, attachment.ThumbnailPath(best), "image/jpeg", "", "private, max-age=86400")
+}
+
+// 加载路由中的附件并检查下载权限，失败时已写回响应
+func (a *AttachmentController) load(c *gin.Context) (*model.Attachment, bool) {
+	user := a.AuthUser(c)
+	id, _ := strconv.Atoi(c.Param("id"))
+	attachment := &model.Attachment{}
+	if err := model.DB.First(attachment, id).Error; err != nil || !model.CanDownloadAttachment(attachment, user.Id) {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "附件不存在或无权下载"})
+		return nil, false
+	}
+	return attachment, true
+}
+
+// 保存附件的选项，来自上传表单
+type attachmentOptions struct {
+	groupId int           // 要发到的群，同时检查群的存储配额
+	voice   bool          // 作为语音消息上传，检查格式、时长和大小
+	upload  *model.Upload // 分片上传合并的文件，使用上传任务预留的空间
+}
+
+// 读取表单中的 group_id 和 voice
+func attachmentOptionsOf(c *gin.Context) attachmentOptions {
+	groupId, _ := strconv.Atoi(c.DefaultPostForm("group_id", "0"))
+	return attachmentOptions{groupId: groupId, voice: c.DefaultPostForm("voice", "0") == "1"}
+}
+
+// 保存附件并写回结果
+func saveAttachment(c *gin.Context, userId int, filename, tmpPath, checksum string, size int64, mime string) {
+	attachment, failure := storeAttachment(userId, filename, tmpPath, checksum, size, mime, attachmentOptionsOf(c))
+	if failure != nil {
+		c.JSON(http.StatusOK, failure)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "上传成功", "data": attachment})
+}
+
+/**
+ * 把校验过的临时文件按内容保存并记录为附件，失败时删除临时文件
+ * 图片先去除 EXIF 等元数据再保存，缩略图在后台生成；webm、ogg 音频解析时长和音量包络
+ * @param string checksum 已计算过的 MD5，为空时由存储计算
+ * @return gin.H 失败时返回给用户的响应，成功时为 nil
+ */
+func storeAttachment(userId int, filename, tmpPath, checksum string, size int64, mime string, opts attachmentOptions) (*model.Attachment, gin.H) {
+	var (
+		key           string
+		err           error
+		width, height int
+		duration      int
+		waveform      model.Waveform
+	)
+	if imaging.StripsMetadata(mime) {
+		stripped, strippedSize, orientation, err := stripImage(tmpPath, mime)
+		_ = os.Remove(tmpPath)
+		if err != nil {
+			return nil, gin.H{"code": 0, "message": "图片格式不正确"}
+		}
+		tmpPath, size, checksum = stripped, strippedSize, ""
+		width, height = imageSize(tmpPath, orientation)
+	} else if mime == "audio/ogg" || mime == "audio/webm" {
+		duration, waveform = probeAudio(tmpPath, size)
+	}
+	if opts.voice {
+		if failure := voiceFailure(size, duration); failure != nil {
+			_ = os.Remove(tmpPath)
+			return nil, failure
+		}
+	}
+
+	// 按落盘后的实际大小计入用量
+	if size, err = filer.Size(tmpPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, gin.H{"code": 0, "message": "上传失败，请稍后再试"}
+	}
+	failure := groupQuotaFailure(userId, opts.groupId, size)
+	if opts.upload == nil && failure == nil {
+		failure = quotaFailure(userId, 0, size)
+	}
+	if failure != nil {
+		_ = os.Remove(tmpPath)
+		return nil, failure
+	}
+
+	if checksum == "" {
+		key, checksum, err = storage.Put(tmpPath)
+	} else {
+		key, err = storage.PutAs(tmpPath, checksum)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		log.Printf("保存附件失败: %v", err)
+		return nil, gin.H{"code": 0, "message": "上传失败，请稍后再试"}
+	}
+
+	attachment := &model.Attachment{
+		UploaderId: userId,
+		Name:       attachmentName(filename),
+		Size:       size,
+		SizeText:   filer.FormatBytes(size),
+		Mime:       mime,
+		Md5:        checksum,
+		Path:       key,
+		Width:      width,
+		Height:     height,
+		Duration:   duration,
+		Waveform:   waveform,
+	}
+	if opts.upload != nil {
+		err = model.CompleteUpload(opts.upload, attachment)
+	} else {
+		err = model.CreateAttachment(attachment)
+	}
+	if err != nil {
+		if usage, usageErr := model.GetStorageUsage(model.StorageOwnerUser, userId); err == model.ErrQuotaExceeded && usageErr == nil {
+			return nil, quotaExceeded(usage)
+		}
+		return nil, gin.H{"code": 0, "message": "上传失败，请稍后再试"}
+	}
+	if attachment.HasPreview() {
+		media.Default.Enqueue(attachment.Id)
+	}
+	return attachment, nil
+}
+
+/**
+ * 检查再上传 size 字节是否会超过用户的存储配额，未完成的分片上传预留的空间计入已用，
+ * groupId 大于0且用户是群成员时同时检查群的配额
+ * @return gin.H 超过配额或查询失败时返回给用户的响应，可以上传时为 nil
+ */
+func quotaFailure(userId, groupId int, size int64) gin.H {
+	usage, err := model.GetStorageUsage(model.StorageOwnerUser, userId)
+	if err != nil {
+		return gin.H{"code": 0, "message": "查询存储空间失败，请稍后再试"}
+	}
+	pending, err := model.GetPendingUploads(model.DB, userId)
+	if err != nil {
+		return gin.H{"code": 0, "message": "查询存储空间失败，请稍后再试"}
+	}
+	if usage.Exceeds(pending.Bytes + size) {
+		failure := quotaExceeded(usage)
+		if pending.Bytes > 0 {
+			failure["message"] = failure["message"].(string) + "，未完成的上传预留了 " + filer.FormatBytes(pending.Bytes)
+		}
+		return failure
+	}
+	return groupQuotaFailure(userId, groupId, size)
+}
+
+// 检查群的存储配额，groupId 为0或用户不是群成员时不检查
+func groupQuotaFailure(userId, groupId int, size int64) gin.H {
+	if groupId <= 0 || !model.IsGroupMember(groupId, userId) {
+		return nil
+	}
+	usage, err := model.GetStorageUsage(model.StorageOwnerGroup, groupId)
+	if err != nil {
+		return gin.H{"code": 0, "message": "查询存储空间失败，请稍后再试"}
+	}
+	if usage.Exceeds(size) {
+		return quotaExceeded(usage)
+	}
+	return nil
+}
+
+// 存储空间不足的提示和当前用量
+func quotaExceeded(usage *model.StorageUsage) gin.H {
+	message := "存储空间不足"
+	if usage.OwnerType == model.StorageOwnerGroup {
+		message = "群存储空间不足"
+	}
+	return gin.H{
+		"code":    0,
+		"message": message + "，已使用 " + filer.FormatBytes(usage.Bytes) + "，共 " + filer.FormatBytes(usage.Quota()),
+		"data":    usageData(usage),
+	}
+}
+
+/**
+ * 解析音频的时长（毫秒）和音量包络，无法识别时返回 0
+ * 超过语音大小上限的音频不能作为语音发送，不读取解析
+ */
+func probeAudio(path string, size int64) (int, model.Waveform) {
+	if model.VoiceMaxSize > 0 && size > model.VoiceMaxSize {
+		return 0, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, nil
+	}
+	info, err := audio.Probe(data)
+	if err != nil {
+		return 0, nil
+	}
+	duration := int(info.Duration.Milliseconds())
+	if duration == 0 {
+		duration = 1
+	}
+	return duration, info.Waveform
+}
+
+/**
+ * 检查上传的语音能否作为语音消息发送
+ * @return gin.H 不可以时返回给用户的响应，可以时为 nil
+ */
+func voiceFailure(size int64, duration int) gin.H {
+	message := ""
+	switch {
+	case model.VoiceMaxSize > 0 && size > model.VoiceMaxSize:
+		message = "语音文件大小不能超过 " + filer.FormatBytes(model.VoiceMaxSize)
+	case duration == 0:
+		message = "无法识别的语音文件，请上传 webm 或 ogg 格式的录音"
+	case model.VoiceMaxDuration > 0 && duration > model.VoiceMaxDuration:
+		message = "语音时长不能超过 " + strconv.Itoa(model.VoiceMaxDuration/1000) + " 秒"
+	}
+	if message != "" {
+		return gin.H{"code": 0, "message": message}
+	}
+	return nil
+}
+
+// 去除图片的元数据，写入新的临时文件
+func stripImage(path, mime string) (stripped string, size int64, orientation int, err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	defer src.Close()
+	dst, err := storage.TempFile()
+	if err != nil {
+		return "", 0, 0, err
+	}
+	orientation, err = imaging.StripMetadata(src, dst, mime)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		size, err = filer.Size(dst.Name())
+	}
+	if err != nil {
+		_ = os.Remove(dst.Name())
+		return "", 0, 0, err
+	}
+	return dst.Name(), size, orientation, nil
+}
+
+// 读取图片头部得到转正后的宽高，无法识别时返回 0
+func imageSize(path string, orientation int) (int, int) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0
+	}
+	return imaging.DisplaySize(config.Width, config.Height, orientation)
+}
+
+// 按文件开头的内容识别文件类型，不含 charset 等参数；ogg、webm 封装的纯音频识别为 audio/ogg、audio/webm
+func contentType(head []byte) string {
+	if mime := audio.Sniff(head); mime != "" {
+		return mime
+	}
+	return strings.TrimSpace(strings.Split(http.DetectContentType(head), ";")[0])
+}
+
+// 单个附件的大小上限（字节）
+func attachmentMaxSize() int64 {
+	return variable.Config.Section(ini.DefaultSection).Key("ATTACHMENT_MAX_SIZE").MustInt64(10) << 20
+}
+
+// 是否允许上传该类型的文件，配置中的 image/* 表示所有图片
+func allowedMime(mime string) bool {
+	allowed := variable.Config.Section(ini.DefaultSection).Key("ATTACHMENT_ALLOWED_TYPES").MustString(defaultAttachmentTypes)
+	for _, pattern := range strings.Split(allowed, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == mime || (strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mime, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// 去掉客户端文件名中的路径，过长时截断
+func attachmentName(filename string) string {
+	name := filepath.Base(strings.ReplaceAll(filename, "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		return "file"
+	}
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
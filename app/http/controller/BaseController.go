@@ -0,0 +1,20 @@
+package controller
+
+import (
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"go-chats/app/global/variable"
+)
+
+type BaseController struct{}
+
+// 获取当前登录用户，优先读取 Auth 中间件写入上下文的数据
+func (b *BaseController) AuthUser(c *gin.Context) variable.UserSessionData {
+	if value, ok := c.Get("user"); ok {
+		if user, ok := value.(variable.UserSessionData); ok {
+			return user
+		}
+	}
+	user, _ := sessions.Default(c).Get("user").(variable.UserSessionData)
+	return user
+}
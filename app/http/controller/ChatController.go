@@ -0,0 +1,275 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-chats/app/hub"
+	"go-chats/app/model"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type ChatController struct {
+	BaseController
+}
+
+// 建立 WebSocket 连接
+func (ch *ChatController) Ws(c *gin.Context) {
+	user := ch.AuthUser(c)
+	if err := hub.ServeWs(hub.Default, c.Writer, c.Request, user); err != nil {
+		// 升级失败时 upgrader 已经写回了 HTTP 错误响应
+		log.Printf("websocket: 用户 %d 升级连接失败: %v", user.Id, err)
+	}
+}
+
+// 聊天记录，按消息ID游标分页，conversation_id、user_id（单聊对方ID）、group_id、thread_id（话题根消息ID）四选一
+func (ch *ChatController) History(c *gin.Context) {
+	user := ch.AuthUser(c)
+	conversationId, _ := strconv.Atoi(c.DefaultQuery("conversation_id", "0"))
+	peerId, _ := strconv.Atoi(c.DefaultQuery("user_id", "0"))
+	groupId, _ := strconv.Atoi(c.DefaultQuery("group_id", "0"))
+	threadId, _ := strconv.Atoi(c.DefaultQuery("thread_id", "0"))
+	before, _ := strconv.Atoi(c.DefaultQuery("before", "0"))
+	after, _ := strconv.Atoi(c.DefaultQuery("after", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	var (
+		conv *model.Conversation
+		err  error
+	)
+	if conversationId > 0 {
+		conv = &model.Conversation{}
+		err = model.DB.First(conv, conversationId).Error
+	} else if peerId > 0 {
+		conv, err = model.FindDirectConversation(user.Id, peerId)
+		if err == gorm.ErrRecordNotFound {
+			// 还没有聊过天，返回空记录
+			c.JSON(http.StatusOK, gin.H{
+				"code":    1,
+				"message": "获取成功",
+				"data":    gin.H{"conversation_id": 0, "list": []model.Message{}, "has_more": false},
+			})
+			return
+		}
+	} else if groupId > 0 {
+		conv = &model.Conversation{}
+		err = model.DB.Where("type = ? AND group_id = ?", model.ConversationGroup, groupId).First(conv).Error
+	} else if threadId > 0 {
+		conv, err = model.FindThreadConversation(threadId)
+		if err == gorm.ErrRecordNotFound {
+			// 还没有人回复，返回空记录
+			c.JSON(http.StatusOK, gin.H{
+				"code":    1,
+				"message": "获取成功",
+				"data":    gin.H{"conversation_id": 0, "list": []model.Message{}, "has_more": false},
+			})
+			return
+		}
+	} else {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "请指定会话"})
+		return
+	}
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该会话不存在"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询会话失败"})
+		return
+	}
+
+	if !conv.HasMember(user.Id) {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "无权查看该会话"})
+		return
+	}
+
+	messages, hasMore, err := model.MessageHistory(user.Id, conv.Id, before, after, limit)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询聊天记录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "获取成功",
+		"data":    gin.H{"conversation_id": conv.Id, "list": messages, "has_more": hasMore},
+	})
+}
+
+// 消息的送达、已读情况，返回游标已越过该消息的会话成员；语音消息还返回已收听的成员
+func (ch *ChatController) Receipts(c *gin.Context) {
+	user := ch.AuthUser(c)
+	id, _ := strconv.Atoi(c.Param("id"))
+	msg := &model.Message{}
+	if err := model.DB.First(msg, id).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该消息不存在"})
+		return
+	}
+
+	conv := &model.Conversation{}
+	if err := model.DB.First(conv, msg.ConversationId).Error; err != nil || !conv.HasMember(user.Id) {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "无权查看该消息"})
+		return
+	}
+
+	cursors, err := model.MessageReceipts(msg)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询回执失败"})
+		return
+	}
+
+	delivered := make([]gin.H, 0, len(cursors))
+	read := make([]gin.H, 0, len(cursors))
+	for _, cursor := range cursors {
+		item := gin.H{"user": cursor.User, "updated_at": cursor.UpdatedAt}
+		if cursor.ReadMessageId >= msg.Id {
+			read = append(read, item)
+		} else {
+			delivered = append(delivered, item)
+		}
+	}
+	data := gin.H{"delivered": delivered, "read": read}
+	if msg.ContentType == model.ContentVoice {
+		listens, err := model.MessageListens(msg.Id)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询回执失败"})
+			return
+		}
+		listened := make([]gin.H, 0, len(listens))
+		for _, listen := range listens {
+			listened = append(listened, gin.H{"user": listen.User, "listened_at": listen.CreatedAt})
+		}
+		data["listened"] = listened
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": data})
+}
+
+// 编辑消息，只能编辑自己发送的文本消息
+func (ch *ChatController) Edit(c *gin.Context) {
+	user := ch.AuthUser(c)
+	id, _ := strconv.Atoi(c.Param("id"))
+	content := c.DefaultPostForm("content", "")
+	if strings.TrimSpace(content) == "" {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "消息内容不能为空"})
+		return
+	}
+
+	msg, err := hub.Default.EditMessage(user.Id, id, content)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": hub.MessageErrorText(err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "已编辑", "data": msg})
+}
+
+// 撤回消息，只能在发送后一定时间内撤回自己发送的消息
+func (ch *ChatController) Recall(c *gin.Context) {
+	user := ch.AuthUser(c)
+	id, _ := strconv.Atoi(c.Param("id"))
+	msg, err := hub.Default.RecallMessage(user.Id, id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": hub.MessageErrorText(err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "已撤回", "data": msg})
+}
+
+// 删除消息，只对自己删除，会话中的其他人不受影响
+func (ch *ChatController) Delete(c *gin.Context) {
+	user := ch.AuthUser(c)
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := hub.Default.DeleteMessage(user.Id, id); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": hub.MessageErrorText(err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "已删除"})
+}
+
+// 消息的编辑历史
+func (ch *ChatController) Revisions(c *gin.Context) {
+	user := ch.AuthUser(c)
+	id, _ := strconv.Atoi(c.Param("id"))
+	msg := &model.Message{}
+	if err := model.DB.First(msg, id).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该消息不存在"})
+		return
+	}
+
+	conv := &model.Conversation{}
+	if err := model.DB.First(conv, msg.ConversationId).Error; err != nil || !conv.HasMember(user.Id) {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "无权查看该消息"})
+		return
+	}
+
+	revisions, err := model.MessageRevisions(msg.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询编辑历史失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": revisions})
+}
+
+// 消息的表情回应汇总
+func (ch *ChatController) Reactions(c *gin.Context) {
+	user := ch.AuthUser(c)
+	id, _ := strconv.Atoi(c.Param("id"))
+	msg := &model.Message{}
+	if err := model.DB.First(msg, id).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该消息不存在"})
+		return
+	}
+
+	conv := &model.Conversation{}
+	if err := model.DB.First(conv, msg.ConversationId).Error; err != nil || !conv.HasMember(user.Id) {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "无权查看该消息"})
+		return
+	}
+
+	reactions, err := model.MessageReactions(msg.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询表情回应失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": reactions})
+}
+
+// 添加表情回应
+func (ch *ChatController) React(c *gin.Context) {
+	ch.react(c, c.DefaultPostForm("emoji", ""), true)
+}
+
+// 取消表情回应，表情通过 emoji 查询参数传递
+func (ch *ChatController) Unreact(c *gin.Context) {
+	ch.react(c, c.DefaultQuery("emoji", ""), false)
+}
+
+func (ch *ChatController) react(c *gin.Context, emoji string, add bool) {
+	user := ch.AuthUser(c)
+	id, _ := strconv.Atoi(c.Param("id"))
+	if !hub.ValidEmoji(emoji) {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "请选择表情"})
+		return
+	}
+	if err := hub.Default.React(user.Id, id, emoji, add); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": hub.MessageErrorText(err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "操作成功"})
+}
+
+// 标记语音消息已收听，客户端开始播放时调用，重复调用不报错
+func (ch *ChatController) Listened(c *gin.Context) {
+	user := ch.AuthUser(c)
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := hub.Default.Listened(user.Id, id); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": hub.MessageErrorText(err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "操作成功"})
+}
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-chats/app/model"
+	"net/http"
+)
+
+// 会话列表
+type ConversationController struct {
+	BaseController
+}
+
+/**
+ * 会话列表，包含最后一条消息、未读数和已读位置
+ * 单聊会话附带对方的送达、已读位置，用于显示自己发出的消息的状态
+ * 群聊会话附带免打扰状态和未读的提及数，免打扰的群被 @ 时仍需提醒
+ */
+func (co *ConversationController) Index(c *gin.Context) {
+	user := co.AuthUser(c)
+	conversations, err := model.UserConversations(user.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询会话失败"})
+		return
+	}
+
+	ids := make([]int, 0, len(conversations))
+	directIds := make([]int, 0, len(conversations))
+	peerIds := make([]int, 0, len(conversations))
+	groupIds := make([]int, 0, len(conversations))
+	for _, conv := range conversations {
+		ids = append(ids, conv.Id)
+		if conv.Type == model.ConversationGroup {
+			groupIds = append(groupIds, conv.GroupId)
+			continue
+		}
+		directIds = append(directIds, conv.Id)
+		if conv.UserId == user.Id {
+			peerIds = append(peerIds, conv.PeerId)
+		} else {
+			peerIds = append(peerIds, conv.UserId)
+		}
+	}
+
+	unread, err := model.UnreadCounts(user.Id, ids)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询未读数失败"})
+		return
+	}
+	cursors, err := model.ReadCursors(user.Id, ids)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询会话失败"})
+		return
+	}
+	peerCursors, err := model.PeerReadCursors(user.Id, directIds)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询会话失败"})
+		return
+	}
+	mentions, err := model.UnreadMentionCounts(user.Id, ids)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询未读数失败"})
+		return
+	}
+
+	peers := make([]model.User, 0, len(peerIds))
+	groups := make([]model.Group, 0, len(groupIds))
+	if len(peerIds) > 0 {
+		model.DB.Select("id", "username", "nickname").Where("id IN ?", peerIds).Find(&peers)
+	}
+	if len(groupIds) > 0 {
+		model.DB.Where("id IN ?", groupIds).Find(&groups)
+	}
+	peerMap := make(map[int]model.User, len(peers))
+	for _, u := range peers {
+		peerMap[u.Id] = u
+	}
+	groupMap := make(map[int]model.Group, len(groups))
+	for _, g := range groups {
+		groupMap[g.Id] = g
+	}
+	mutedIds := make([]int, 0)
+	if len(groupIds) > 0 {
+		model.DB.Model(&model.GroupMember{}).Where("user_id = ? AND group_id IN ? AND muted = ?", user.Id, groupIds, true).Pluck("group_id", &mutedIds)
+	}
+	muted := make(map[int]bool, len(mutedIds))
+	for _, id := range mutedIds {
+		muted[id] = true
+	}
+
+	data := make([]gin.H, 0, len(conversations))
+	for _, conv := range conversations {
+		item := gin.H{
+			"id":              conv.Id,
+			"type":            conv.Type,
+			"last_message":    conv.LastMessage,
+			"unread":          unread[conv.Id],
+			"read_message_id": cursors[conv.Id].ReadMessageId,
+			"updated_at":      conv.UpdatedAt,
+		}
+		if conv.Type == model.ConversationGroup {
+			group, ok := groupMap[conv.GroupId]
+			if !ok {
+				// 群已解散
+				continue
+			}
+			item["group"] = group
+			item["muted"] = muted[group.Id]
+			item["unread_mentions"] = mentions[conv.Id]
+		} else {
+			peerId := conv.PeerId
+			if conv.UserId != user.Id {
+				peerId = conv.UserId
+			}
+			item["peer"] = peerMap[peerId]
+			item["peer_delivered_message_id"] = peerCursors[conv.Id].DeliveredMessageId
+			item["peer_read_message_id"] = peerCursors[conv.Id].ReadMessageId
+		}
+		data = append(data, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": data})
+}
@@ -0,0 +1,334 @@
+package controller
+
+import (
+	"github.com/astaxie/beego/validation"
+	"github.com/gin-gonic/gin"
+	"go-chats/app/hub"
+	"go-chats/app/model"
+	"go-chats/app/utils/helper"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 好友、好友申请与好友分组
+type FriendController struct {
+	BaseController
+}
+
+// 搜索用户，用于添加好友
+func (f *FriendController) Search(c *gin.Context) {
+	user := f.AuthUser(c)
+	keyword := c.DefaultQuery("keyword", "")
+	if strings.TrimSpace(keyword) == "" {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "请输入用户名、昵称或邮箱"})
+		return
+	}
+
+	users, err := model.SearchUsers(keyword, user.Id, 20)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "搜索失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": users})
+}
+
+// 好友列表
+func (f *FriendController) Index(c *gin.Context) {
+	user := f.AuthUser(c)
+	friends, err := model.Friends(user.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询好友失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": friends})
+}
+
+// 修改好友备注、分组
+func (f *FriendController) Update(c *gin.Context) {
+	user := f.AuthUser(c)
+	friendId, _ := strconv.Atoi(c.Param("id"))
+	remark := strings.TrimSpace(c.DefaultPostForm("remark", ""))
+	contactGroupId, _ := strconv.Atoi(c.DefaultPostForm("contact_group_id", "0"))
+
+	validate := validation.Validation{}
+	validate.MaxSize(remark, 64, "remark").Message("备注不能超过64个字符")
+	if validate.HasErrors() {
+		for _, err := range validate.Errors {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": err.Error()})
+			return
+		}
+	}
+
+	if err := model.UpdateFriend(user.Id, friendId, remark, contactGroupId); err != nil {
+		switch err {
+		case model.ErrNotFriends:
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "对方不是你的好友"})
+		case model.ErrContactGroupNotFound:
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "分组不存在"})
+		default:
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "修改失败，请稍后再试"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "修改成功"})
+}
+
+// 删除好友
+func (f *FriendController) Delete(c *gin.Context) {
+	user := f.AuthUser(c)
+	friendId, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeleteFriend(user.Id, friendId); err != nil {
+		if err == model.ErrNotFriends {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "对方不是你的好友"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "删除失败，请稍后再试"})
+		return
+	}
+
+	hub.Default.SendFriendEvent(friendId, user.Id, "deleted", gin.H{"user_id": user.Id})
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "已删除"})
+}
+
+// 好友申请列表，type 为 received（收到的待处理申请，默认）或 sent（发出的申请）
+func (f *FriendController) Requests(c *gin.Context) {
+	user := f.AuthUser(c)
+
+	var (
+		requests []model.FriendRequest
+		err      error
+	)
+	if c.DefaultQuery("type", "received") == "sent" {
+		requests, err = model.SentFriendRequests(user.Id, 100)
+	} else {
+		requests, err = model.ReceivedFriendRequests(user.Id)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询好友申请失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": requests})
+}
+
+// 发送好友申请，对方在线时实时推送，离线时登录后通过申请列表获取
+func (f *FriendController) SendRequest(c *gin.Context) {
+	user := f.AuthUser(c)
+	toId, _ := strconv.Atoi(c.DefaultPostForm("user_id", "0"))
+	message := strings.TrimSpace(c.DefaultPostForm("message", ""))
+
+	validate := validation.Validation{}
+	validate.Min(toId, 1, "user_id").Message("请选择要添加的用户")
+	validate.MaxSize(message, 255, "message").Message("验证信息不能超过255个字符")
+	if validate.HasErrors() {
+		for _, err := range validate.Errors {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": err.Error()})
+			return
+		}
+	}
+	if toId == user.Id {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "不能添加自己为好友"})
+		return
+	}
+
+	target := model.User{}
+	if err := model.DB.Select("id", "activate", "add_friend_policy").First(&target, toId).Error; err != nil || target.Activate != model.UserActive {
+		if err != nil && err != gorm.ErrRecordNotFound {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询用户失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该用户不存在"})
+		return
+	}
+
+	switch model.CanAddFriend(user.Id, &target) {
+	case model.ErrBlockingPeer:
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "你已将对方加入黑名单，请先移出黑名单"})
+		return
+	case model.ErrBlockedByPeer, model.ErrPrivacyRejected:
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "对方设置了不允许通过此方式添加好友"})
+		return
+	case nil:
+	default:
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询用户失败"})
+		return
+	}
+
+	request, accepted, err := model.SendFriendRequest(user.Id, toId, message)
+	if err != nil {
+		if err == model.ErrAlreadyFriends {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "你们已经是好友了"})
+			return
+		}
+		log.Printf("用户 %d 发送好友申请失败: %v", user.Id, err)
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "发送失败，请稍后再试"})
+		return
+	}
+
+	// 对方之前也申请过添加自己，直接成为好友
+	if accepted {
+		hub.Default.SendFriendEvent(toId, user.Id, "accepted", request)
+		c.JSON(http.StatusOK, gin.H{"code": 1, "message": "对方也申请了添加你为好友，你们已经是好友了", "data": request})
+		return
+	}
+
+	request.From = &model.User{Id: user.Id, Username: user.Username, Nickname: user.Nickname}
+	hub.Default.SendFriendEvent(toId, user.Id, "request", request)
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "好友申请已发送", "data": request})
+}
+
+// 同意好友申请，可同时指定分组和备注
+func (f *FriendController) Accept(c *gin.Context) {
+	user := f.AuthUser(c)
+	id, _ := strconv.Atoi(c.Param("id"))
+	contactGroupId, _ := strconv.Atoi(c.DefaultPostForm("contact_group_id", "0"))
+	remark := strings.TrimSpace(c.DefaultPostForm("remark", ""))
+
+	if contactGroupId > 0 {
+		if _, err := model.FindContactGroup(user.Id, contactGroupId); err != nil {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "分组不存在"})
+			return
+		}
+	}
+
+	request, err := model.AcceptFriendRequest(id, user.Id, contactGroupId, remark)
+	if err != nil {
+		f.requestError(c, err)
+		return
+	}
+
+	hub.Default.SendFriendEvent(request.FromId, user.Id, "accepted", request)
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "已添加好友", "data": request})
+}
+
+// 拒绝好友申请
+func (f *FriendController) Reject(c *gin.Context) {
+	user := f.AuthUser(c)
+	id, _ := strconv.Atoi(c.Param("id"))
+	request, err := model.RejectFriendRequest(id, user.Id)
+	if err != nil {
+		f.requestError(c, err)
+		return
+	}
+
+	hub.Default.SendFriendEvent(request.FromId, user.Id, "rejected", request)
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "已拒绝"})
+}
+
+// 撤回自己发出的好友申请
+func (f *FriendController) Cancel(c *gin.Context) {
+	user := f.AuthUser(c)
+	id, _ := strconv.Atoi(c.Param("id"))
+	request, err := model.CancelFriendRequest(id, user.Id)
+	if err != nil {
+		f.requestError(c, err)
+		return
+	}
+
+	hub.Default.SendFriendEvent(request.ToId, user.Id, "canceled", request)
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "已撤回"})
+}
+
+func (f *FriendController) requestError(c *gin.Context, err error) {
+	if err == model.ErrFriendRequestNotFound {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该申请不存在或已处理"})
+		return
+	}
+	log.Printf("处理好友申请失败: %v", err)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "操作失败，请稍后再试"})
+}
+
+// 好友分组列表
+func (f *FriendController) ContactGroups(c *gin.Context) {
+	user := f.AuthUser(c)
+	groups, err := model.ContactGroups(user.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询分组失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": groups})
+}
+
+// 新建分组
+func (f *FriendController) CreateContactGroup(c *gin.Context) {
+	user := f.AuthUser(c)
+	name, ok := f.contactGroupName(c)
+	if !ok {
+		return
+	}
+
+	group, err := model.CreateContactGroup(user.Id, name)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "创建分组失败，请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "创建成功", "data": group})
+}
+
+// 重命名分组
+func (f *FriendController) RenameContactGroup(c *gin.Context) {
+	user := f.AuthUser(c)
+	id, _ := strconv.Atoi(c.Param("id"))
+	name, ok := f.contactGroupName(c)
+	if !ok {
+		return
+	}
+
+	if err := model.RenameContactGroup(user.Id, id, name); err != nil {
+		if err == model.ErrContactGroupNotFound {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "分组不存在"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "修改失败，请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "修改成功"})
+}
+
+// 调整分组顺序，ids 为逗号分隔的分组ID，按新的顺序排列
+func (f *FriendController) SortContactGroups(c *gin.Context) {
+	user := f.AuthUser(c)
+	ids := helper.ParseIds(c.DefaultPostForm("ids", ""))
+	if len(ids) == 0 {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "请指定分组顺序"})
+		return
+	}
+
+	if err := model.SortContactGroups(user.Id, ids); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "排序失败，请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "排序成功"})
+}
+
+// 删除分组，组内好友移到未分组
+func (f *FriendController) DeleteContactGroup(c *gin.Context) {
+	user := f.AuthUser(c)
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeleteContactGroup(user.Id, id); err != nil {
+		if err == model.ErrContactGroupNotFound {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "分组不存在"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "删除失败，请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "已删除"})
+}
+
+func (f *FriendController) contactGroupName(c *gin.Context) (string, bool) {
+	name := strings.TrimSpace(c.DefaultPostForm("name", ""))
+
+	validate := validation.Validation{}
+	validate.Required(name, "name").Message("分组名称不能为空")
+	validate.MaxSize(name, 32, "name").Message("分组名称不能超过32个字符")
+	if validate.HasErrors() {
+		for _, err := range validate.Errors {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": err.Error()})
+			return "", false
+		}
+	}
+	return name, true
+}
@@ -0,0 +1,395 @@
+package controller
+
+import (
+	"github.com/astaxie/beego/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/go-ini/ini"
+	"go-chats/app/global/variable"
+	"go-chats/app/hub"
+	"go-chats/app/model"
+	"go-chats/app/utils/helper"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 群聊管理，所有权限都以当前登录用户在群中的角色为准
+type GroupController struct {
+	BaseController
+}
+
+// 我加入的群聊
+func (g *GroupController) Index(c *gin.Context) {
+	user := g.AuthUser(c)
+	groups, err := model.UserGroups(user.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询群聊失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": groups})
+}
+
+// 创建群聊，user_ids 为逗号分隔的初始成员ID
+func (g *GroupController) Create(c *gin.Context) {
+	user := g.AuthUser(c)
+	name := strings.TrimSpace(c.DefaultPostForm("name", ""))
+	userIds := helper.ParseIds(c.DefaultPostForm("user_ids", ""))
+
+	validate := validation.Validation{}
+	validate.Required(name, "name").Message("群名称不能为空")
+	validate.MaxSize(name, 64, "name").Message("群名称不能超过64个字符")
+	if validate.HasErrors() {
+		for _, err := range validate.Errors {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": err.Error()})
+			return
+		}
+	}
+
+	memberIds, err := model.ActiveUserIds(userIds)
+	if err == nil {
+		memberIds, err = withoutBlockers(user.Id, memberIds)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询用户失败"})
+		return
+	}
+	if len(memberIds)+1 > groupMaxMembers() {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "群成员数量超过上限"})
+		return
+	}
+
+	group, err := model.CreateGroup(user.Id, name, memberIds)
+	if err != nil {
+		log.Printf("用户 %d 创建群聊失败: %v", user.Id, err)
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "创建群聊失败，请稍后再试"})
+		return
+	}
+
+	hub.Default.SendGroupEvent(append(memberIds, user.Id), group.Id, user.Id, "created", group)
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "创建成功", "data": group})
+}
+
+// 群详情及成员列表，只有群成员可以查看
+func (g *GroupController) Show(c *gin.Context) {
+	user := g.AuthUser(c)
+	group, _, ok := g.load(c, user.Id)
+	if !ok {
+		return
+	}
+
+	members, err := model.GroupMembers(group.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询群成员失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": gin.H{"group": group, "members": members}})
+}
+
+// 修改群名称、群公告，群主和管理员可操作
+func (g *GroupController) Update(c *gin.Context) {
+	user := g.AuthUser(c)
+	group, member, ok := g.load(c, user.Id)
+	if !ok {
+		return
+	}
+	if !member.IsManager() {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "只有群主和管理员可以修改群资料"})
+		return
+	}
+
+	name := strings.TrimSpace(c.DefaultPostForm("name", group.Name))
+	notice := c.DefaultPostForm("notice", group.Notice)
+
+	validate := validation.Validation{}
+	validate.Required(name, "name").Message("群名称不能为空")
+	validate.MaxSize(name, 64, "name").Message("群名称不能超过64个字符")
+	validate.MaxSize(notice, 1024, "notice").Message("群公告不能超过1024个字符")
+	if validate.HasErrors() {
+		for _, err := range validate.Errors {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": err.Error()})
+			return
+		}
+	}
+
+	if err := model.DB.Model(group).Updates(map[string]interface{}{"name": name, "notice": notice}).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "修改失败，请稍后再试"})
+		return
+	}
+	group.Name, group.Notice = name, notice
+
+	g.notify(group.Id, nil, user.Id, "updated", group)
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "修改成功", "data": group})
+}
+
+// 邀请成员，群主和管理员可操作
+func (g *GroupController) Invite(c *gin.Context) {
+	user := g.AuthUser(c)
+	group, member, ok := g.load(c, user.Id)
+	if !ok {
+		return
+	}
+	if !member.IsManager() {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "只有群主和管理员可以邀请成员"})
+		return
+	}
+
+	userIds, err := model.ActiveUserIds(helper.ParseIds(c.DefaultPostForm("user_ids", "")))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询用户失败"})
+		return
+	}
+	if len(userIds) == 0 {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "请选择要邀请的用户"})
+		return
+	}
+	if userIds, err = withoutBlockers(user.Id, userIds); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询用户失败"})
+		return
+	}
+	if len(userIds) == 0 {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "对方设置了不允许通过此方式加入群聊"})
+		return
+	}
+
+	added, err := model.AddGroupMembers(group.Id, userIds, groupMaxMembers())
+	if err != nil {
+		if err == model.ErrGroupFull {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "群成员数量超过上限"})
+			return
+		}
+		log.Printf("群 %d 邀请成员失败: %v", group.Id, err)
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "邀请失败，请稍后再试"})
+		return
+	}
+
+	if len(added) > 0 {
+		g.notify(group.Id, nil, user.Id, "member_added", gin.H{"user_ids": added})
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "邀请成功", "data": gin.H{"user_ids": added}})
+}
+
+// 移除成员，群主可以移除任何人，管理员只能移除普通成员
+func (g *GroupController) Remove(c *gin.Context) {
+	user := g.AuthUser(c)
+	group, member, ok := g.load(c, user.Id)
+	if !ok {
+		return
+	}
+
+	targetId, _ := strconv.Atoi(c.Param("user_id"))
+	if targetId == user.Id {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "不能移除自己，请使用退出群聊"})
+		return
+	}
+	target, err := model.FindGroupMember(group.Id, targetId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该用户不是群成员"})
+		return
+	}
+	if !member.IsManager() || target.Role >= member.Role {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "没有权限移除该成员"})
+		return
+	}
+
+	if err := model.RemoveGroupMember(group.Id, targetId); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "移除失败，请稍后再试"})
+		return
+	}
+
+	g.notify(group.Id, []int{targetId}, user.Id, "member_removed", gin.H{"user_id": targetId})
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "移除成功"})
+}
+
+// 设置或取消管理员，只有群主可操作，role 为 admin 或 member
+func (g *GroupController) SetRole(c *gin.Context) {
+	user := g.AuthUser(c)
+	group, member, ok := g.load(c, user.Id)
+	if !ok {
+		return
+	}
+	if member.Role != model.GroupRoleOwner {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "只有群主可以设置管理员"})
+		return
+	}
+
+	var role uint8
+	switch c.DefaultPostForm("role", "") {
+	case "admin":
+		role = model.GroupRoleAdmin
+	case "member":
+		role = model.GroupRoleMember
+	default:
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "角色只能是 admin 或 member"})
+		return
+	}
+
+	targetId, _ := strconv.Atoi(c.Param("user_id"))
+	if err := model.SetGroupMemberRole(group.Id, targetId, role); err != nil {
+		if err == model.ErrNotGroupMember {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该用户不是群成员或是群主"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "设置失败，请稍后再试"})
+		return
+	}
+
+	g.notify(group.Id, nil, user.Id, "role_changed", gin.H{"user_id": targetId, "role": role})
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "设置成功"})
+}
+
+// 转让群主，只有群主可操作，转让后原群主成为管理员
+func (g *GroupController) Transfer(c *gin.Context) {
+	user := g.AuthUser(c)
+	group, member, ok := g.load(c, user.Id)
+	if !ok {
+		return
+	}
+	if member.Role != model.GroupRoleOwner {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "只有群主可以转让群"})
+		return
+	}
+
+	targetId, _ := strconv.Atoi(c.DefaultPostForm("user_id", "0"))
+	if targetId == user.Id {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "不能转让给自己"})
+		return
+	}
+	if err := model.TransferGroupOwner(group.Id, user.Id, targetId); err != nil {
+		if err == model.ErrNotGroupMember {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该用户不是群成员"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "转让失败，请稍后再试"})
+		return
+	}
+
+	g.notify(group.Id, nil, user.Id, "owner_transferred", gin.H{"from": user.Id, "to": targetId})
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "转让成功"})
+}
+
+// 退出群聊，群主需要先转让或直接解散
+func (g *GroupController) Leave(c *gin.Context) {
+	user := g.AuthUser(c)
+	group, member, ok := g.load(c, user.Id)
+	if !ok {
+		return
+	}
+	if member.Role == model.GroupRoleOwner {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "群主不能退出群聊，请先转让群主或解散群聊"})
+		return
+	}
+
+	if err := model.RemoveGroupMember(group.Id, user.Id); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "退出失败，请稍后再试"})
+		return
+	}
+
+	g.notify(group.Id, []int{user.Id}, user.Id, "member_left", gin.H{"user_id": user.Id})
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "已退出群聊"})
+}
+
+// 设置群消息免打扰，muted=1 开启，0 关闭；开启后被 @ 时仍会提醒
+func (g *GroupController) Mute(c *gin.Context) {
+	user := g.AuthUser(c)
+	group, _, ok := g.load(c, user.Id)
+	if !ok {
+		return
+	}
+	muted := c.DefaultPostForm("muted", "1") == "1"
+
+	if err := model.MuteGroup(group.Id, user.Id, muted); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "设置失败，请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "设置成功", "data": gin.H{"muted": muted}})
+}
+
+// 解散群聊，只有群主可操作
+func (g *GroupController) Dissolve(c *gin.Context) {
+	user := g.AuthUser(c)
+	group, member, ok := g.load(c, user.Id)
+	if !ok {
+		return
+	}
+	if member.Role != model.GroupRoleOwner {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "只有群主可以解散群聊"})
+		return
+	}
+
+	memberIds, err := model.GroupMemberIds(group.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询群成员失败"})
+		return
+	}
+	if err := model.DissolveGroup(group.Id); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "解散失败，请稍后再试"})
+		return
+	}
+
+	hub.Default.SendGroupEvent(memberIds, group.Id, user.Id, "dissolved", nil)
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "群聊已解散"})
+}
+
+// 加载路由中的群及当前用户的成员信息，失败时已写回响应
+func (g *GroupController) load(c *gin.Context, userId int) (*model.Group, *model.GroupMember, bool) {
+	groupId, _ := strconv.Atoi(c.Param("id"))
+	group := &model.Group{}
+	if err := model.DB.First(group, groupId).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该群聊不存在或已解散"})
+			return nil, nil, false
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询群聊失败"})
+		return nil, nil, false
+	}
+
+	member, err := model.FindGroupMember(group.Id, userId)
+	if err != nil {
+		if err == model.ErrNotGroupMember {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "你不是该群成员"})
+			return nil, nil, false
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询群成员失败"})
+		return nil, nil, false
+	}
+	return group, member, true
+}
+
+// 推送群通知给当前全部成员，extra 为已不在群中但需要收到通知的用户
+func (g *GroupController) notify(groupId int, extra []int, operatorId int, event string, data interface{}) {
+	memberIds, err := model.GroupMemberIds(groupId)
+	if err != nil {
+		log.Printf("群 %d 推送通知失败: %v", groupId, err)
+		return
+	}
+	hub.Default.SendGroupEvent(append(memberIds, extra...), groupId, operatorId, event, data)
+}
+
+// 去掉拉黑了邀请人的用户，拉黑对方后不能再被对方拉进群
+func withoutBlockers(inviterId int, ids []int) ([]int, error) {
+	blockers, err := model.BlockersOf(inviterId, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(blockers) == 0 {
+		return ids, nil
+	}
+	blocked := make(map[int]bool, len(blockers))
+	for _, id := range blockers {
+		blocked[id] = true
+	}
+	allowed := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !blocked[id] {
+			allowed = append(allowed, id)
+		}
+	}
+	return allowed, nil
+}
+
+// 群人数上限
+func groupMaxMembers() int {
+	return variable.Config.Section(ini.DefaultSection).Key("GROUP_MAX_MEMBERS").MustInt(500)
+}
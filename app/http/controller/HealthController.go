@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-chats/app/model"
+	"net/http"
+)
+
+type HealthController struct {
+	BaseController
+}
+
+// 存活检查，进程能处理请求即返回成功
+func (h *HealthController) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "ok"})
+}
+
+// 就绪检查，数据库不可用时返回 503，负载均衡据此摘除实例
+func (h *HealthController) Ready(c *gin.Context) {
+	status := model.Health()
+	if !status.Healthy {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": 0, "message": "数据库不可用", "data": gin.H{"database": status}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "ok", "data": gin.H{"database": status}})
+}
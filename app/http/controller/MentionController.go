@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-chats/app/model"
+	"net/http"
+	"strconv"
+)
+
+// 群聊中的提及
+type MentionController struct {
+	BaseController
+}
+
+// 提及我的消息，按时间倒序，before 为上一页最后一条提及记录的ID
+func (m *MentionController) Index(c *gin.Context) {
+	user := m.AuthUser(c)
+	before, _ := strconv.Atoi(c.DefaultQuery("before", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	mentions, hasMore, err := model.UserMentions(user.Id, before, limit)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询提及失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": "获取成功",
+		"data":    gin.H{"list": mentions, "has_more": hasMore},
+	})
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-chats/app/hub"
+	"go-chats/app/model"
+	"go-chats/app/utils/helper"
+	"net/http"
+)
+
+// 单次最多查询的用户数
+const presenceBatchSize = 200
+
+// 在线状态
+type PresenceController struct {
+	BaseController
+}
+
+/**
+ * 批量查询在线状态，用于首屏渲染，之后的变化通过 WebSocket 的 presence 消息推送
+ * @param string user_ids 逗号分隔的用户ID
+ */
+func (p *PresenceController) Index(c *gin.Context) {
+	user := p.AuthUser(c)
+	ids := helper.ParseIds(c.DefaultQuery("user_ids", ""))
+	if len(ids) == 0 {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "请选择要查询的用户"})
+		return
+	}
+	if len(ids) > presenceBatchSize {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "单次最多查询200个用户"})
+		return
+	}
+
+	users := make([]model.User, 0, len(ids))
+	if err := model.DB.Select("id", "last_seen_at", "last_seen_policy").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询在线状态失败"})
+		return
+	}
+
+	// 拉黑了自己的用户始终显示为离线
+	blockerIds, err := model.BlockersOf(user.Id, ids)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询在线状态失败"})
+		return
+	}
+	blockers := make(map[int]bool, len(blockerIds))
+	for _, id := range blockerIds {
+		blockers[id] = true
+	}
+
+	// 在线状态和最后在线时间一样受对方的隐私设置限制，不可见时显示为离线
+	visible, err := model.PresenceVisibility(user.Id, users, blockers)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询在线状态失败"})
+		return
+	}
+
+	data := make([]gin.H, 0, len(users))
+	for _, u := range users {
+		status := hub.StatusOffline
+		var lastSeen interface{}
+		if visible[u.Id] {
+			status = hub.Default.Presence(u.Id)
+			if u.LastSeenAt != nil {
+				lastSeen = u.LastSeenAt.Unix()
+			}
+		}
+		data = append(data, gin.H{"user_id": u.Id, "status": status, "last_seen": lastSeen})
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": data})
+}
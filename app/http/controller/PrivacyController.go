@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-chats/app/model"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// 黑名单与隐私设置
+type PrivacyController struct {
+	BaseController
+}
+
+// 隐私选项在接口中使用的名称
+var privacyNames = map[uint8]string{
+	model.PrivacyEveryone:         "everyone",
+	model.PrivacyFriends:          "friends",
+	model.PrivacyFriendsOfFriends: "friends_of_friends",
+	model.PrivacyNobody:           "nobody",
+}
+
+// 黑名单列表
+func (p *PrivacyController) Blocks(c *gin.Context) {
+	user := p.AuthUser(c)
+	blocks, err := model.Blocks(user.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询黑名单失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": blocks})
+}
+
+// 拉黑用户，拉黑后对方无法给自己发消息、加好友，群里对方的消息也不再推送给自己
+func (p *PrivacyController) Block(c *gin.Context) {
+	user := p.AuthUser(c)
+	blockedId, _ := strconv.Atoi(c.DefaultPostForm("user_id", "0"))
+	if blockedId <= 0 || blockedId == user.Id {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "请选择要拉黑的用户"})
+		return
+	}
+	if err := model.DB.Select("id").First(&model.User{}, blockedId).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该用户不存在"})
+		return
+	}
+
+	if err := model.BlockUser(user.Id, blockedId); err != nil {
+		log.Printf("用户 %d 拉黑 %d 失败: %v", user.Id, blockedId, err)
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "操作失败，请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "已加入黑名单"})
+}
+
+// 移出黑名单
+func (p *PrivacyController) Unblock(c *gin.Context) {
+	user := p.AuthUser(c)
+	blockedId, _ := strconv.Atoi(c.Param("id"))
+	if err := model.UnblockUser(user.Id, blockedId); err != nil {
+		if err == model.ErrNotBlocked {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该用户不在黑名单中"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "操作失败，请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "已移出黑名单"})
+}
+
+// 当前隐私设置
+func (p *PrivacyController) Settings(c *gin.Context) {
+	user := p.AuthUser(c)
+	settings := model.User{}
+	if err := model.DB.Select("add_friend_policy", "last_seen_policy").First(&settings, user.Id).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询隐私设置失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": gin.H{
+		"add_friend": privacyNames[settings.AddFriendPolicy],
+		"last_seen":  privacyNames[settings.LastSeenPolicy],
+	}})
+}
+
+/**
+ * 修改隐私设置，未传的项保持不变
+ * add_friend 谁可以添加我：everyone、friends_of_friends、nobody
+ * last_seen 谁可以看到我的最后在线时间：everyone、friends、nobody
+ */
+func (p *PrivacyController) UpdateSettings(c *gin.Context) {
+	user := p.AuthUser(c)
+	updates := make(map[string]interface{})
+
+	if name, ok := c.GetPostForm("add_friend"); ok {
+		policy, ok := privacyValue(name, model.PrivacyEveryone, model.PrivacyFriendsOfFriends, model.PrivacyNobody)
+		if !ok {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "add_friend 只能是 everyone、friends_of_friends 或 nobody"})
+			return
+		}
+		updates["add_friend_policy"] = policy
+	}
+	if name, ok := c.GetPostForm("last_seen"); ok {
+		policy, ok := privacyValue(name, model.PrivacyEveryone, model.PrivacyFriends, model.PrivacyNobody)
+		if !ok {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "last_seen 只能是 everyone、friends 或 nobody"})
+			return
+		}
+		updates["last_seen_policy"] = policy
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "没有需要修改的设置"})
+		return
+	}
+
+	if err := model.DB.Model(&model.User{Id: user.Id}).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "保存失败，请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "保存成功"})
+}
+
+// 把接口中的名称转换为隐私选项，只接受 allowed 中的选项
+func privacyValue(name string, allowed ...uint8) (uint8, bool) {
+	for _, policy := range allowed {
+		if privacyNames[policy] == name {
+			return policy, true
+		}
+	}
+	return 0, false
+}
@@ -4,15 +4,23 @@ import (
 	"fmt"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/go-ini/ini"
 	consulapi "github.com/hashicorp/consul/api"
 	"github.com/astaxie/beego/validation"
 	"go-chats/app/global/variable"
+	"go-chats/app/http/middleware"
+	"go-chats/app/hub"
 	"go-chats/app/model"
-	"go-chats/app/utils/helper"
+	"go-chats/app/utils/hasher"
+	"go-chats/app/utils/mailer"
+	"go-chats/app/utils/signer"
 	"gorm.io/gorm"
+	"html"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -39,7 +47,7 @@ func (p *PublicController) Login(c *gin.Context) {
 
 		// 数据查询
 		user := model.User{}
-		if err := model.DB.Where("`username` = ?", username).First(&user).Error; err != nil {
+		if err := model.DB.Where("username = ?", username).First(&user).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
 				c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该用户不存在，请检查。"})
 				return
@@ -48,16 +56,31 @@ func (p *PublicController) Login(c *gin.Context) {
 			return
 		}
 
-		if user.Activate != 1 {
+		if user.Activate == model.UserUnverified {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该账号尚未激活，请先前往邮箱完成验证。"})
+			return
+		}
+
+		if user.Activate != model.UserActive {
 			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该用户账号已被禁用。"})
 			return
 		}
 
-		if user.Password != helper.Md5(password) {
+		ok, rehash := hasher.Check(password, user.Password)
+		if !ok {
 			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "密码不正确，请检查。"})
 			return
 		}
 
+		// 旧算法或旧参数生成的密码，登录成功后按当前配置重新加密保存
+		if rehash {
+			if hashed, err := hasher.Make(password); err == nil {
+				if err := model.DB.Model(&user).Update("password", hashed).Error; err != nil {
+					log.Printf("用户 %d 密码重新加密保存失败: %v", user.Id, err)
+				}
+			}
+		}
+
 		data := make(map[string]interface{})
 		data["id"] = user.Id
 		data["username"] = user.Username
@@ -66,7 +89,7 @@ func (p *PublicController) Login(c *gin.Context) {
 		data["jump"] = fmt.Sprintf("index?t=%d", time.Now().UnixNano())
 
 		session := sessions.Default(c)
-		session.Set("user", variable.UserSessionData{Id: user.Id, Username: user.Username, Nickname: user.Nickname, Email: user.Email})
+		session.Set("user", variable.UserSessionData{Id: user.Id, Username: user.Username, Nickname: user.Nickname, Email: user.Email, SessionVersion: user.SessionVersion})
 		_ = session.Save()
 
 		// 返回结果
@@ -83,7 +106,7 @@ func (p *PublicController) Login(c *gin.Context) {
 }
 
 func (p *PublicController) Logout(c *gin.Context) {
-	sessions.Default(c).Clear()
+	middleware.DestroySession(c)
 	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("login?t=%d", time.Now().UnixNano()))
 }
 
@@ -115,7 +138,7 @@ func (p *PublicController) Register(c *gin.Context) {
 		}
 
 		var userCount int64 = 0
-		if err := model.DB.Table((&model.User{}).TableName()).Where("`username` = ?", username).Count(&userCount).Error; err != nil {
+		if err := model.DB.Model(&model.User{}).Where("username = ?", username).Count(&userCount).Error; err != nil {
 			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询用户失败"})
 			return
 		}
@@ -125,24 +148,43 @@ func (p *PublicController) Register(c *gin.Context) {
 			return
 		}
 
+		hashed, err := hasher.Make(password)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "注册失败，请稍后再试"})
+			return
+		}
+
+		// 开启邮箱验证时，账号需要通过邮件中的链接激活后才能登录
+		verifyEmail := variable.Config.Section(ini.DefaultSection).Key("REGISTER_VERIFY_EMAIL").MustBool(false)
+		now := time.Now()
 		user := model.User{
 			Username: username,
-			Password: helper.Md5(password),
+			Password: hashed,
 			Nickname: nickname,
 			Email: email,
-			Activate: 1,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
+			Activate: model.UserActive,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if verifyEmail {
+			user.Activate = model.UserUnverified
+			user.VerifySentAt = &now
 		}
 
-		if err := model.DB.Table((&model.User{}).TableName()).Create(&user).Error; err != nil {
+		if err := model.DB.Create(&user).Error; err != nil {
 			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "注册失败，请稍后再试"})
 			return
 		}
 
+		message := "注册成功"
+		if verifyEmail {
+			go sendVerificationMail(user)
+			message = "注册成功，验证邮件已发送，请前往邮箱激活账号"
+		}
+
 		c.JSON(http.StatusOK, gin.H{
 			"code":    1,
-			"message": "注册成功",
+			"message": message,
 			"data":    map[string]string{"jump": fmt.Sprintf("login?t=%d", time.Now().UnixNano())},
 		})
 	} else {
@@ -153,11 +195,223 @@ func (p *PublicController) Register(c *gin.Context) {
 }
 
 func (p *PublicController) ResetPassword(c *gin.Context) {
-	c.HTML(http.StatusOK, "reset-password.html", gin.H{
-		"title": "找回密码页",
+	if c.Request.Method == "POST" {
+		// 接收参数
+		account := c.DefaultPostForm("account", "")
+
+		// 校验参数
+		validate := validation.Validation{}
+		validate.Required(account, "account").Message("请输入用户名或邮箱")
+		if validate.HasErrors() {
+			for _, err := range validate.Errors {
+				c.JSON(http.StatusOK, gin.H{"code": 0, "message": err.Error()})
+				return
+			}
+		}
+
+		// 无论账号是否存在都返回相同的结果，避免被用来探测账号
+		user := model.User{}
+		err := model.DB.Where("username = ? OR email = ?", account, account).First(&user).Error
+		if err == nil && user.Email != "" {
+			ttl := time.Duration(variable.Config.Section(ini.DefaultSection).Key("PASSWORD_RESET_EXPIRE").MustInt(60)) * time.Minute
+			token, err := model.CreatePasswordReset(user.Id, ttl)
+			if err != nil {
+				log.Printf("用户 %d 生成重置密码令牌失败: %v", user.Id, err)
+			} else {
+				// 异步发送，避免响应时间暴露账号是否存在
+				go sendPasswordResetMail(user, token, ttl)
+			}
+		} else if err != nil && err != gorm.ErrRecordNotFound {
+			log.Printf("重置密码查询用户失败: %v", err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    1,
+			"message": "如果该账号存在，重置密码的链接已发送到其绑定的邮箱，请注意查收",
+		})
+	} else {
+		c.HTML(http.StatusOK, "reset-password.html", gin.H{
+			"title": "找回密码页",
+		})
+	}
+}
+
+// 通过邮件中的链接设置新密码
+func (p *PublicController) SetPassword(c *gin.Context) {
+	if c.Request.Method == "POST" {
+		// 接收参数
+		token := c.DefaultPostForm("token", "")
+		password := c.DefaultPostForm("password", "")
+		confirmPassword := c.DefaultPostForm("confirm_password", "")
+
+		// 校验参数
+		validate := validation.Validation{}
+		validate.Required(token, "token").Message("重置密码链接无效，请重新申请")
+		validate.Required(password, "password").Message("请输入新密码")
+		validate.MinSize(password, 6, "password").Message("密码不能少于6位数，请检查")
+		if validate.HasErrors() {
+			for _, err := range validate.Errors {
+				c.JSON(http.StatusOK, gin.H{"code": 0, "message": err.Error()})
+				return
+			}
+		}
+
+		if password != confirmPassword {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "两次密码输入不一致"})
+			return
+		}
+
+		hashed, err := hasher.Make(password)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "重置密码失败，请稍后再试"})
+			return
+		}
+
+		var reset *model.PasswordReset
+		err = model.DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if reset, err = model.ConsumePasswordReset(tx, token); err != nil {
+				return err
+			}
+			// 修改密码的同时递增登录态版本号，使所有已登录的Session失效
+			return tx.Model(&model.User{Id: reset.UserId}).Updates(map[string]interface{}{
+				"password":        hashed,
+				"session_version": gorm.Expr("session_version + 1"),
+			}).Error
+		})
+		if err != nil {
+			if err == model.ErrInvalidResetToken {
+				c.JSON(http.StatusOK, gin.H{"code": 0, "message": "重置密码链接无效或已过期，请重新申请"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "重置密码失败，请稍后再试"})
+			return
+		}
+		hub.Default.Kick(reset.UserId)
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    1,
+			"message": "密码重置成功，请使用新密码登录",
+			"data":    map[string]string{"jump": fmt.Sprintf("login?t=%d", time.Now().UnixNano())},
+		})
+	} else {
+		token := c.DefaultQuery("token", "")
+		_, err := model.FindPasswordReset(token)
+		c.HTML(http.StatusOK, "set-password.html", gin.H{
+			"title": "设置新密码",
+			"token": token,
+			"valid": err == nil,
+		})
+	}
+}
+
+// 通过邮件中的链接激活账号
+func (p *PublicController) VerifyEmail(c *gin.Context) {
+	message := "账号激活成功，现在可以登录了"
+	payload, err := signer.Verify(verifyEmailPurpose, c.DefaultQuery("token", ""))
+	if err == nil {
+		var (
+			userId int
+			email  string
+		)
+		if _, err = fmt.Sscanf(payload, "%d:%s", &userId, &email); err == nil {
+			// 只激活等待验证的账号，令牌中的邮箱必须与当前邮箱一致，重复点击链接视为成功
+			result := model.DB.Model(&model.User{}).
+				Where("id = ? AND email = ? AND activate = ?", userId, email, model.UserUnverified).
+				Update("activate", model.UserActive)
+			err = result.Error
+			if err == nil && result.RowsAffected == 0 {
+				err = model.DB.Where("id = ? AND email = ? AND activate = ?", userId, email, model.UserActive).First(&model.User{}).Error
+			}
+		}
+	}
+
+	switch {
+	case err == signer.ErrExpired:
+		message = "验证链接已过期，请重新发送验证邮件"
+	case err != nil:
+		message = "验证链接无效，请重新发送验证邮件"
+	}
+
+	c.HTML(http.StatusOK, "verify-email.html", gin.H{
+		"title":   "邮箱验证",
+		"success": err == nil,
+		"message": message,
 	})
 }
 
+// 重新发送账号激活邮件
+func (p *PublicController) ResendVerification(c *gin.Context) {
+	// 接收参数
+	account := c.DefaultPostForm("account", "")
+
+	// 校验参数
+	validate := validation.Validation{}
+	validate.Required(account, "account").Message("请输入用户名或邮箱")
+	if validate.HasErrors() {
+		for _, err := range validate.Errors {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": err.Error()})
+			return
+		}
+	}
+
+	// 无论账号是否存在、是否已激活、是否在冷却时间内都返回相同的结果，避免被用来探测邮箱是否注册
+	cooldown := variable.Config.Section(ini.DefaultSection).Key("VERIFY_EMAIL_RESEND_INTERVAL").MustInt(60)
+	user := model.User{}
+	if err := model.DB.Where("(username = ? OR email = ?) AND activate = ?", account, account, model.UserUnverified).First(&user).Error; err == nil {
+		// 条件更新发送时间，同一账号在冷却时间内只会发送一次
+		now := time.Now()
+		result := model.DB.Model(&model.User{}).
+			Where("id = ? AND (verify_sent_at IS NULL OR verify_sent_at < ?)", user.Id, now.Add(-time.Duration(cooldown)*time.Second)).
+			Update("verify_sent_at", now)
+		if result.Error != nil {
+			log.Printf("用户 %d 更新验证邮件发送时间失败: %v", user.Id, result.Error)
+		} else if result.RowsAffected > 0 {
+			go sendVerificationMail(user)
+		}
+	} else if err != gorm.ErrRecordNotFound {
+		log.Printf("重发验证邮件查询用户失败: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    1,
+		"message": fmt.Sprintf("如果该账号存在且尚未激活，验证邮件已重新发送，请注意查收（%d 秒内不会重复发送）", cooldown),
+	})
+}
+
+const verifyEmailPurpose = "verify-email"
+
+// 发送账号激活邮件
+func sendVerificationMail(user model.User) {
+	ttl := time.Duration(variable.Config.Section(ini.DefaultSection).Key("VERIFY_EMAIL_EXPIRE").MustInt(1440)) * time.Minute
+	token := signer.Sign(verifyEmailPurpose, fmt.Sprintf("%d:%s", user.Id, user.Email), time.Now().Add(ttl))
+	link := fmt.Sprintf("%s/verify-email?token=%s", appUrl(), url.QueryEscape(token))
+	body := fmt.Sprintf(
+		`<p>%s，您好：</p><p>感谢注册，请在 %d 小时内点击下面的链接激活您的账号：</p><p><a href="%s">%s</a></p><p>如果这不是您本人的操作，请忽略本邮件。</p>`,
+		html.EscapeString(user.Nickname), int(ttl.Hours()), link, link,
+	)
+	if err := mailer.Send(user.Email, "激活账号", body); err != nil {
+		log.Printf("用户 %d 发送验证邮件失败: %v", user.Id, err)
+	}
+}
+
+// 访问地址，用于生成邮件中的链接
+func appUrl() string {
+	return strings.TrimRight(variable.Config.Section(ini.DefaultSection).Key("APP_URL").MustString("http://localhost:8080"), "/")
+}
+
+// 发送重置密码邮件
+func sendPasswordResetMail(user model.User, token string, ttl time.Duration) {
+	link := fmt.Sprintf("%s/set-password?token=%s", appUrl(), url.QueryEscape(token))
+	body := fmt.Sprintf(
+		`<p>%s，您好：</p><p>我们收到了重置您账号密码的请求，请在 %d 分钟内点击下面的链接设置新密码：</p><p><a href="%s">%s</a></p><p>如果这不是您本人的操作，请忽略本邮件，您的密码不会被修改。</p>`,
+		html.EscapeString(user.Nickname), int(ttl.Minutes()), link, link,
+	)
+	if err := mailer.Send(user.Email, "重置密码", body); err != nil {
+		log.Printf("用户 %d 发送重置密码邮件失败: %v", user.Id, err)
+	}
+}
+
 func (p *PublicController) Test(c *gin.Context) {
 	ConsulRegister() // 注册服务到consul
 	// ConsulDeRegister() // 取消consul注册的服务
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-chats/app/model"
+	"go-chats/app/utils/filer"
+	"go-chats/app/utils/storage"
+	"io"
+	"log"
+	"math"
+	mimetype "mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+/**
+ * 公开文件 /storage/ 的访问入口和存储用量，文件可能在本地磁盘或对象存储中
+ * 对象存储时跳转到预签名地址，本地磁盘或关闭跳转时由应用读取后返回
+ */
+type StorageController struct {
+	BaseController
+}
+
+// 公开文件
+func (s *StorageController) Show(c *gin.Context) {
+	key := strings.TrimPrefix(path.Clean("/"+c.Param("path")), "/")
+	if key == "" {
+		c.String(http.StatusNotFound, "404 page not found")
+		return
+	}
+	serveObject(c, storage.Public, key, "", "", "public, max-age=86400")
+}
+
+// 当前用户和其创建的群的存储用量，用于设置页显示
+func (s *StorageController) Usage(c *gin.Context) {
+	user := s.AuthUser(c)
+	usage, err := model.GetStorageUsage(model.StorageOwnerUser, user.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询存储空间失败"})
+		return
+	}
+
+	groups := make([]model.Group, 0)
+	if err := model.DB.Where("owner_id = ?", user.Id).Order("id ASC").Find(&groups).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询存储空间失败"})
+		return
+	}
+	groupUsages := make([]gin.H, 0, len(groups))
+	for _, group := range groups {
+		groupUsage, err := model.GetStorageUsage(model.StorageOwnerGroup, group.Id)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询存储空间失败"})
+			return
+		}
+		data := usageData(groupUsage)
+		data["group_id"], data["name"] = group.Id, group.Name
+		groupUsages = append(groupUsages, data)
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": gin.H{"user": usageData(usage), "groups": groupUsages}})
+}
+
+// 存储用量的显示数据，quota 为 0 表示不限制
+func usageData(usage *model.StorageUsage) gin.H {
+	quota := usage.Quota()
+	data := gin.H{
+		"bytes":      usage.Bytes,
+		"files":      usage.Files,
+		"quota":      quota,
+		"bytes_text": filer.FormatBytes(usage.Bytes),
+		"quota_text": "不限",
+		"percent":    0,
+	}
+	if quota > 0 {
+		data["quota_text"] = filer.FormatBytes(quota)
+		data["percent"] = math.Min(100, math.Round(float64(usage.Bytes)*1000/float64(quota))/10)
+	}
+	return data
+}
+
+/**
+ * 返回存储中的文件，支持预签名地址时跳转，否则读取后返回，本地文件支持 Range 分段下载
+ * @param string mime 为空时按扩展名识别
+ * @param string disposition 为空时不设置 Content-Disposition
+ */
+func serveObject(c *gin.Context, d storage.Driver, key, mime, disposition, cacheControl string) {
+	u, err := storage.RedirectURL(d, key, mime, disposition)
+	if err != nil {
+		log.Printf("生成文件 %s 的下载地址失败: %v", key, err)
+		c.String(http.StatusBadGateway, "502 bad gateway")
+		return
+	}
+	if u != "" {
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(http.StatusFound, u)
+		return
+	}
+
+	object, err := d.Stat(key)
+	if err == nil {
+		var r io.ReadCloser
+		if r, err = d.Get(key); err == nil {
+			defer r.Close()
+			if mime != "" {
+				c.Header("Content-Type", mime)
+			}
+			if disposition != "" {
+				c.Header("Content-Disposition", disposition)
+			}
+			c.Header("X-Content-Type-Options", "nosniff")
+			c.Header("Cache-Control", cacheControl)
+			if rs, ok := r.(io.ReadSeeker); ok {
+				http.ServeContent(c.Writer, c.Request, path.Base(key), object.ModTime, rs)
+				return
+			}
+			if mime == "" {
+				mime = mimetype.TypeByExtension(path.Ext(key))
+			}
+			if mime == "" {
+				mime = "application/octet-stream"
+			}
+			c.DataFromReader(http.StatusOK, object.Size, mime, r, nil)
+			return
+		}
+	}
+	if err == storage.ErrNotExist {
+		c.String(http.StatusNotFound, "404 page not found")
+		return
+	}
+	log.Printf("读取文件 %s 失败: %v", key, err)
+	c.String(http.StatusBadGateway, "502 bad gateway")
+}
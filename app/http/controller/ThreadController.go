@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-chats/app/model"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+)
+
+// 群聊话题
+type ThreadController struct {
+	BaseController
+}
+
+// 我关注的话题，包含根消息、最后一条回复和未读数
+func (t *ThreadController) Index(c *gin.Context) {
+	user := t.AuthUser(c)
+	threads, err := model.FollowedThreads(user.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询话题失败"})
+		return
+	}
+
+	ids := make([]int, 0, len(threads))
+	rootIds := make([]int, 0, len(threads))
+	for _, thread := range threads {
+		ids = append(ids, thread.Id)
+		rootIds = append(rootIds, thread.RootMessageId)
+	}
+	unread, err := model.UnreadCounts(user.Id, ids)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询未读数失败"})
+		return
+	}
+	summaries, err := model.ThreadSummaries(rootIds)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询话题失败"})
+		return
+	}
+	roots := make([]model.Message, 0, len(rootIds))
+	if len(rootIds) > 0 {
+		model.DB.Where("id IN ?", rootIds).Find(&roots)
+	}
+	rootMap := make(map[int]model.Message, len(roots))
+	for _, root := range roots {
+		rootMap[root.Id] = root
+	}
+
+	data := make([]gin.H, 0, len(threads))
+	for _, thread := range threads {
+		var replyCount int64
+		if summary := summaries[thread.RootMessageId]; summary != nil {
+			replyCount = summary.ReplyCount
+		}
+		data = append(data, gin.H{
+			"conversation_id": thread.Id,
+			"group_id":        thread.GroupId,
+			"root_message":    rootMap[thread.RootMessageId],
+			"last_message":    thread.LastMessage,
+			"reply_count":     replyCount,
+			"unread":          unread[thread.Id],
+			"updated_at":      thread.UpdatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": data})
+}
+
+// 话题概况：回复数、未读数和自己的关注状态，:id 为根消息ID
+func (t *ThreadController) Show(c *gin.Context) {
+	user := t.AuthUser(c)
+	root, ok := t.loadRoot(c, user.Id)
+	if !ok {
+		return
+	}
+
+	data := gin.H{"root_message_id": root.Id, "conversation_id": 0, "reply_count": 0, "unread": 0, "following": false}
+	conv, err := model.FindThreadConversation(root.Id)
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询话题失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": data})
+		return
+	}
+
+	summaries, err := model.ThreadSummaries([]int{root.Id})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询话题失败"})
+		return
+	}
+	unread, err := model.UnreadCounts(user.Id, []int{conv.Id})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询未读数失败"})
+		return
+	}
+
+	data["conversation_id"] = conv.Id
+	if summary := summaries[root.Id]; summary != nil {
+		data["reply_count"] = summary.ReplyCount
+	}
+	data["unread"] = unread[conv.Id]
+	if follower := model.FindThreadFollower(conv.Id, user.Id); follower != nil {
+		data["following"] = !follower.Muted
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": data})
+}
+
+// 关注话题，关注后收到话题中新消息的推送
+func (t *ThreadController) Follow(c *gin.Context) {
+	t.follow(c, false)
+}
+
+// 取消关注话题，不再收到推送，但仍可查看话题
+func (t *ThreadController) Unfollow(c *gin.Context) {
+	t.follow(c, true)
+}
+
+func (t *ThreadController) follow(c *gin.Context, muted bool) {
+	user := t.AuthUser(c)
+	root, ok := t.loadRoot(c, user.Id)
+	if !ok {
+		return
+	}
+
+	conv, err := model.ThreadConversation(root.GroupId, root.Id)
+	if err != nil {
+		if err == model.ErrInvalidThread {
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该消息不能开启话题"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "操作失败，请稍后再试"})
+		return
+	}
+	if err := model.FollowThread(conv.Id, user.Id, muted, true); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "操作失败，请稍后再试"})
+		return
+	}
+
+	message := "已关注话题"
+	if muted {
+		message = "已取消关注话题"
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": message, "data": gin.H{"conversation_id": conv.Id}})
+}
+
+// 加载话题的根消息并校验当前用户是否为群成员，失败时已写回响应
+func (t *ThreadController) loadRoot(c *gin.Context, userId int) (*model.Message, bool) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	root := &model.Message{}
+	if err := model.DB.First(root, id).Error; err != nil || root.GroupId == 0 || root.ThreadId > 0 {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "该话题不存在"})
+		return nil, false
+	}
+	if !model.IsGroupMember(root.GroupId, userId) {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "你不是该群成员"})
+		return nil, false
+	}
+	return root, true
+}
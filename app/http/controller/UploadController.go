@@ -0,0 +1,269 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-ini/ini"
+	"go-chats/app/global/variable"
+	"go-chats/app/hub"
+	"go-chats/app/model"
+	"go-chats/app/utils/filer"
+	"go-chats/app/utils/storage"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var md5Pattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+/**
+ * 大文件分片上传：创建上传任务 → 按序号 PUT 分片 → 完成上传
+ * 断线后可查询已收到的分片只补传缺少的部分，合并后按客户端声明的 MD5 校验整个文件
+ * 合并、校验和保存在后台进行，结果通过 upload_event 推送，也可以查询上传任务得到
+ */
+type UploadController struct {
+	BaseController
+}
+
+/**
+ * 创建上传任务，参数 name、size（字节）、md5 和可选的 group_id，返回分片大小和分片数
+ * 声明的大小在任务完成前预留在上传人的存储配额中，未完成的任务数有上限
+ */
+func (u *UploadController) Create(c *gin.Context) {
+	user := u.AuthUser(c)
+	name := strings.TrimSpace(c.DefaultPostForm("name", ""))
+	size, _ := strconv.ParseInt(c.DefaultPostForm("size", "0"), 10, 64)
+	checksum := strings.ToLower(c.DefaultPostForm("md5", ""))
+	if name == "" || size <= 0 {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "文件名和大小不能为空"})
+		return
+	}
+	if !md5Pattern.MatchString(checksum) {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "文件 MD5 格式不正确"})
+		return
+	}
+	if maxSize := uploadMaxSize(); size > maxSize {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "文件大小不能超过 " + filer.FormatBytes(maxSize)})
+		return
+	}
+
+	if failure := quotaFailure(user.Id, attachmentOptionsOf(c).groupId, size); failure != nil {
+		c.JSON(http.StatusOK, failure)
+		return
+	}
+
+	chunkSize := uploadChunkSize()
+	upload := &model.Upload{
+		UploaderId:  user.Id,
+		Name:        attachmentName(name),
+		Size:        size,
+		Md5:         checksum,
+		ChunkSize:   chunkSize,
+		TotalChunks: int((size + chunkSize - 1) / chunkSize),
+		Status:      model.UploadUploading,
+	}
+	if err := model.CreateUpload(upload); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": uploadErrorText(err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "创建成功", "data": gin.H{"upload": upload, "received": []int{}}})
+}
+
+// 上传任务详情和已收到的分片序号，断线重连后据此补传；处理完成后附带保存的附件
+func (u *UploadController) Show(c *gin.Context) {
+	upload, ok := u.load(c)
+	if !ok {
+		return
+	}
+	received, err := model.ReceivedChunks(upload.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询分片失败"})
+		return
+	}
+	data := gin.H{"upload": upload, "received": received}
+	if upload.Status == model.UploadCompleted {
+		attachment := &model.Attachment{}
+		if err := model.DB.First(attachment, upload.AttachmentId).Error; err == nil {
+			data["attachment"] = attachment
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "获取成功", "data": data})
+}
+
+// 上传一个分片，请求体为分片的原始内容，Content-Length 必须与分片大小一致；重复上传时覆盖
+func (u *UploadController) Chunk(c *gin.Context) {
+	upload, ok := u.uploading(c)
+	if !ok {
+		return
+	}
+	number, err := strconv.Atoi(c.Param("number"))
+	expected := upload.ChunkLength(number)
+	if err != nil || expected == 0 {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "分片序号不正确"})
+		return
+	}
+	if c.Request.ContentLength != expected {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "分片大小应为 " + strconv.FormatInt(expected, 10) + " 字节"})
+		return
+	}
+
+	size, err := storage.PutChunk(upload.Id, number, io.LimitReader(c.Request.Body, expected))
+	if err != nil || size != expected {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "分片上传失败，请重试"})
+		return
+	}
+	if err := model.SaveChunk(upload, number, size); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "分片上传失败，请重试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "上传成功", "data": gin.H{"number": number, "size": size}})
+}
+
+// 完成上传：分片齐全后开始在后台合并、校验 MD5 和文件类型并保存为附件，立即返回处理中的上传任务
+func (u *UploadController) Complete(c *gin.Context) {
+	upload, ok := u.uploading(c)
+	if !ok {
+		return
+	}
+	received, err := model.ReceivedChunks(upload.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "查询分片失败"})
+		return
+	}
+	if len(received) != upload.TotalChunks {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "还有分片未上传", "data": gin.H{"received": received}})
+		return
+	}
+	if err := model.StartUpload(upload); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": uploadErrorText(err)})
+		return
+	}
+
+	go finalizeUpload(upload, attachmentOptionsOf(c))
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "正在处理", "data": gin.H{"upload": upload}})
+}
+
+// 取消上传，删除已收到的分片；已处理完的任务删除后不影响保存的附件
+func (u *UploadController) Destroy(c *gin.Context) {
+	upload, ok := u.load(c)
+	if !ok {
+		return
+	}
+	if upload.Status == model.UploadProcessing {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": uploadErrorText(model.ErrUploadProcessing)})
+		return
+	}
+	if err := model.DeleteUpload(upload); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "取消失败，请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "message": "已取消上传"})
+}
+
+// 加载路由中当前用户的上传任务，失败时已写回响应
+func (u *UploadController) load(c *gin.Context) (*model.Upload, bool) {
+	user := u.AuthUser(c)
+	id, _ := strconv.Atoi(c.Param("id"))
+	upload, err := model.FindUpload(id, user.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "上传任务不存在或已过期"})
+		return nil, false
+	}
+	return upload, true
+}
+
+// 加载仍在接收分片的上传任务，已开始处理或处理完的任务不能再上传分片或重复完成
+func (u *UploadController) uploading(c *gin.Context) (*model.Upload, bool) {
+	upload, ok := u.load(c)
+	if !ok {
+		return nil, false
+	}
+	if upload.Status != model.UploadUploading {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": uploadErrorText(model.ErrUploadProcessing)})
+		return nil, false
+	}
+	return upload, true
+}
+
+/**
+ * 在后台合并分片、校验 MD5 和文件类型并保存为附件，记录结果后通知上传人
+ * 大文件的合并和校验可能远超 HTTP 写超时，因此不在请求内完成
+ */
+func finalizeUpload(upload *model.Upload, opts attachmentOptions) {
+	attachment, message := mergeUpload(upload, opts)
+	attachmentId := 0
+	if attachment != nil {
+		attachmentId = attachment.Id
+	}
+	if err := model.FinishUpload(upload, attachmentId, message); err != nil {
+		log.Printf("记录上传 %d 的处理结果失败: %v", upload.Id, err)
+	}
+	hub.Default.UploadFinished(upload, attachment)
+}
+
+// 合并并保存上传的文件，失败时返回给用户的原因
+func mergeUpload(upload *model.Upload, opts attachmentOptions) (*model.Attachment, string) {
+	tmpPath, err := storage.MergeChunks(upload.Id, upload.TotalChunks)
+	if err != nil {
+		log.Printf("合并上传 %d 的分片失败: %v", upload.Id, err)
+		return nil, "合并文件失败，请重新上传"
+	}
+	checksum, err := filer.Md5(tmpPath)
+	if err != nil || checksum != upload.Md5 {
+		_ = os.Remove(tmpPath)
+		return nil, "文件校验失败，请重新上传"
+	}
+	mime, err := detectMime(tmpPath)
+	if err != nil || !allowedMime(mime) {
+		_ = os.Remove(tmpPath)
+		return nil, "不支持的文件类型"
+	}
+	opts.upload = upload
+	attachment, failure := storeAttachment(upload.UploaderId, upload.Name, tmpPath, checksum, upload.Size, mime, opts)
+	if failure != nil {
+		message, _ := failure["message"].(string)
+		return nil, message
+	}
+	return attachment, ""
+}
+
+// 上传任务相关错误的提示文字
+func uploadErrorText(err error) string {
+	switch err {
+	case model.ErrUploadProcessing:
+		return "文件正在处理或已处理完成"
+	case model.ErrTooManyUploads:
+		return "未完成的上传不能超过 " + strconv.Itoa(model.MaxOpenUploads) + " 个，请先完成或取消之前的上传"
+	case model.ErrQuotaExceeded:
+		return "存储空间不足，未完成的上传也会预留空间"
+	}
+	return "操作失败，请稍后再试"
+}
+
+// 按文件开头的内容识别文件类型
+func detectMime(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return contentType(head[:n]), nil
+}
+
+// 分片上传的文件大小上限（字节）
+func uploadMaxSize() int64 {
+	return variable.Config.Section(ini.DefaultSection).Key("UPLOAD_MAX_SIZE").MustInt64(1024) << 20
+}
+
+// 分片大小（字节），需保证单个分片能在 HTTP 读取超时内传完
+func uploadChunkSize() int64 {
+	return variable.Config.Section(ini.DefaultSection).Key("UPLOAD_CHUNK_SIZE").MustInt64(2) << 20
+}
@@ -1,19 +1,75 @@
 package middleware
 
 import (
-	"fmt"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"go-chats/app/global/variable"
+	"go-chats/app/model"
+	"gorm.io/gorm"
+	"log"
 	"net/http"
-	"time"
 )
 
+// Session配置，由 bootstrap 写入，删除Cookie时需要使用相同的 Path 和 Domain
+var SessionOptions = sessions.Options{Path: "/"}
+
+// 清空并删除当前Session，使用服务端存储时会同时删除服务端的Session数据
+func DestroySession(c *gin.Context) {
+	session := sessions.Default(c)
+	session.Clear()
+	options := SessionOptions
+	options.MaxAge = -1
+	session.Options(options)
+	_ = session.Save()
+}
+
+// 接口和 WebSocket 的登录校验，未登录或登录态失效时返回 401
 func Auth() gin.HandlerFunc {
+	return authenticate(false)
+}
+
+// 页面的登录校验，未登录或登录态失效时跳转到登录页
+func AuthPage() gin.HandlerFunc {
+	return authenticate(true)
+}
+
+func authenticate(page bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		user := sessions.Default(c).Get("user")
-		fmt.Println(user)
-		if user == nil {
-			c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("login?rand=%d", time.Now().UnixNano()))
+		session := sessions.Default(c)
+		user, ok := session.Get("user").(variable.UserSessionData)
+		if !ok {
+			abortAuth(c, page, http.StatusUnauthorized, "请先登录")
+			return
 		}
+
+		// 账号被禁用或修改过密码后，之前登录的Session全部失效
+		current := model.User{}
+		err := model.DB.Select([]string{"id", "activate", "session_version"}).First(&current, user.Id).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			// 无法确认登录态时拒绝请求，不放行
+			log.Printf("校验用户 %d 登录态失败: %v", user.Id, err)
+			abortAuth(c, page, http.StatusServiceUnavailable, "服务暂时不可用，请稍后再试")
+			return
+		}
+		if err != nil || current.Activate != model.UserActive || current.SessionVersion != user.SessionVersion {
+			DestroySession(c)
+			abortAuth(c, page, http.StatusUnauthorized, "登录已失效，请重新登录")
+			return
+		}
+
+		c.Set("user", user)
+	}
+}
+
+/**
+ * 中止请求：页面未登录时临时跳转到登录页，其余情况按 {code, message} 返回 JSON
+ * 跳转不能用 301，浏览器会缓存，登录后再访问仍会被跳走
+ */
+func abortAuth(c *gin.Context, page bool, status int, message string) {
+	if page && status == http.StatusUnauthorized {
+		c.Redirect(http.StatusFound, "/login")
+		c.Abort()
+		return
 	}
+	c.AbortWithStatusJSON(status, gin.H{"code": 0, "message": message})
 }
@@ -0,0 +1,78 @@
+package hub
+
+import (
+	"go-chats/app/model"
+	"time"
+)
+
+// 一条消息最多附带的附件数
+const maxAttachments = 9
+
+/**
+ * 校验消息内容类型：文本消息不能带附件，图片、文件消息至少带一个附件，语音消息只带一个语音文件，文字作为说明可以为空
+ * @return bool 是否合法，不合法时已提示发送人
+ */
+func validContent(c *Client, msg *Message) bool {
+	if msg.ContentType == "" {
+		msg.ContentType = model.ContentText
+		if len(msg.AttachmentIds) > 0 {
+			msg.ContentType = model.ContentFile
+		}
+	}
+
+	content := ""
+	switch msg.ContentType {
+	case model.ContentText:
+		if len(msg.AttachmentIds) > 0 {
+			content = "文本消息不能附带附件"
+		}
+	case model.ContentImage, model.ContentFile:
+		if len(msg.AttachmentIds) == 0 {
+			content = "请先上传附件"
+		} else if len(msg.AttachmentIds) > maxAttachments {
+			content = "一条消息最多附带9个附件"
+		}
+	case model.ContentVoice:
+		if len(msg.AttachmentIds) != 1 {
+			content = "语音消息只能附带一个语音文件"
+		}
+	default:
+		content = "不支持的消息内容类型"
+	}
+	if content != "" {
+		c.hub.SendToClient(c, &Message{Type: TypeError, ClientId: msg.ClientId, Content: content, Time: time.Now().Unix()})
+		return false
+	}
+	return true
+}
+
+// 图片附件处理完成事件，Data 为附件（含宽高、BlurHash 和缩略图尺寸）
+const MessageAttachmentProcessed = "attachment_processed"
+
+/**
+ * 图片附件的缩略图生成后通知会话成员，附件还没随消息发出时不通知，发送时已带上处理结果
+ * 在图片处理协程中调用，处理期间附件可能已随消息发出，重新读取一次
+ */
+func (h *Hub) AttachmentProcessed(processed *model.Attachment) {
+	a := &model.Attachment{}
+	if err := model.DB.First(a, processed.Id).Error; err != nil || a.MessageId == 0 {
+		return
+	}
+	msg := &model.Message{}
+	if err := model.DB.First(msg, a.MessageId).Error; err != nil || msg.RecalledAt != nil {
+		return
+	}
+	h.sendMessageEvent(msg, &Message{Event: MessageAttachmentProcessed, Data: a})
+}
+
+/**
+ * 分片上传在后台处理完后通知上传人的所有连接
+ * 成功时 Data 为附件，失败时 Content 为失败原因
+ */
+func (h *Hub) UploadFinished(upload *model.Upload, attachment *model.Attachment) {
+	event := &Message{Type: TypeUploadEvent, Id: upload.Id, Event: upload.Status, Content: upload.Error, Time: time.Now().Unix()}
+	if attachment != nil {
+		event.Data = attachment
+	}
+	h.SendToUser(upload.UploaderId, event)
+}
@@ -0,0 +1,128 @@
+package hub
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"go-chats/app/global/variable"
+	"go-chats/app/model"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	writeWait      = 10 * time.Second             // 写超时
+	pongWait       = 60 * time.Second             // 等待客户端 pong 的超时
+	pingPeriod     = (pongWait * 9) / 10          // 发送 ping 的周期，必须小于 pongWait
+	maxMessageSize = 6*model.MaxBodyLength + 4096 // 单条消息最大字节数，内容按 JSON 转义最多变为 6 倍（\u001f），另留 4KB 给其他字段
+	sendQueueSize  = 256                          // 每个连接的发送队列长度，超出视为慢消费者
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// 一个 WebSocket 连接，同一用户在多个标签页或设备登录时会有多个连接
+type Client struct {
+	hub      *Hub
+	conn     *websocket.Conn
+	send     chan []byte
+	status   string               // 该连接的在线状态，由 hub.mu 保护
+	typingAt map[string]time.Time // 各会话最近一次转发正在输入事件的时间，只在读协程中访问
+	User     variable.UserSessionData
+}
+
+// 升级 HTTP 请求为 WebSocket 连接并绑定到当前登录用户
+func ServeWs(h *Hub, w http.ResponseWriter, r *http.Request, user variable.UserSessionData) error {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+
+	c := &Client{
+		hub:      h,
+		conn:     conn,
+		send:     make(chan []byte, sendQueueSize),
+		typingAt: make(map[string]time.Time),
+		User:     user,
+	}
+
+	select {
+	case h.register <- c:
+	case <-h.quit:
+		_ = conn.Close()
+		return nil
+	}
+
+	go c.writePump()
+	go c.readPump()
+	return nil
+}
+
+// 读协程：读取客户端发来的消息并分发，连接出错或关闭时注销
+func (c *Client) readPump() {
+	defer func() {
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.quit:
+		}
+		_ = c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		messageType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("websocket: 用户 %d 连接异常断开: %v", c.User.Id, err)
+			}
+			return
+		}
+		if messageType != websocket.TextMessage {
+			continue
+		}
+
+		msg := &Message{}
+		if err := json.Unmarshal(data, msg); err != nil {
+			c.hub.SendToClient(c, &Message{Type: TypeError, Content: "消息格式不正确", Time: time.Now().Unix()})
+			continue
+		}
+		c.hub.dispatch(c, msg)
+	}
+}
+
+// 写协程：把发送队列中的消息写到客户端，并定时发送 ping 保活
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		_ = c.conn.Close()
+	}()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// 发送队列被消息中心关闭
+				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,467 @@
+package hub
+
+import (
+	"encoding/json"
+	"go-chats/app/model"
+	"log"
+	"sync"
+	"time"
+)
+
+// 消息类型
+const (
+	TypeMessage      = "message"       // 一对一聊天消息
+	TypeGroupMessage = "group_message" // 群聊消息
+	TypeGroupEvent   = "group_event"   // 群成员变动、解散等通知，具体事件见 Event
+	TypeFriendEvent  = "friend_event"  // 好友申请、通过、删除等通知，具体事件见 Event
+	TypePresence     = "presence"      // 在线状态：客户端上报当前连接的状态，服务端向好友推送状态变化
+	TypeTyping       = "typing"        // 正在输入，只转发不持久化
+	TypeDelivered    = "delivered"     // 客户端上报已收到消息
+	TypeRead         = "read"          // 客户端上报已读位置
+	TypeReceipt      = "receipt"       // 送达、已读回执，具体事件见 Event
+	TypeSync         = "sync"          // 断线重连后补发错过的消息
+	TypeEdit         = "edit"          // 编辑消息
+	TypeRecall       = "recall"        // 撤回消息
+	TypeReaction     = "reaction"      // 添加、取消表情回应
+	TypeListened     = "listened"      // 客户端上报已播放语音消息
+	TypeMessageEvent = "message_event" // 消息被编辑、撤回、删除、回应、收听的通知，具体事件见 Event
+	TypeUploadEvent  = "upload_event"  // 分片上传在后台处理完成或失败的通知，Event 为 completed 或 failed
+	TypeError        = "error"         // 错误提示
+)
+
+// 回执事件
+const (
+	ReceiptDelivered = "delivered"
+	ReceiptRead      = "read"
+)
+
+// 客户端与服务端之间传输的数据帧
+type Message struct {
+	Type           string             `json:"type"`
+	Id             int                `json:"id,omitempty"`              // 消息ID，持久化后由服务端填充
+	ConversationId int                `json:"conversation_id,omitempty"` // 会话ID，持久化后由服务端填充
+	From           int                `json:"from"`
+	To             int                `json:"to"`
+	GroupId        int                `json:"group_id,omitempty"` // 群聊消息、群通知的群ID
+	ContentType    string             `json:"content_type,omitempty"`
+	Content        string             `json:"content"`
+	Event          string             `json:"event,omitempty"`          // 通知类消息的事件名
+	Data           interface{}        `json:"data,omitempty"`           // 通知类消息携带的数据
+	ClientId       string             `json:"client_id,omitempty"`      // 客户端生成的消息ID，重试时保持不变，服务端据此去重
+	ReplyToId      int                `json:"reply_to_id,omitempty"`    // 引用回复的消息ID
+	ThreadId       int                `json:"thread_id,omitempty"`      // 群聊话题的根消息ID
+	AttachmentIds  []int              `json:"attachment_ids,omitempty"` // 发送图片、文件消息时附带的已上传附件ID
+	Attachments    []model.Attachment `json:"attachments,omitempty"`
+	Time           int64              `json:"time"`
+}
+
+// 消息处理函数，在发送方连接的读协程中执行
+type HandlerFunc func(c *Client, msg *Message)
+
+// 待投递的数据，client 不为空时只投递到该连接，否则投递到 userId 的所有连接
+type delivery struct {
+	userId int
+	client *Client
+	data   []byte
+}
+
+// 消息中心，负责维护在线连接并在用户之间转发消息
+type Hub struct {
+	mu         sync.RWMutex
+	clients    map[int]map[*Client]bool // 在线连接，用户ID => 该用户的所有连接
+	handlers   map[string]HandlerFunc   // 消息类型 => 处理函数
+	register   chan *Client
+	unregister chan *Client
+	kick       chan int
+	deliver    chan *delivery
+	presence   *presenceQueue
+	quit       chan struct{}
+}
+
+// 全局消息中心，由 bootstrap 初始化
+var Default *Hub
+
+func NewHub() *Hub {
+	h := &Hub{
+		clients:    make(map[int]map[*Client]bool),
+		handlers:   make(map[string]HandlerFunc),
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		kick:       make(chan int),
+		deliver:    make(chan *delivery, 1024),
+		presence:   newPresenceQueue(),
+		quit:       make(chan struct{}),
+	}
+	h.Handle(TypeMessage, handleMessage)
+	h.Handle(TypeGroupMessage, handleGroupMessage)
+	h.Handle(TypePresence, handlePresence)
+	h.Handle(TypeTyping, handleTyping)
+	h.Handle(TypeDelivered, handleDelivered)
+	h.Handle(TypeRead, handleRead)
+	h.Handle(TypeSync, handleSync)
+	h.Handle(TypeEdit, handleEdit)
+	h.Handle(TypeRecall, handleRecall)
+	h.Handle(TypeReaction, handleReaction)
+	h.Handle(TypeListened, handleListened)
+	return h
+}
+
+// 注册某种消息类型的处理函数，同类型重复注册时覆盖
+func (h *Hub) Handle(msgType string, fn HandlerFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handlers[msgType] = fn
+}
+
+// 消息中心主循环，连接的增删与消息投递都在这里串行完成
+func (h *Hub) Run() {
+	go h.runPresence()
+	for {
+		select {
+		case c := <-h.register:
+			h.mu.Lock()
+			if h.clients[c.User.Id] == nil {
+				h.clients[c.User.Id] = make(map[*Client]bool)
+			}
+			c.status = StatusOnline
+			h.clients[c.User.Id][c] = true
+			h.mu.Unlock()
+			h.presence.mark(c.User.Id)
+
+		case c := <-h.unregister:
+			h.remove(c)
+
+		case userId := <-h.kick:
+			h.mu.RLock()
+			targets := make([]*Client, 0, len(h.clients[userId]))
+			for c := range h.clients[userId] {
+				targets = append(targets, c)
+			}
+			h.mu.RUnlock()
+			for _, c := range targets {
+				h.remove(c)
+			}
+
+		case d := <-h.deliver:
+			if d.client != nil {
+				// 投递入队后连接可能已被注销、踢下线，发送队列已关闭，不能再写入
+				h.mu.RLock()
+				registered := h.clients[d.client.User.Id][d.client]
+				h.mu.RUnlock()
+				if registered {
+					h.push(d.client, d.data)
+				}
+				continue
+			}
+			h.mu.RLock()
+			targets := make([]*Client, 0, len(h.clients[d.userId]))
+			for c := range h.clients[d.userId] {
+				targets = append(targets, c)
+			}
+			h.mu.RUnlock()
+			for _, c := range targets {
+				h.push(c, d.data)
+			}
+
+		case <-h.quit:
+			h.mu.Lock()
+			for _, conns := range h.clients {
+				for c := range conns {
+					close(c.send)
+				}
+			}
+			h.clients = make(map[int]map[*Client]bool)
+			h.mu.Unlock()
+			return
+		}
+	}
+}
+
+// 关闭消息中心并断开所有连接
+func (h *Hub) Close() {
+	close(h.quit)
+}
+
+// 断开用户的所有连接，用于修改密码、禁用账号等需要让登录态失效的场景
+func (h *Hub) Kick(userId int) {
+	select {
+	case h.kick <- userId:
+	case <-h.quit:
+	}
+}
+
+// 把数据放入连接的发送队列，队列已满说明客户端消费过慢，直接踢下线，避免拖慢整个消息中心
+func (h *Hub) push(c *Client, data []byte) {
+	select {
+	case c.send <- data:
+	default:
+		log.Printf("websocket: 用户 %d 的发送队列已满，断开连接", c.User.Id)
+		h.remove(c)
+	}
+}
+
+// 移除连接并关闭其发送队列，写协程收到关闭信号后会断开连接
+func (h *Hub) remove(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	conns, ok := h.clients[c.User.Id]
+	if !ok || !conns[c] {
+		return
+	}
+	delete(conns, c)
+	if len(conns) == 0 {
+		delete(h.clients, c.User.Id)
+	}
+	close(c.send)
+	h.presence.mark(c.User.Id)
+}
+
+// 判断用户是否在线
+func (h *Hub) IsOnline(userId int) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[userId]) > 0
+}
+
+// 推送消息到用户的所有在线连接
+func (h *Hub) SendToUser(userId int, msg *Message) {
+	data, err := encode(msg)
+	if err != nil {
+		return
+	}
+	h.enqueue(&delivery{userId: userId, data: data})
+}
+
+// 推送消息到多个用户的所有在线连接，消息只编码一次
+func (h *Hub) SendToUsers(userIds []int, msg *Message) {
+	data, err := encode(msg)
+	if err != nil {
+		return
+	}
+	for _, userId := range userIds {
+		h.enqueue(&delivery{userId: userId, data: data})
+	}
+}
+
+// 推送消息到指定连接
+func (h *Hub) SendToClient(c *Client, msg *Message) {
+	data, err := encode(msg)
+	if err != nil {
+		return
+	}
+	h.enqueue(&delivery{client: c, data: data})
+}
+
+func (h *Hub) enqueue(d *delivery) {
+	select {
+	case h.deliver <- d:
+	case <-h.quit:
+	}
+}
+
+// 按消息类型分发到对应的处理函数
+func (h *Hub) dispatch(c *Client, msg *Message) {
+	h.mu.RLock()
+	fn, ok := h.handlers[msg.Type]
+	h.mu.RUnlock()
+	if !ok {
+		h.SendToClient(c, &Message{Type: TypeError, Content: "不支持的消息类型", Time: time.Now().Unix()})
+		return
+	}
+	fn(c, msg)
+}
+
+func encode(msg *Message) ([]byte, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("websocket: 消息编码失败: %v", err)
+		return nil, err
+	}
+	return data, nil
+}
+
+// 一对一聊天消息：先持久化再转发给接收方，同时回送给发送方的所有连接作为确认并同步到其他设备
+func handleMessage(c *Client, msg *Message) {
+	if msg.To <= 0 || (msg.Content == "" && len(msg.AttachmentIds) == 0) {
+		c.hub.SendToClient(c, &Message{Type: TypeError, Content: "消息接收人和内容不能为空", Time: time.Now().Unix()})
+		return
+	}
+
+	if acknowledged(c, msg) {
+		return
+	}
+
+	if err := model.DB.Select("id").First(&model.User{}, msg.To).Error; err != nil {
+		c.hub.SendToClient(c, &Message{Type: TypeError, Content: "消息接收人不存在", Time: time.Now().Unix()})
+		return
+	}
+
+	switch err := model.CanContact(c.User.Id, msg.To); err {
+	case model.ErrBlockingPeer:
+		c.hub.SendToClient(c, &Message{Type: TypeError, To: msg.To, Content: "你已将对方加入黑名单，请先移出黑名单", Time: time.Now().Unix()})
+		return
+	case model.ErrBlockedByPeer:
+		c.hub.SendToClient(c, &Message{Type: TypeError, To: msg.To, Content: "消息已被对方拒收", Time: time.Now().Unix()})
+		return
+	case nil:
+	default:
+		log.Printf("websocket: 用户 %d 校验能否给 %d 发消息失败: %v", c.User.Id, msg.To, err)
+		c.hub.SendToClient(c, &Message{Type: TypeError, ClientId: msg.ClientId, Content: "消息发送失败，请稍后再试", Time: time.Now().Unix()})
+		return
+	}
+
+	if !validContent(c, msg) {
+		return
+	}
+
+	saved, err := model.CreateDirectMessage(&model.Message{
+		SenderId:      c.User.Id,
+		RecipientId:   msg.To,
+		Body:          msg.Content,
+		ContentType:   msg.ContentType,
+		ClientId:      model.NullableString(msg.ClientId),
+		ReplyToId:     msg.ReplyToId,
+		AttachmentIds: msg.AttachmentIds,
+	})
+	if err != nil {
+		sendSaveError(c, msg, err)
+		return
+	}
+
+	frame := messageFrame(saved)
+	c.hub.SendToUser(saved.RecipientId, frame)
+	if saved.RecipientId != saved.SenderId {
+		c.hub.SendToUser(saved.SenderId, frame)
+	}
+}
+
+// 群聊消息：校验发送人是否为群成员，持久化后扇出给所有成员（包括发送人的其他设备），拉黑了发送人的成员收不到
+func handleGroupMessage(c *Client, msg *Message) {
+	if msg.GroupId <= 0 || (msg.Content == "" && len(msg.AttachmentIds) == 0) {
+		c.hub.SendToClient(c, &Message{Type: TypeError, Content: "群ID和消息内容不能为空", Time: time.Now().Unix()})
+		return
+	}
+
+	if acknowledged(c, msg) {
+		return
+	}
+
+	if !model.IsGroupMember(msg.GroupId, c.User.Id) {
+		c.hub.SendToClient(c, &Message{Type: TypeError, GroupId: msg.GroupId, Content: "你不是该群成员", Time: time.Now().Unix()})
+		return
+	}
+
+	if !validContent(c, msg) {
+		return
+	}
+
+	parsed, ok := mentionsOf(c, msg)
+	if !ok {
+		return
+	}
+
+	saved, err := model.CreateGroupMessage(&model.Message{
+		SenderId:      c.User.Id,
+		GroupId:       msg.GroupId,
+		ThreadId:      msg.ThreadId,
+		Body:          msg.Content,
+		ContentType:   msg.ContentType,
+		ClientId:      model.NullableString(msg.ClientId),
+		ReplyToId:     msg.ReplyToId,
+		AttachmentIds: msg.AttachmentIds,
+	})
+	if err != nil {
+		sendSaveError(c, msg, err)
+		return
+	}
+
+	memberIds, err := recipientsOf(msg.GroupId, c.User.Id)
+	if err != nil {
+		log.Printf("websocket: 查询群 %d 成员失败: %v", msg.GroupId, err)
+		memberIds = []int{c.User.Id}
+	}
+
+	mentioned := c.hub.saveMentions(saved, parsed, memberIds)
+	if saved.ThreadId > 0 {
+		c.hub.sendThreadMessage(saved, memberIds, mentioned)
+		return
+	}
+	c.hub.sendGroupMessage(saved, memberIds, mentioned)
+}
+
+// 保存消息失败时提示发送人
+func sendSaveError(c *Client, msg *Message, err error) {
+	content := "消息发送失败，请稍后再试"
+	switch err {
+	case model.ErrInvalidReply:
+		content = "引用的消息不存在"
+	case model.ErrInvalidThread:
+		content = "该消息不能开启话题"
+	case model.ErrInvalidAttachment:
+		content = "附件不存在或已发送"
+	case model.ErrQuotaExceeded:
+		content = "群存储空间已满，无法发送附件"
+	case model.ErrInvalidVoice:
+		content = "语音文件无法识别或超过时长、大小限制"
+	case model.ErrBodyTooLong:
+		content = "消息内容不能超过64KB"
+	default:
+		log.Printf("websocket: 用户 %d 保存消息失败: %v", c.User.Id, err)
+	}
+	c.hub.SendToClient(c, &Message{Type: TypeError, ClientId: msg.ClientId, Content: content, Time: time.Now().Unix()})
+}
+
+// 群消息的接收人：全部群成员中去掉拉黑了发送人的成员
+func recipientsOf(groupId, senderId int) ([]int, error) {
+	memberIds, err := model.GroupMemberIds(groupId)
+	if err != nil {
+		return nil, err
+	}
+	blockers, err := model.BlockersOf(senderId, memberIds)
+	if err != nil || len(blockers) == 0 {
+		return memberIds, err
+	}
+
+	skip := make(map[int]bool, len(blockers))
+	for _, id := range blockers {
+		skip[id] = true
+	}
+	recipients := make([]int, 0, len(memberIds))
+	for _, id := range memberIds {
+		if !skip[id] {
+			recipients = append(recipients, id)
+		}
+	}
+	return recipients, nil
+}
+
+/**
+ * 推送群通知
+ * @param []int userIds 接收人，一般为变动前后的全部群成员
+ * @param int groupId 群ID
+ * @param int operatorId 操作人ID
+ * @param string event 事件名，如 member_added、member_removed、dissolved
+ * @param interface{} data 事件数据
+ */
+func (h *Hub) SendGroupEvent(userIds []int, groupId, operatorId int, event string, data interface{}) {
+	h.SendToUsers(userIds, &Message{
+		Type:    TypeGroupEvent,
+		GroupId: groupId,
+		From:    operatorId,
+		Event:   event,
+		Data:    data,
+		Time:    time.Now().Unix(),
+	})
+}
+
+// 推送好友通知，如收到好友申请（request）、申请被同意（accepted）
+func (h *Hub) SendFriendEvent(userId, operatorId int, event string, data interface{}) {
+	h.SendToUser(userId, &Message{
+		Type:  TypeFriendEvent,
+		From:  operatorId,
+		To:    userId,
+		Event: event,
+		Data:  data,
+		Time:  time.Now().Unix(),
+	})
+}
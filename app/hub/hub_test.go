@@ -0,0 +1,119 @@
+package hub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-ini/ini"
+	"github.com/gorilla/websocket"
+	"go-chats/app/global/variable"
+	"go-chats/app/model"
+)
+
+// 在线状态推送会查询数据库，使用空的内存 SQLite，查询失败只记录日志
+func startHub(t *testing.T) *Hub {
+	cfg, err := ini.Load([]byte("DB_CONNECTION=sqlite\nDB_DATABASE=:memory:\nDB_PREFIX=gc_\nDB_LOG_LEVEL=silent\nDB_MAX_OPEN_CONNS=1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := model.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 关闭消息中心后在线状态协程还会保存最后在线时间，不恢复 model.DB
+	model.DB = db
+
+	h := NewHub()
+	go h.Run()
+	t.Cleanup(h.Close)
+	return h
+}
+
+// 不建立 WebSocket 连接，直接注册到消息中心的连接
+func connect(t *testing.T, h *Hub, userId int) *Client {
+	c := &Client{hub: h, send: make(chan []byte, sendQueueSize), User: variable.UserSessionData{Id: userId}}
+	h.register <- c
+	return c
+}
+
+func receive(t *testing.T, c *Client) []byte {
+	select {
+	case data := <-c.send:
+		return data
+	case <-time.After(time.Second):
+		t.Fatal("no message delivered")
+		return nil
+	}
+}
+
+// 踢下线后再向该连接投递不能写入已关闭的发送队列
+func TestSendToClientAfterKick(t *testing.T) {
+	h := startHub(t)
+	kicked := connect(t, h, 1)
+	other := connect(t, h, 2)
+
+	h.Kick(1)
+	if _, ok := <-kicked.send; ok {
+		t.Fatal("send queue of the kicked client is still open")
+	}
+	h.SendToClient(kicked, &Message{Type: TypeError, Content: "late"})
+	// 投递按入队顺序处理，收到后一条说明前一条已经处理完
+	h.SendToClient(other, &Message{Type: TypeError, Content: "after"})
+	receive(t, other)
+	if h.IsOnline(1) {
+		t.Error("kicked user is still online")
+	}
+}
+
+// 注销后再投递同样丢弃
+func TestSendToClientAfterUnregister(t *testing.T) {
+	h := startHub(t)
+	c := connect(t, h, 1)
+	other := connect(t, h, 2)
+
+	h.unregister <- c
+	h.SendToClient(c, &Message{Type: TypeError, Content: "late"})
+	h.SendToUser(1, &Message{Type: TypeError, Content: "late"})
+	h.SendToClient(other, &Message{Type: TypeError, Content: "after"})
+	receive(t, other)
+}
+
+// 内容达到长度上限且全部需要转义的消息不能超过读取上限，连接保持，由后续的校验返回错误
+func TestReadLimitFitsMaxBody(t *testing.T) {
+	h := startHub(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := ServeWs(h, w, r, variable.UserSessionData{Id: 1}); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	data, err := json.Marshal(&Message{Type: "unknown", ClientId: strings.Repeat("x", 64), Content: strings.Repeat("\x1f", model.MaxBodyLength+1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, reply, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("connection closed after a %d byte frame: %v", len(data), err)
+		}
+		msg := &Message{}
+		if json.Unmarshal(reply, msg) == nil && msg.Type == TypeError {
+			return
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package hub
+
+import (
+	"go-chats/app/model"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// 语音消息已被接收人收听，Data 为收听人和收听时间
+const MessageListened = "listened"
+
+/**
+ * 标记语音消息已收听，第一次收听时推送给发送人和收听人自己的其他设备
+ * 收听状态每个接收人单独记录，群里的其他成员不会收到通知；发送人播放自己的语音不记录
+ */
+func (h *Hub) Listened(userId, messageId int) error {
+	msg := &model.Message{}
+	if err := model.DB.First(msg, messageId).Error; err != nil {
+		return err
+	}
+	if msg.RecalledAt != nil {
+		return model.ErrMessageRecalled
+	}
+	if msg.ContentType != model.ContentVoice {
+		return model.ErrNotVoiceMessage
+	}
+	conv := &model.Conversation{}
+	if err := model.DB.First(conv, msg.ConversationId).Error; err != nil || !conv.HasMember(userId) {
+		return gorm.ErrRecordNotFound
+	}
+	if msg.SenderId == userId {
+		return nil
+	}
+
+	listen, created, err := model.MarkListened(msg.Id, userId)
+	if err != nil {
+		log.Printf("websocket: 用户 %d 标记语音消息 %d 已收听失败: %v", userId, msg.Id, err)
+		return err
+	}
+	if !created {
+		return nil
+	}
+	h.SendToUsers([]int{msg.SenderId, userId}, &Message{
+		Type:           TypeMessageEvent,
+		Id:             msg.Id,
+		ConversationId: msg.ConversationId,
+		From:           userId,
+		To:             msg.RecipientId,
+		GroupId:        msg.GroupId,
+		ThreadId:       msg.ThreadId,
+		Event:          MessageListened,
+		Data:           map[string]interface{}{"user_id": userId, "listened_at": listen.CreatedAt.Unix()},
+		Time:           time.Now().Unix(),
+	})
+	return nil
+}
+
+// 语音已收听：{type: listened, id}
+func handleListened(c *Client, msg *Message) {
+	if msg.Id <= 0 {
+		c.hub.SendToClient(c, &Message{Type: TypeError, Content: "消息ID不能为空", Time: time.Now().Unix()})
+		return
+	}
+	if err := c.hub.Listened(c.User.Id, msg.Id); err != nil {
+		c.hub.SendToClient(c, &Message{Type: TypeError, Id: msg.Id, Content: MessageErrorText(err), Time: time.Now().Unix()})
+	}
+}
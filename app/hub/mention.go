@@ -0,0 +1,106 @@
+package hub
+
+import (
+	"go-chats/app/model"
+	"log"
+	"time"
+)
+
+/**
+ * 解析群消息中的提及，@all 只有群主和管理员可以使用，否则提示发送人
+ * @return bool 是否允许发送
+ */
+func mentionsOf(c *Client, msg *Message) (model.ParsedMentions, bool) {
+	parsed := model.ParseMentions(msg.Content)
+	if !parsed.All {
+		return parsed, true
+	}
+	member, err := model.FindGroupMember(msg.GroupId, c.User.Id)
+	if err != nil || !member.IsManager() {
+		c.hub.SendToClient(c, &Message{Type: TypeError, GroupId: msg.GroupId, ClientId: msg.ClientId, Content: "只有群主和管理员可以@所有人", Time: time.Now().Unix()})
+		return parsed, false
+	}
+	return parsed, true
+}
+
+/**
+ * 计算被提及的成员并保存提及记录，只包括能收到消息的成员，不包括发送人自己
+ * 同一成员按 @用户名、@all、@here 的优先级只记录一次
+ * @param []int recipients 消息的接收人
+ * @return map[int]uint8 被提及的用户ID => 提及方式
+ */
+func (h *Hub) saveMentions(msg *model.Message, parsed model.ParsedMentions, recipients []int) map[int]uint8 {
+	kinds := make(map[int]uint8)
+	if len(parsed.Usernames) == 0 && !parsed.All && !parsed.Here {
+		return kinds
+	}
+
+	receiving := make(map[int]bool, len(recipients))
+	for _, id := range recipients {
+		if id == msg.SenderId {
+			continue
+		}
+		receiving[id] = true
+		if parsed.All {
+			kinds[id] = model.MentionAll
+		} else if parsed.Here && h.IsOnline(id) {
+			kinds[id] = model.MentionHere
+		}
+	}
+	userIds, err := model.MentionedMemberIds(msg.GroupId, parsed.Usernames)
+	if err != nil {
+		log.Printf("websocket: 查询群 %d 被提及的成员失败: %v", msg.GroupId, err)
+	}
+	for _, id := range userIds {
+		if receiving[id] {
+			kinds[id] = model.MentionUser
+		}
+	}
+
+	if err := model.CreateMentions(msg, kinds); err != nil {
+		log.Printf("websocket: 保存消息 %d 的提及记录失败: %v", msg.Id, err)
+	}
+	return kinds
+}
+
+/**
+ * 推送群消息，被提及的成员收到的消息带 mentioned 标记
+ * 设置了免打扰且未被提及的成员收到的消息带 silent 标记，客户端据此不弹出通知
+ */
+func (h *Hub) sendGroupMessage(msg *model.Message, recipients []int, mentioned map[int]uint8) {
+	mutedIds, err := model.MutedMemberIds(msg.GroupId)
+	if err != nil {
+		log.Printf("websocket: 查询群 %d 免打扰成员失败: %v", msg.GroupId, err)
+	}
+	muted := make(map[int]bool, len(mutedIds))
+	for _, id := range mutedIds {
+		muted[id] = true
+	}
+
+	normal := make([]int, 0, len(recipients))
+	silent := make([]int, 0)
+	mentionedIds := make([]int, 0, len(mentioned))
+	for _, id := range recipients {
+		if _, ok := mentioned[id]; ok {
+			mentionedIds = append(mentionedIds, id)
+		} else if muted[id] && id != msg.SenderId {
+			silent = append(silent, id)
+		} else {
+			normal = append(normal, id)
+		}
+	}
+
+	if len(normal) > 0 {
+		h.SendToUsers(normal, messageFrame(msg))
+	}
+	if len(silent) > 0 {
+		frame := messageFrame(msg)
+		frame.Data = map[string]interface{}{"silent": true}
+		h.SendToUsers(silent, frame)
+	}
+	if len(mentionedIds) > 0 {
+		frame := messageFrame(msg)
+		frame.Data = map[string]interface{}{"mentioned": true}
+		h.SendToUsers(mentionedIds, frame)
+	}
+}
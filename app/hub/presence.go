@@ -0,0 +1,180 @@
+package hub
+
+import (
+	"go-chats/app/model"
+	"log"
+	"sync"
+	"time"
+)
+
+// 在线状态，用户在多个标签页或设备同时在线时取优先级最高的状态：忙碌 > 在线 > 离开
+const (
+	StatusOnline  = "online"
+	StatusAway    = "away"
+	StatusBusy    = "busy"
+	StatusOffline = "offline"
+)
+
+// 状态优先级，数值越大越优先
+var statusPriority = map[string]int{
+	StatusAway:   1,
+	StatusOnline: 2,
+	StatusBusy:   3,
+}
+
+// 在线状态变化的通知队列。连接增删发生在消息中心主循环中，不能在那里查询数据库，
+// 所以只记录状态可能变化的用户，由单独的协程比较实际状态后推送给好友
+type presenceQueue struct {
+	mu        sync.Mutex
+	dirty     map[int]bool
+	signal    chan struct{}
+	published map[int]string // 已推送给好友的状态，只在推送协程中访问
+}
+
+func newPresenceQueue() *presenceQueue {
+	return &presenceQueue{
+		dirty:     make(map[int]bool),
+		signal:    make(chan struct{}, 1),
+		published: make(map[int]string),
+	}
+}
+
+// 标记用户的状态可能发生了变化，不会阻塞
+func (q *presenceQueue) mark(userId int) {
+	q.mu.Lock()
+	q.dirty[userId] = true
+	q.mu.Unlock()
+
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (q *presenceQueue) take() []int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	userIds := make([]int, 0, len(q.dirty))
+	for userId := range q.dirty {
+		userIds = append(userIds, userId)
+	}
+	q.dirty = make(map[int]bool)
+	return userIds
+}
+
+// 用户当前的在线状态，由该用户所有连接的状态汇总得出
+func (h *Hub) Presence(userId int) string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	status := StatusOffline
+	for c := range h.clients[userId] {
+		if statusPriority[c.status] > statusPriority[status] {
+			status = c.status
+		}
+	}
+	return status
+}
+
+// 修改单个连接的状态
+func (h *Hub) setStatus(c *Client, status string) {
+	h.mu.Lock()
+	if !h.clients[c.User.Id][c] {
+		h.mu.Unlock()
+		return
+	}
+	c.status = status
+	h.mu.Unlock()
+	h.presence.mark(c.User.Id)
+}
+
+// 推送状态变化的协程，停服时记录所有在线用户的最后在线时间
+func (h *Hub) runPresence() {
+	for {
+		select {
+		case <-h.presence.signal:
+			for _, userId := range h.presence.take() {
+				h.publishPresence(userId)
+			}
+
+		case <-h.quit:
+			now := time.Now()
+			for userId := range h.presence.published {
+				if err := model.UpdateLastSeen(userId, now); err != nil {
+					log.Printf("presence: 保存用户 %d 最后在线时间失败: %v", userId, err)
+				}
+			}
+			return
+		}
+	}
+}
+
+// 状态与上次推送的不同时推送给好友，下线时保存最后在线时间
+func (h *Hub) publishPresence(userId int) {
+	status := h.Presence(userId)
+	previous, ok := h.presence.published[userId]
+	if !ok {
+		previous = StatusOffline
+	}
+	if status == previous {
+		return
+	}
+
+	data := map[string]interface{}{"status": status}
+	if status == StatusOffline {
+		delete(h.presence.published, userId)
+		now := time.Now()
+		if err := model.UpdateLastSeen(userId, now); err != nil {
+			log.Printf("presence: 保存用户 %d 最后在线时间失败: %v", userId, err)
+		}
+		data["last_seen"] = now.Unix()
+	} else {
+		h.presence.published[userId] = status
+	}
+
+	// 在线状态和最后在线时间都对所有人隐藏时不推送；其余设置下好友都可见
+	user := model.User{}
+	if err := model.DB.Select("id", "last_seen_policy").First(&user, userId).Error; err != nil || user.LastSeenPolicy == model.PrivacyNobody {
+		return
+	}
+
+	watchers, err := presenceWatchers(userId)
+	if err != nil {
+		log.Printf("presence: 查询用户 %d 的好友失败: %v", userId, err)
+		return
+	}
+	h.SendToUsers(watchers, &Message{Type: TypePresence, From: userId, Content: status, Data: data, Time: time.Now().Unix()})
+}
+
+// 可以收到用户状态变化的人：该用户的好友中去掉被他拉黑的人
+func presenceWatchers(userId int) ([]int, error) {
+	friendIds, err := model.FriendIds(userId)
+	if err != nil || len(friendIds) == 0 {
+		return friendIds, err
+	}
+	blockedIds, err := model.BlockedIds(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	skip := make(map[int]bool, len(blockedIds))
+	for _, id := range blockedIds {
+		skip[id] = true
+	}
+	watchers := make([]int, 0, len(friendIds))
+	for _, id := range friendIds {
+		if !skip[id] {
+			watchers = append(watchers, id)
+		}
+	}
+	return watchers, nil
+}
+
+// 客户端设置当前连接的状态，content 为 online、away 或 busy
+func handlePresence(c *Client, msg *Message) {
+	if _, ok := statusPriority[msg.Content]; !ok {
+		c.hub.SendToClient(c, &Message{Type: TypeError, Content: "状态只能是 online、away 或 busy", Time: time.Now().Unix()})
+		return
+	}
+	c.hub.setStatus(c, msg.Content)
+}
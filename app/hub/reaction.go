@@ -0,0 +1,71 @@
+package hub
+
+import (
+	"go-chats/app/model"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 表情回应事件
+const (
+	MessageReactionAdded   = "reaction_added"
+	MessageReactionRemoved = "reaction_removed"
+)
+
+// 表情的最大长度（字节），组合表情由多个码点组成
+const maxEmojiLength = 32
+
+// 校验表情回应的内容：非空、不含空白且长度有限
+func ValidEmoji(emoji string) bool {
+	return emoji != "" && len(emoji) <= maxEmojiLength && utf8.ValidString(emoji) && strings.TrimSpace(emoji) == emoji
+}
+
+/**
+ * 添加或取消表情回应，推送给会话中的所有在线成员
+ * @param bool add true 为添加，false 为取消
+ */
+func (h *Hub) React(userId, messageId int, emoji string, add bool) error {
+	msg := &model.Message{}
+	if err := model.DB.First(msg, messageId).Error; err != nil {
+		return err
+	}
+	if msg.RecalledAt != nil {
+		return model.ErrMessageRecalled
+	}
+	conv := &model.Conversation{}
+	if err := model.DB.First(conv, msg.ConversationId).Error; err != nil || !conv.HasMember(userId) {
+		return gorm.ErrRecordNotFound
+	}
+
+	event := MessageReactionAdded
+	if add {
+		if err := model.AddReaction(msg.Id, userId, emoji); err != nil {
+			return err
+		}
+	} else {
+		if err := model.RemoveReaction(msg.Id, userId, emoji); err != nil {
+			return err
+		}
+		event = MessageReactionRemoved
+	}
+
+	h.sendMessageEvent(msg, &Message{From: userId, Content: emoji, Event: event})
+	return nil
+}
+
+// 表情回应：{type: reaction, id, content: 表情, event: add 或 remove}
+func handleReaction(c *Client, msg *Message) {
+	if msg.Id <= 0 || !ValidEmoji(msg.Content) {
+		c.hub.SendToClient(c, &Message{Type: TypeError, Id: msg.Id, Content: "消息ID和表情不能为空", Time: time.Now().Unix()})
+		return
+	}
+	if msg.Event != "add" && msg.Event != "remove" {
+		c.hub.SendToClient(c, &Message{Type: TypeError, Id: msg.Id, Content: "event 只能是 add 或 remove", Time: time.Now().Unix()})
+		return
+	}
+	if err := c.hub.React(c.User.Id, msg.Id, msg.Content, msg.Event == "add"); err != nil {
+		c.hub.SendToClient(c, &Message{Type: TypeError, Id: msg.Id, Content: MessageErrorText(err), Time: time.Now().Unix()})
+	}
+}
@@ -0,0 +1,64 @@
+package hub
+
+import (
+	"go-chats/app/model"
+	"log"
+	"time"
+)
+
+/**
+ * 送达回执：客户端收到消息后上报 {type: delivered, conversation_id, id}
+ * 已读回执：客户端展示到某条消息后上报 {type: read, conversation_id, id}，表示该消息及之前的消息都已读
+ * 游标前进后向区间内消息的发送人推送 receipt 消息，已读还会同步到自己的其他设备以便清除未读数
+ */
+func handleDelivered(c *Client, msg *Message) {
+	advanceCursor(c, msg, model.CursorDelivered, ReceiptDelivered)
+}
+
+func handleRead(c *Client, msg *Message) {
+	advanceCursor(c, msg, model.CursorRead, ReceiptRead)
+}
+
+func advanceCursor(c *Client, msg *Message, column, event string) {
+	if msg.ConversationId <= 0 || msg.Id <= 0 {
+		c.hub.SendToClient(c, &Message{Type: TypeError, Content: "会话ID和消息ID不能为空", Time: time.Now().Unix()})
+		return
+	}
+
+	conv := &model.Conversation{}
+	if err := model.DB.First(conv, msg.ConversationId).Error; err != nil || !conv.HasMember(c.User.Id) {
+		c.hub.SendToClient(c, &Message{Type: TypeError, ConversationId: msg.ConversationId, Content: "该会话不存在", Time: time.Now().Unix()})
+		return
+	}
+
+	previous, advanced, err := model.AdvanceCursor(conv.Id, c.User.Id, column, msg.Id)
+	if err != nil {
+		if err == model.ErrMessageNotInConversation {
+			c.hub.SendToClient(c, &Message{Type: TypeError, ConversationId: conv.Id, Content: "该消息不存在", Time: time.Now().Unix()})
+			return
+		}
+		log.Printf("websocket: 用户 %d 更新会话 %d 的 %s 游标失败: %v", c.User.Id, conv.Id, event, err)
+		return
+	}
+	if !advanced {
+		return
+	}
+
+	senders, err := model.MessageSenders(conv.Id, c.User.Id, previous, msg.Id)
+	if err != nil {
+		log.Printf("websocket: 查询会话 %d 的消息发送人失败: %v", conv.Id, err)
+		return
+	}
+	if event == ReceiptRead {
+		senders = append(senders, c.User.Id)
+	}
+	c.hub.SendToUsers(senders, &Message{
+		Type:           TypeReceipt,
+		Id:             msg.Id,
+		ConversationId: conv.Id,
+		From:           c.User.Id,
+		GroupId:        conv.GroupId,
+		Event:          event,
+		Time:           time.Now().Unix(),
+	})
+}
@@ -0,0 +1,145 @@
+package hub
+
+import (
+	"github.com/go-ini/ini"
+	"go-chats/app/global/variable"
+	"go-chats/app/model"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// 消息变更事件
+const (
+	MessageEdited   = "edited"   // 已编辑，content 为新内容
+	MessageRecalled = "recalled" // 已撤回
+	MessageDeleted  = "deleted"  // 已删除，只推送给删除人自己的其他设备
+)
+
+// 发送后允许撤回的时间，0 为不限制
+func recallWindow() time.Duration {
+	return time.Duration(variable.Config.Section(ini.DefaultSection).Key("MESSAGE_RECALL_WINDOW").MustInt(120)) * time.Second
+}
+
+// 编辑、撤回、删除消息、表情回应和标记语音已听失败时返回给用户的提示
+func MessageErrorText(err error) string {
+	switch err {
+	case gorm.ErrRecordNotFound:
+		return "该消息不存在"
+	case model.ErrNotMessageSender:
+		return "只能操作自己发送的消息"
+	case model.ErrNotGroupMember:
+		return "你不是该群成员"
+	case model.ErrMessageRecalled:
+		return "该消息已被撤回"
+	case model.ErrRecallExpired:
+		return "消息发送时间过长，无法撤回"
+	case model.ErrNotEditable:
+		return "该类型的消息不支持编辑"
+	case model.ErrBodyTooLong:
+		return "消息内容不能超过64KB"
+	case model.ErrReactionNotFound:
+		return "你还没有回应过这个表情"
+	case model.ErrNotVoiceMessage:
+		return "该消息不是语音消息"
+	default:
+		return "操作失败，请稍后再试"
+	}
+}
+
+// 编辑消息并推送给会话中的所有在线成员
+func (h *Hub) EditMessage(userId, messageId int, body string) (*model.Message, error) {
+	msg, err := model.EditMessage(userId, messageId, body)
+	if err != nil {
+		return nil, err
+	}
+	h.sendMessageEvent(msg, &Message{Content: msg.Body, Event: MessageEdited, Data: map[string]interface{}{"edited_at": msg.EditedAt.Unix()}})
+	return msg, nil
+}
+
+// 撤回消息并推送给会话中的所有在线成员
+func (h *Hub) RecallMessage(userId, messageId int) (*model.Message, error) {
+	msg, err := model.RecallMessage(userId, messageId, recallWindow())
+	if err != nil {
+		return nil, err
+	}
+	h.sendMessageEvent(msg, &Message{Event: MessageRecalled, Data: map[string]interface{}{"recalled_at": msg.RecalledAt.Unix()}})
+	return msg, nil
+}
+
+// 只对自己删除消息，同步到自己的其他设备
+func (h *Hub) DeleteMessage(userId, messageId int) error {
+	msg := &model.Message{}
+	if err := model.DB.First(msg, messageId).Error; err != nil {
+		return err
+	}
+	conv := &model.Conversation{}
+	if err := model.DB.First(conv, msg.ConversationId).Error; err != nil || !conv.HasMember(userId) {
+		return gorm.ErrRecordNotFound
+	}
+	if err := model.DeleteMessageForUser(userId, messageId); err != nil {
+		return err
+	}
+	h.SendToUser(userId, &Message{
+		Type:           TypeMessageEvent,
+		Id:             msg.Id,
+		ConversationId: msg.ConversationId,
+		From:           userId,
+		GroupId:        msg.GroupId,
+		Event:          MessageDeleted,
+		Time:           time.Now().Unix(),
+	})
+	return nil
+}
+
+/**
+ * 推送消息变更，单聊推送给双方，群聊推送给没有拉黑发送人的全部成员
+ * @param *Message event 只需填充 Event、Content、Data，From 为空时为消息发送人
+ */
+func (h *Hub) sendMessageEvent(msg *model.Message, event *Message) {
+	userIds := []int{msg.SenderId}
+	if msg.GroupId > 0 {
+		memberIds, err := recipientsOf(msg.GroupId, msg.SenderId)
+		if err != nil {
+			log.Printf("websocket: 查询群 %d 成员失败: %v", msg.GroupId, err)
+		} else {
+			userIds = memberIds
+		}
+	} else if msg.RecipientId != msg.SenderId {
+		userIds = append(userIds, msg.RecipientId)
+	}
+
+	event.Type = TypeMessageEvent
+	event.Id = msg.Id
+	event.ConversationId = msg.ConversationId
+	event.To = msg.RecipientId
+	event.GroupId = msg.GroupId
+	event.ThreadId = msg.ThreadId
+	event.Time = time.Now().Unix()
+	if event.From == 0 {
+		event.From = msg.SenderId
+	}
+	h.SendToUsers(userIds, event)
+}
+
+// 编辑消息：{type: edit, id, content}
+func handleEdit(c *Client, msg *Message) {
+	if msg.Id <= 0 || msg.Content == "" {
+		c.hub.SendToClient(c, &Message{Type: TypeError, Id: msg.Id, Content: "消息ID和内容不能为空", Time: time.Now().Unix()})
+		return
+	}
+	if _, err := c.hub.EditMessage(c.User.Id, msg.Id, msg.Content); err != nil {
+		c.hub.SendToClient(c, &Message{Type: TypeError, Id: msg.Id, Content: MessageErrorText(err), Time: time.Now().Unix()})
+	}
+}
+
+// 撤回消息：{type: recall, id}
+func handleRecall(c *Client, msg *Message) {
+	if msg.Id <= 0 {
+		c.hub.SendToClient(c, &Message{Type: TypeError, Content: "消息ID不能为空", Time: time.Now().Unix()})
+		return
+	}
+	if _, err := c.hub.RecallMessage(c.User.Id, msg.Id); err != nil {
+		c.hub.SendToClient(c, &Message{Type: TypeError, Id: msg.Id, Content: MessageErrorText(err), Time: time.Now().Unix()})
+	}
+}
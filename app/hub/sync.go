@@ -0,0 +1,114 @@
+package hub
+
+import (
+	"github.com/go-ini/ini"
+	"go-chats/app/global/variable"
+	"go-chats/app/model"
+	"log"
+	"time"
+)
+
+// 客户端消息ID的最大长度
+const maxClientIdLength = 64
+
+// 每批补发消息条数的上限，逐条推送时要给发送队列中的其他消息留出空间，否则会被当作慢消费者断开
+const maxSyncBatchSize = sendQueueSize / 4
+
+// 每批补发的消息条数，不超过 maxSyncBatchSize
+func syncBatchSize() int {
+	size := variable.Config.Section(ini.DefaultSection).Key("SYNC_BATCH_SIZE").MustInt(50)
+	if size <= 0 || size > maxSyncBatchSize {
+		return maxSyncBatchSize
+	}
+	return size
+}
+
+// 把持久化的消息转换为推送给客户端的数据帧
+func messageFrame(m *model.Message) *Message {
+	frame := &Message{
+		Type:           TypeMessage,
+		Id:             m.Id,
+		ConversationId: m.ConversationId,
+		From:           m.SenderId,
+		To:             m.RecipientId,
+		GroupId:        m.GroupId,
+		ContentType:    m.ContentType,
+		Content:        m.Body,
+		ReplyToId:      m.ReplyToId,
+		ThreadId:       m.ThreadId,
+		Attachments:    m.Attachments,
+		Time:           m.CreatedAt.Unix(),
+	}
+	if m.GroupId > 0 {
+		frame.Type = TypeGroupMessage
+	}
+	if m.ClientId != nil {
+		frame.ClientId = *m.ClientId
+	}
+	if m.RecalledAt != nil {
+		frame.Data = map[string]interface{}{"recalled_at": m.RecalledAt.Unix()}
+	} else if m.EditedAt != nil {
+		frame.Data = map[string]interface{}{"edited_at": m.EditedAt.Unix()}
+	}
+	return frame
+}
+
+/**
+ * 按客户端消息ID去重：同一条消息已经保存过时只把保存结果回送给发送人作为确认，不再重复保存和转发
+ * @return bool 是否已处理（重复消息或ID不合法）
+ */
+func acknowledged(c *Client, msg *Message) bool {
+	if msg.ClientId == "" {
+		return false
+	}
+	if len(msg.ClientId) > maxClientIdLength {
+		c.hub.SendToClient(c, &Message{Type: TypeError, ClientId: msg.ClientId[:maxClientIdLength], Content: "客户端消息ID不能超过64个字符", Time: time.Now().Unix()})
+		return true
+	}
+
+	saved, err := model.FindClientMessage(c.User.Id, msg.ClientId)
+	if err != nil {
+		return false
+	}
+	c.hub.SendToUser(c.User.Id, messageFrame(saved))
+	return true
+}
+
+/**
+ * 断线重连后补发错过的消息，按消息ID升序逐条推送，推送完一批后回复 sync 消息：
+ * id 为本批最后一条消息的ID，客户端保存为新的同步位置；data.has_more 为 true 时客户端应以新位置继续同步
+ * 传 conversation_id 时只同步该会话，id 为该会话中已收到的最后一条消息ID；
+ * 否则 id 为全局同步位置，即所有会话中已收到的最大消息ID（消息ID全局递增）
+ */
+func handleSync(c *Client, msg *Message) {
+	if msg.Id < 0 {
+		msg.Id = 0
+	}
+	if msg.ConversationId > 0 {
+		conv := &model.Conversation{}
+		if err := model.DB.First(conv, msg.ConversationId).Error; err != nil || !conv.HasMember(c.User.Id) {
+			c.hub.SendToClient(c, &Message{Type: TypeError, ConversationId: msg.ConversationId, Content: "该会话不存在", Time: time.Now().Unix()})
+			return
+		}
+	}
+
+	messages, hasMore, err := model.MissedMessages(c.User.Id, msg.ConversationId, msg.Id, syncBatchSize())
+	if err != nil {
+		log.Printf("websocket: 用户 %d 同步消息失败: %v", c.User.Id, err)
+		c.hub.SendToClient(c, &Message{Type: TypeError, Content: "同步消息失败，请稍后再试", Time: time.Now().Unix()})
+		return
+	}
+
+	token := msg.Id
+	for i := range messages {
+		c.hub.SendToClient(c, messageFrame(&messages[i]))
+		token = messages[i].Id
+	}
+	c.hub.SendToClient(c, &Message{
+		Type:           TypeSync,
+		Id:             token,
+		ConversationId: msg.ConversationId,
+		Data:           map[string]interface{}{"has_more": hasMore, "count": len(messages)},
+		Time:           time.Now().Unix(),
+	})
+}
@@ -0,0 +1,58 @@
+package hub
+
+import (
+	"go-chats/app/model"
+	"log"
+	"time"
+)
+
+// 群通知中的话题事件
+const GroupEventThreadReplied = "thread_replied"
+
+/**
+ * 推送话题消息：发言人自动关注话题，根消息作者在第一次有人回复时自动关注
+ * 完整消息只推送给关注且未取消关注的成员和被提及的成员，其余成员收到 thread_replied 群通知用于更新回复数
+ * @param []int memberIds 没有拉黑发送人的全部群成员
+ * @param map[int]uint8 mentioned 被提及的成员
+ */
+func (h *Hub) sendThreadMessage(msg *model.Message, memberIds []int, mentioned map[int]uint8) {
+	root := &model.Message{}
+	if err := model.DB.Select("id", "sender_id").First(root, msg.ThreadId).Error; err == nil {
+		if err := model.FollowThread(msg.ConversationId, root.SenderId, false, false); err != nil {
+			log.Printf("websocket: 根消息作者 %d 关注话题 %d 失败: %v", root.SenderId, msg.ConversationId, err)
+		}
+	}
+	if err := model.FollowThread(msg.ConversationId, msg.SenderId, false, true); err != nil {
+		log.Printf("websocket: 用户 %d 关注话题 %d 失败: %v", msg.SenderId, msg.ConversationId, err)
+	}
+
+	followerIds, err := model.ThreadFollowerIds(msg.ConversationId)
+	if err != nil {
+		log.Printf("websocket: 查询话题 %d 的关注者失败: %v", msg.ConversationId, err)
+		followerIds = []int{msg.SenderId}
+	}
+	following := make(map[int]bool, len(followerIds))
+	for _, id := range followerIds {
+		following[id] = true
+	}
+	recipients := make([]int, 0, len(followerIds))
+	for _, id := range memberIds {
+		if _, ok := mentioned[id]; ok || following[id] {
+			recipients = append(recipients, id)
+		}
+	}
+	h.sendGroupMessage(msg, recipients, mentioned)
+
+	data := map[string]interface{}{"root_message_id": msg.ThreadId, "conversation_id": msg.ConversationId, "last_reply_id": msg.Id}
+	if summaries, err := model.ThreadSummaries([]int{msg.ThreadId}); err == nil && summaries[msg.ThreadId] != nil {
+		data["reply_count"] = summaries[msg.ThreadId].ReplyCount
+	}
+	h.SendToUsers(memberIds, &Message{
+		Type:    TypeGroupEvent,
+		GroupId: msg.GroupId,
+		From:    msg.SenderId,
+		Event:   GroupEventThreadReplied,
+		Data:    data,
+		Time:    time.Now().Unix(),
+	})
+}
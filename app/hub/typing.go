@@ -0,0 +1,87 @@
+package hub
+
+import (
+	"github.com/go-ini/ini"
+	"go-chats/app/global/variable"
+	"go-chats/app/model"
+	"strconv"
+	"time"
+)
+
+// 正在输入事件的状态
+const (
+	TypingStart = "start"
+	TypingStop  = "stop"
+)
+
+// 同一会话中两次转发正在输入事件的最小间隔（秒），客户端按键时可以频繁上报，服务端负责节流
+func typingThrottle() time.Duration {
+	return time.Duration(variable.Config.Section(ini.DefaultSection).Key("TYPING_THROTTLE").MustInt(3)) * time.Second
+}
+
+// 正在输入提示的有效期（秒），接收方超过该时间没有收到新的事件时自动隐藏提示
+func typingTimeout() int {
+	return variable.Config.Section(ini.DefaultSection).Key("TYPING_TIMEOUT").MustInt(6)
+}
+
+/**
+ * 正在输入：单聊传 to，群聊传 group_id，content 为 start（默认）或 stop
+ * 只转发给在线的对方，不持久化；start 按会话节流，stop 总是立即转发
+ */
+func handleTyping(c *Client, msg *Message) {
+	state := msg.Content
+	if state == "" {
+		state = TypingStart
+	}
+	if state != TypingStart && state != TypingStop {
+		c.hub.SendToClient(c, &Message{Type: TypeError, Content: "正在输入状态只能是 start 或 stop", Time: time.Now().Unix()})
+		return
+	}
+
+	key := "u" + strconv.Itoa(msg.To)
+	if msg.GroupId > 0 {
+		key = "g" + strconv.Itoa(msg.GroupId)
+	}
+	if state == TypingStart {
+		if last, ok := c.typingAt[key]; ok && time.Since(last) < typingThrottle() {
+			return
+		}
+		c.typingAt[key] = time.Now()
+	} else {
+		delete(c.typingAt, key)
+	}
+
+	event := &Message{
+		Type:    TypeTyping,
+		From:    c.User.Id,
+		Content: state,
+		Data:    map[string]interface{}{"expires_in": typingTimeout()},
+		Time:    time.Now().Unix(),
+	}
+
+	if msg.GroupId > 0 {
+		if !model.IsGroupMember(msg.GroupId, c.User.Id) {
+			return
+		}
+		recipients, err := recipientsOf(msg.GroupId, c.User.Id)
+		if err != nil {
+			return
+		}
+		others := make([]int, 0, len(recipients))
+		for _, id := range recipients {
+			if id != c.User.Id {
+				others = append(others, id)
+			}
+		}
+		event.GroupId = msg.GroupId
+		c.hub.SendToUsers(others, event)
+		return
+	}
+
+	// 被拉黑时静默丢弃，不向发送方暴露拉黑关系
+	if msg.To <= 0 || msg.To == c.User.Id || model.CanContact(c.User.Id, msg.To) != nil {
+		return
+	}
+	event.To = msg.To
+	c.hub.SendToUser(msg.To, event)
+}
@@ -0,0 +1,181 @@
+package media
+
+import (
+	"bytes"
+	"github.com/go-ini/ini"
+	"go-chats/app/model"
+	"go-chats/app/utils/imaging"
+	"go-chats/app/utils/storage"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+// 计算 BlurHash 前先把图片缩小到的尺寸，分量数只有几个，更大的图片没有意义
+const blurhashSize = 32
+
+/**
+ * 图片处理队列：上传图片后在后台生成缩略图和 BlurHash，上传请求不用等待
+ * 队列满时丢弃任务，服务重启时会把没有处理完的图片重新加入队列
+ */
+type Processor struct {
+	queue     chan int
+	sizes     []int // 缩略图尺寸（长边像素），升序
+	quality   int   // 缩略图 JPEG 质量
+	maxPixels int   // 超过该像素数的图片不解码，防止超大图片占满内存
+
+	// 处理完成后的回调，用于通知会话成员，在处理协程中执行
+	OnProcessed func(a *model.Attachment)
+}
+
+// 全局图片处理队列，由 bootstrap 初始化
+var Default *Processor
+
+// 按配置创建图片处理队列并启动处理协程
+func NewProcessor(cfg *ini.File) *Processor {
+	section := cfg.Section(ini.DefaultSection)
+	sizes := make([]int, 0)
+	for _, s := range strings.Split(section.Key("THUMBNAIL_SIZES").MustString("160,480"), ",") {
+		if size, err := strconv.Atoi(strings.TrimSpace(s)); err == nil && size > 0 {
+			sizes = append(sizes, size)
+		}
+	}
+	sort.Ints(sizes)
+
+	p := &Processor{
+		queue:     make(chan int, section.Key("IMAGE_QUEUE_SIZE").MustInt(256)),
+		sizes:     sizes,
+		quality:   section.Key("THUMBNAIL_QUALITY").MustInt(80),
+		maxPixels: section.Key("IMAGE_MAX_PIXELS").MustInt(50) * 1000000,
+	}
+	workers := section.Key("IMAGE_WORKERS").MustInt(2)
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// 把图片附件加入处理队列，不阻塞
+func (p *Processor) Enqueue(attachmentId int) {
+	select {
+	case p.queue <- attachmentId:
+	default:
+		log.Printf("图片处理队列已满，附件 %d 将在服务重启后处理", attachmentId)
+	}
+}
+
+// 把没有处理完的图片重新加入队列
+func (p *Processor) Resume() {
+	ids, err := model.PendingPreviewIds()
+	if err != nil {
+		log.Printf("查询待处理的图片失败: %v", err)
+		return
+	}
+	for _, id := range ids {
+		p.Enqueue(id)
+	}
+}
+
+func (p *Processor) work() {
+	for id := range p.queue {
+		a := &model.Attachment{}
+		if err := model.DB.First(a, id).Error; err != nil || a.ProcessedAt != nil || !a.HasPreview() {
+			continue
+		}
+		if err := p.process(a); err != nil {
+			log.Printf("处理图片附件 %d 失败: %v", a.Id, err)
+		}
+		if p.OnProcessed != nil && a.ProcessedAt != nil {
+			p.OnProcessed(a)
+		}
+	}
+}
+
+// 生成缩略图和 BlurHash，图片无法解码时也标记为已处理，不再重试
+func (p *Processor) process(a *model.Attachment) error {
+	now := time.Now()
+	updates := map[string]interface{}{"processed_at": now}
+	defer func() {
+		if err := model.DB.Model(a).Updates(updates).Error; err != nil {
+			log.Printf("保存图片附件 %d 的处理结果失败: %v", a.Id, err)
+			return
+		}
+		a.ProcessedAt = &now
+	}()
+
+	// 内容相同的图片已经处理过，直接复用
+	if twin := model.ProcessedTwin(a); twin != nil {
+		updates["width"], updates["height"] = twin.Width, twin.Height
+		updates["blurhash"], updates["thumbnail_sizes"] = twin.Blurhash, twin.ThumbnailSizes
+		a.Width, a.Height, a.Blurhash, a.ThumbnailSizes = twin.Width, twin.Height, twin.Blurhash, twin.ThumbnailSizes
+		return nil
+	}
+
+	f, err := storage.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if config.Width*config.Height > p.maxPixels {
+		return nil
+	}
+
+	orientation := 1
+	if a.Mime == "image/jpeg" {
+		orientation = imaging.Orientation(bytes.NewReader(data))
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	source := imaging.Flatten(img)
+	a.Width, a.Height = imaging.DisplaySize(config.Width, config.Height, orientation)
+	updates["width"], updates["height"] = a.Width, a.Height
+
+	generated := make([]string, 0, len(p.sizes))
+	for _, size := range p.sizes {
+		if config.Width <= size && config.Height <= size {
+			// 原图比缩略图还小，客户端直接使用原图
+			break
+		}
+		buf := &bytes.Buffer{}
+		if err := jpeg.Encode(buf, imaging.Orient(imaging.Fit(source, size), orientation), &jpeg.Options{Quality: p.quality}); err != nil {
+			return err
+		}
+		if err := storage.Write(a.ThumbnailPath(size), buf.Bytes(), "image/jpeg"); err != nil {
+			return err
+		}
+		generated = append(generated, strconv.Itoa(size))
+	}
+	a.ThumbnailSizes = strings.Join(generated, ",")
+	updates["thumbnail_sizes"] = a.ThumbnailSizes
+
+	// 横图用 4×3 个分量，竖图用 3×4 个
+	small := imaging.Orient(imaging.Fit(source, blurhashSize), orientation)
+	xComponents, yComponents := 4, 3
+	if a.Height > a.Width {
+		xComponents, yComponents = 3, 4
+	}
+	a.Blurhash = imaging.Blurhash(small, xComponents, yComponents)
+	updates["blurhash"] = a.Blurhash
+	return nil
+}
@@ -0,0 +1,213 @@
+package model
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidAttachment = errors.New("attachment does not exist or has been sent")
+	ErrInvalidVoice      = errors.New("voice message must have exactly one valid voice attachment")
+)
+
+// 语音消息的时长（毫秒）和文件大小（字节）上限，0 为不限制，由 bootstrap 按配置设置
+var (
+	VoiceMaxDuration int
+	VoiceMaxSize     int64
+)
+
+// 上传的附件，文件按 MD5 保存，内容相同的附件共用一个文件
+type Attachment struct {
+	Id             int        `gorm:"primary_key" json:"id"`
+	UploaderId     int        `json:"uploader_id"`
+	MessageId      int        `json:"message_id"`      // 发送前为0，一个附件只能随一条消息发送
+	ConversationId int        `json:"conversation_id"` // 发送后所在的会话，用于下载鉴权
+	Name           string     `json:"name"`
+	Size           int64      `json:"size"`
+	SizeText       string     `json:"size_text"` // 便于显示的大小，如 1.50 MB
+	Mime           string     `json:"mime"`
+	Md5            string     `json:"md5"`
+	Path           string     `json:"-"`                                  // 文件在存储目录下的相对路径
+	Width          int        `json:"width,omitempty"`                    // 图片按旋转方向转正后的宽度
+	Height         int        `json:"height,omitempty"`                   // 图片按旋转方向转正后的高度
+	Blurhash       string     `json:"blurhash,omitempty"`                 // 图片加载前显示的模糊占位图
+	ThumbnailSizes string     `json:"thumbnail_sizes,omitempty"`          // 已生成的缩略图尺寸（长边像素），逗号分隔
+	ProcessedAt    *time.Time `json:"processed_at,omitempty"`             // 图片处理完成时间，为空时缩略图还在生成
+	Duration       int        `json:"duration,omitempty"`                 // 音频时长（毫秒）
+	Waveform       Waveform   `gorm:"size:255" json:"waveform,omitempty"` // 音频的音量包络，用于绘制语音条
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// 音量包络，每个值为 0~31，数据库中保存为逗号分隔的字符串，JSON 中为数组
+type Waveform []int
+
+func (w Waveform) Value() (driver.Value, error) {
+	values := make([]string, len(w))
+	for i, v := range w {
+		values[i] = strconv.Itoa(v)
+	}
+	return strings.Join(values, ","), nil
+}
+
+func (w *Waveform) Scan(value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("unsupported waveform value %T", value)
+	}
+	*w = nil
+	for _, part := range strings.Split(s, ",") {
+		if part == "" {
+			continue
+		}
+		v, err := strconv.Atoi(part)
+		if err != nil {
+			return err
+		}
+		*w = append(*w, v)
+	}
+	return nil
+}
+
+// 是否为图片
+func (a *Attachment) IsImage() bool {
+	return strings.HasPrefix(a.Mime, "image/")
+}
+
+// 是否为解析出了时长的语音文件
+func (a *Attachment) IsVoice() bool {
+	return (a.Mime == "audio/ogg" || a.Mime == "audio/webm") && a.Duration > 0
+}
+
+// 是否超过语音消息的时长和大小上限
+func (a *Attachment) ExceedsVoiceLimit() bool {
+	return (VoiceMaxDuration > 0 && a.Duration > VoiceMaxDuration) || (VoiceMaxSize > 0 && a.Size > VoiceMaxSize)
+}
+
+// 是否可以在服务端解码生成缩略图
+func (a *Attachment) HasPreview() bool {
+	return a.Mime == "image/jpeg" || a.Mime == "image/png" || a.Mime == "image/gif"
+}
+
+// 缩略图在存储目录下的相对路径，内容相同的图片共用缩略图
+func (a *Attachment) ThumbnailPath(size int) string {
+	return a.Path + "-" + strconv.Itoa(size) + ".jpg"
+}
+
+// 是否已生成该尺寸的缩略图
+func (a *Attachment) HasThumbnail(size int) bool {
+	for _, s := range strings.Split(a.ThumbnailSizes, ",") {
+		if s == strconv.Itoa(size) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * 检查消息要发送的附件：必须是发送人上传且还没有发送过的，图片消息只能包含图片，
+ * 语音消息只能包含一个不超过时长和大小上限的语音文件
+ * @return []Attachment 按上传顺序排列的附件
+ */
+func pendingAttachments(msg *Message) ([]Attachment, error) {
+	ids := make([]int, 0, len(msg.AttachmentIds))
+	seen := make(map[int]bool, len(msg.AttachmentIds))
+	for _, id := range msg.AttachmentIds {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	attachments := make([]Attachment, 0, len(ids))
+	err := DB.Where("id IN ? AND uploader_id = ? AND message_id = ?", ids, msg.SenderId, 0).Order("id ASC").Find(&attachments).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) != len(ids) {
+		return nil, ErrInvalidAttachment
+	}
+	for _, a := range attachments {
+		if msg.ContentType == ContentImage && !a.IsImage() {
+			return nil, ErrInvalidAttachment
+		}
+		if msg.ContentType == ContentVoice && (len(attachments) != 1 || !a.IsVoice() || a.ExceedsVoiceLimit()) {
+			return nil, ErrInvalidVoice
+		}
+	}
+	return attachments, nil
+}
+
+// 在保存消息的事务中把附件关联到消息，并发发送同一个附件时只有一条消息能成功
+func claimAttachments(tx *gorm.DB, msg *Message, attachments []Attachment) error {
+	ids := make([]int, 0, len(attachments))
+	for i := range attachments {
+		attachments[i].MessageId = msg.Id
+		attachments[i].ConversationId = msg.ConversationId
+		ids = append(ids, attachments[i].Id)
+	}
+	result := tx.Model(&Attachment{}).Where("id IN ? AND message_id = ?", ids, 0).
+		Updates(map[string]interface{}{"message_id": msg.Id, "conversation_id": msg.ConversationId})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != int64(len(ids)) {
+		return ErrInvalidAttachment
+	}
+	return nil
+}
+
+// 预加载消息的附件，已撤回的消息不返回附件
+func visibleAttachments(db *gorm.DB) *gorm.DB {
+	recalled := DB.Model(&Message{}).Select("id").Where("recalled_at IS NOT NULL")
+	return db.Where("message_id NOT IN (?)", recalled).Order("id ASC")
+}
+
+/**
+ * 判断用户能否下载附件：上传人自己，或附件所在会话的成员（消息未撤回）
+ */
+func CanDownloadAttachment(a *Attachment, userId int) bool {
+	if a.UploaderId == userId {
+		return true
+	}
+	if a.MessageId == 0 {
+		return false
+	}
+
+	msg := &Message{}
+	if err := DB.Select("id", "recalled_at").First(msg, a.MessageId).Error; err != nil || msg.RecalledAt != nil {
+		return false
+	}
+	conv := &Conversation{}
+	if err := DB.First(conv, a.ConversationId).Error; err != nil {
+		return false
+	}
+	return conv.HasMember(userId)
+}
+
+// 内容相同且已处理完的图片附件，用于复用缩略图，没有时返回 nil
+func ProcessedTwin(a *Attachment) *Attachment {
+	twin := &Attachment{}
+	err := DB.Where("md5 = ? AND id <> ? AND processed_at IS NOT NULL", a.Md5, a.Id).First(twin).Error
+	if err != nil {
+		return nil
+	}
+	return twin
+}
+
+// 还没有处理完的图片附件ID，服务重启后重新加入处理队列
+func PendingPreviewIds() ([]int, error) {
+	ids := make([]int, 0)
+	err := DB.Model(&Attachment{}).Where("mime IN ? AND processed_at IS NULL", []string{"image/jpeg", "image/png", "image/gif"}).Pluck("id", &ids).Error
+	return ids, err
+}
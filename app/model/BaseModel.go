@@ -4,8 +4,17 @@ import (
 	"fmt"
 	"github.com/go-ini/ini"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/driver/sqlserver"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+	"log"
+	"net/url"
+	"os"
 	"strings"
+	"time"
 )
 
 type BaseModel struct {}
@@ -13,29 +22,121 @@ type BaseModel struct {}
 var DB *gorm.DB
 
 func InitDB(cfg *ini.File) (*gorm.DB, error) {
-	driver := strings.ToLower(cfg.Section(ini.DefaultSection).Key("DB_CONNECTION").MustString("mysql"))
-	host := cfg.Section(ini.DefaultSection).Key("DB_HOST").MustString("127.0.0.1")
-	port := cfg.Section(ini.DefaultSection).Key("DB_PORT").MustString("3306")
-	database := cfg.Section(ini.DefaultSection).Key("DB_DATABASE").MustString("forge")
-	username := cfg.Section(ini.DefaultSection).Key("DB_USERNAME").MustString("forge")
-	password := cfg.Section(ini.DefaultSection).Key("DB_PASSWORD").MustString("")
+	db, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	DB = db
+	return DB, nil
+}
+
+// 按配置打开数据库连接，所有表名（包括多对多的关联表）统一加上 DB_PREFIX 前缀
+func Open(cfg *ini.File) (*gorm.DB, error) {
+	dialector, err := Dialector(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dbLogger, err := Logger(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	section := cfg.Section(ini.DefaultSection)
+	db, err := gorm.Open(dialector, &gorm.Config{
+		NamingStrategy: schema.NamingStrategy{
+			TablePrefix: section.Key("DB_PREFIX").MustString(""),
+		},
+		Logger: dbLogger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Database connection failed error:  %v", err)
+	}
+
+	// 连接池配置，连接的最大存活、空闲时间需要小于数据库或代理断开空闲连接的时间，否则会拿到已失效的连接
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(section.Key("DB_MAX_OPEN_CONNS").MustInt(100))
+	sqlDB.SetMaxIdleConns(section.Key("DB_MAX_IDLE_CONNS").MustInt(10))
+	sqlDB.SetConnMaxLifetime(time.Duration(section.Key("DB_CONN_MAX_LIFETIME").MustInt(3600)) * time.Second)
+	sqlDB.SetConnMaxIdleTime(time.Duration(section.Key("DB_CONN_MAX_IDLE_TIME").MustInt(300)) * time.Second)
+
+	return db, nil
+}
+
+// 按 DB_LOG_LEVEL、DB_SLOW_THRESHOLD 构造 SQL 日志，执行时间超过阈值的 SQL 以慢查询记录
+func Logger(cfg *ini.File) (logger.Interface, error) {
+	section := cfg.Section(ini.DefaultSection)
+
+	var level logger.LogLevel
+	switch strings.ToLower(section.Key("DB_LOG_LEVEL").MustString("warn")) {
+	case "silent":
+		level = logger.Silent
+	case "error":
+		level = logger.Error
+	case "warn":
+		level = logger.Warn
+	case "info":
+		level = logger.Info
+	default:
+		return nil, fmt.Errorf("%v database log level is not supported", section.Key("DB_LOG_LEVEL").String())
+	}
+
+	return logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
+		SlowThreshold:             time.Duration(section.Key("DB_SLOW_THRESHOLD").MustInt(200)) * time.Millisecond,
+		LogLevel:                  level,
+		IgnoreRecordNotFoundError: true,
+	}), nil
+}
+
+// 根据 DB_CONNECTION 构造对应数据库的驱动
+func Dialector(cfg *ini.File) (gorm.Dialector, error) {
+	section := cfg.Section(ini.DefaultSection)
+	driver := strings.ToLower(section.Key("DB_CONNECTION").MustString("mysql"))
+	host := section.Key("DB_HOST").MustString("127.0.0.1")
+	database := section.Key("DB_DATABASE").MustString("forge")
+	username := section.Key("DB_USERNAME").MustString("forge")
+	password := section.Key("DB_PASSWORD").MustString("")
 
 	switch driver {
 	case "mysql":
+		port := section.Key("DB_PORT").MustString("3306")
 		dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", username, password, host, port, database)
-		var err error
-		DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
-		if err != nil {
-			return nil, fmt.Errorf("Database connection failed error:  %v", err)
-		}
+		return mysql.Open(dsn), nil
 
 	case "sqlserver":
+		port := section.Key("DB_PORT").MustString("1433")
+		dsn := url.URL{
+			Scheme:   "sqlserver",
+			User:     url.UserPassword(username, password),
+			Host:     fmt.Sprintf("%s:%s", host, port),
+			RawQuery: url.Values{"database": {database}}.Encode(),
+		}
+		return sqlserver.Open(dsn.String()), nil
 
 	case "postgres", "postgre", "postgresql":
+		port := section.Key("DB_PORT").MustString("5432")
+		dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s TimeZone=%s",
+			pgQuote(host), pgQuote(port), pgQuote(username), pgQuote(password), pgQuote(database),
+			pgQuote(section.Key("DB_SSLMODE").MustString("disable")),
+			pgQuote(section.Key("DB_TIMEZONE").MustString("Asia/Shanghai")),
+		)
+		return postgres.Open(dsn), nil
+
+	case "sqlite", "sqlite3":
+		// DB_DATABASE 为数据库文件路径，:memory: 为内存数据库
+		return sqlite.Open(database), nil
 
 	default:
 		return nil, fmt.Errorf("%v SQL database type is not supported", driver)
 	}
+}
 
-	return DB, nil
-}
\ No newline at end of file
+// 按 libpq 连接串规则给参数值加引号，避免密码中的空格、引号等字符破坏连接串
+func pgQuote(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+	return "'" + value + "'"
+}
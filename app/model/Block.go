@@ -0,0 +1,89 @@
+package model
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+var ErrNotBlocked = errors.New("user is not blocked")
+
+// 黑名单，UserId 把 BlockedId 拉黑
+type Block struct {
+	Id        int       `gorm:"primary_key" json:"id"`
+	UserId    int       `json:"user_id"`
+	BlockedId int       `json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Blocked   *User     `gorm:"foreignKey:BlockedId" json:"blocked,omitempty"`
+}
+
+// 拉黑用户，同时作废双方之间待处理的好友申请
+func BlockUser(userId, blockedId int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Block{}).Where("user_id = ? AND blocked_id = ?", userId, blockedId).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			if err := tx.Create(&Block{UserId: userId, BlockedId: blockedId}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&FriendRequest{}).
+			Where("from_id = ? AND to_id = ? AND status = ?", userId, blockedId, FriendRequestPending).
+			Update("status", FriendRequestCanceled).Error; err != nil {
+			return err
+		}
+		return tx.Model(&FriendRequest{}).
+			Where("from_id = ? AND to_id = ? AND status = ?", blockedId, userId, FriendRequestPending).
+			Update("status", FriendRequestRejected).Error
+	})
+}
+
+// 取消拉黑
+func UnblockUser(userId, blockedId int) error {
+	result := DB.Where("user_id = ? AND blocked_id = ?", userId, blockedId).Delete(&Block{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotBlocked
+	}
+	return nil
+}
+
+// 黑名单列表
+func Blocks(userId int) ([]Block, error) {
+	blocks := make([]Block, 0)
+	err := DB.Preload("Blocked", selectProfile).Where("user_id = ?", userId).Order("id DESC").Find(&blocks).Error
+	return blocks, err
+}
+
+// 判断 userId 是否拉黑了 blockedId
+func IsBlocked(userId, blockedId int) (bool, error) {
+	var count int64
+	err := DB.Model(&Block{}).Where("user_id = ? AND blocked_id = ?", userId, blockedId).Count(&count).Error
+	return count > 0, err
+}
+
+// 被 userId 拉黑的全部用户ID
+func BlockedIds(userId int) ([]int, error) {
+	ids := make([]int, 0)
+	err := DB.Model(&Block{}).Where("user_id = ?", userId).Pluck("blocked_id", &ids).Error
+	return ids, err
+}
+
+// 被 userId 拉黑的用户ID，用作子查询
+func blockedBy(userId int) *gorm.DB {
+	return DB.Model(&Block{}).Select("blocked_id").Where("user_id = ?", userId)
+}
+
+// 在 userIds 中找出拉黑了 blockedId 的用户，用于群消息扇出时过滤
+func BlockersOf(blockedId int, userIds []int) ([]int, error) {
+	blockers := make([]int, 0)
+	if len(userIds) == 0 {
+		return blockers, nil
+	}
+	err := DB.Model(&Block{}).Where("blocked_id = ? AND user_id IN ?", blockedId, userIds).Pluck("user_id", &blockers).Error
+	return blockers, err
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"time"
+)
+
+// 会话类型
+const (
+	ConversationDirect uint8 = 1 // 单聊
+	ConversationGroup  uint8 = 2 // 群聊
+	ConversationThread uint8 = 3 // 群聊中某条消息下的话题
+)
+
+// 会话，单聊时 UserId 固定为较小的用户ID、PeerId 为较大的用户ID，保证两人之间只有一个会话
+type Conversation struct {
+	Id            int       `gorm:"primary_key" json:"id"`
+	Type          uint8     `gorm:"uniqueIndex:idx_conversation_members" json:"type"`
+	UserId        int       `gorm:"uniqueIndex:idx_conversation_members" json:"user_id"`
+	PeerId        int       `gorm:"uniqueIndex:idx_conversation_members" json:"peer_id"`
+	GroupId       int       `gorm:"uniqueIndex:idx_conversation_members" json:"group_id"`
+	RootMessageId int       `gorm:"uniqueIndex:idx_conversation_members" json:"root_message_id,omitempty"` // 话题的根消息ID
+	LastMessageId int       `json:"last_message_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	LastMessage   *Message  `gorm:"foreignKey:LastMessageId" json:"last_message,omitempty"`
+}
+
+// 判断用户是否为会话成员
+func (c *Conversation) HasMember(userId int) bool {
+	switch c.Type {
+	case ConversationDirect:
+		return c.UserId == userId || c.PeerId == userId
+	case ConversationGroup, ConversationThread:
+		return IsGroupMember(c.GroupId, userId)
+	default:
+		return false
+	}
+}
+
+// 用户的会话列表：参与的单聊和所在群的群聊，按最后活动时间倒序
+func UserConversations(userId int) ([]Conversation, error) {
+	conversations := make([]Conversation, 0)
+	groupIds := DB.Model(&GroupMember{}).Select("group_id").Where("user_id = ?", userId)
+	err := DB.Preload("LastMessage").
+		Where("type = ? AND (user_id = ? OR peer_id = ?)", ConversationDirect, userId, userId).
+		Or("type = ? AND group_id IN (?)", ConversationGroup, groupIds).
+		Order("updated_at DESC").
+		Find(&conversations).Error
+	return conversations, err
+}
+
+// 查找两个用户之间的单聊会话，不存在时返回 gorm.ErrRecordNotFound
+func FindDirectConversation(userId, peerId int) (*Conversation, error) {
+	if userId > peerId {
+		userId, peerId = peerId, userId
+	}
+
+	conv := &Conversation{}
+	if err := DB.Where("type = ? AND user_id = ? AND peer_id = ?", ConversationDirect, userId, peerId).First(conv).Error; err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// 获取两个用户之间的单聊会话，不存在时创建
+func DirectConversation(userId, peerId int) (*Conversation, error) {
+	if userId > peerId {
+		userId, peerId = peerId, userId
+	}
+
+	conv := &Conversation{}
+	err := DB.Where(Conversation{Type: ConversationDirect, UserId: userId, PeerId: peerId}).
+		Attrs(Conversation{CreatedAt: time.Now(), UpdatedAt: time.Now()}).
+		FirstOrCreate(conv).Error
+	if err != nil {
+		// 并发创建时唯一索引冲突，重新查询一次
+		return FindDirectConversation(userId, peerId)
+	}
+	return conv, nil
+}
@@ -0,0 +1,346 @@
+package model
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// 好友申请状态
+const (
+	FriendRequestPending  uint8 = 0 // 等待处理
+	FriendRequestAccepted uint8 = 1 // 已同意
+	FriendRequestRejected uint8 = 2 // 已拒绝
+	FriendRequestCanceled uint8 = 3 // 申请人已撤回
+)
+
+var (
+	ErrAlreadyFriends        = errors.New("users are already friends")
+	ErrFriendRequestNotFound = errors.New("friend request not found or already handled")
+	ErrNotFriends            = errors.New("users are not friends")
+	ErrContactGroupNotFound  = errors.New("contact group not found")
+)
+
+// 好友申请
+type FriendRequest struct {
+	Id        int       `gorm:"primary_key" json:"id"`
+	FromId    int       `json:"from_id"`
+	ToId      int       `json:"to_id"`
+	Message   string    `gorm:"size:255" json:"message"` // 验证信息
+	Status    uint8     `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	From      *User     `gorm:"foreignKey:FromId" json:"from,omitempty"`
+	To        *User     `gorm:"foreignKey:ToId" json:"to,omitempty"`
+}
+
+// 好友关系，双向各保存一条，备注和分组只对 UserId 自己可见
+type Friend struct {
+	Id             int       `gorm:"primary_key" json:"id"`
+	UserId         int       `json:"user_id"`
+	FriendId       int       `json:"friend_id"`
+	Remark         string    `gorm:"size:64" json:"remark"` // 备注名
+	ContactGroupId int       `json:"contact_group_id"`      // 所在分组，0 为未分组
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	User           *User     `gorm:"foreignKey:FriendId" json:"user,omitempty"`
+}
+
+// 用户自定义的好友分组
+type ContactGroup struct {
+	Id        int       `gorm:"primary_key" json:"id"`
+	UserId    int       `json:"user_id"`
+	Name      string    `gorm:"size:32" json:"name"`
+	Sort      int       `json:"sort"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// 对外展示的用户资料，不包含邮箱等隐私信息
+type UserProfile struct {
+	Id       int    `json:"id"`
+	Username string `json:"username"`
+	Nickname string `json:"nickname"`
+}
+
+// 预加载关联用户时只查询公开字段
+func selectProfile(db *gorm.DB) *gorm.DB {
+	return db.Select("id", "username", "nickname")
+}
+
+// 判断两个用户是否为好友
+func AreFriends(userId, friendId int) bool {
+	var count int64
+	DB.Model(&Friend{}).Where("user_id = ? AND friend_id = ?", userId, friendId).Count(&count)
+	return count > 0
+}
+
+// 用户的全部好友ID
+func FriendIds(userId int) ([]int, error) {
+	ids := make([]int, 0)
+	err := DB.Model(&Friend{}).Where("user_id = ?", userId).Pluck("friend_id", &ids).Error
+	return ids, err
+}
+
+/**
+ * 发送好友申请，对方也向自己发过申请时直接成为好友
+ * @return bool accepted 是否因对方的申请直接成为好友
+ */
+func SendFriendRequest(fromId, toId int, message string) (*FriendRequest, bool, error) {
+	if AreFriends(fromId, toId) {
+		return nil, false, ErrAlreadyFriends
+	}
+
+	reverse := &FriendRequest{}
+	err := DB.Where("from_id = ? AND to_id = ? AND status = ?", toId, fromId, FriendRequestPending).Order("id DESC").First(reverse).Error
+	if err == nil {
+		accepted, err := AcceptFriendRequest(reverse.Id, fromId, 0, "")
+		return accepted, err == nil, err
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, false, err
+	}
+
+	// 已有待处理的申请时只更新验证信息，避免重复申请
+	request := &FriendRequest{}
+	err = DB.Where("from_id = ? AND to_id = ? AND status = ?", fromId, toId, FriendRequestPending).First(request).Error
+	if err == nil {
+		err = DB.Model(request).Updates(map[string]interface{}{"message": message, "updated_at": time.Now()}).Error
+		request.Message = message
+		return request, false, err
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, false, err
+	}
+
+	request = &FriendRequest{FromId: fromId, ToId: toId, Message: message, Status: FriendRequestPending}
+	if err := DB.Create(request).Error; err != nil {
+		return nil, false, err
+	}
+	return request, false, nil
+}
+
+/**
+ * 同意好友申请，只有接收人可以操作
+ * @param int contactGroupId 把对方放入的分组
+ * @param string remark 给对方的备注名
+ */
+func AcceptFriendRequest(id, userId, contactGroupId int, remark string) (*FriendRequest, error) {
+	request := &FriendRequest{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND to_id = ? AND status = ?", id, userId, FriendRequestPending).First(request).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrFriendRequestNotFound
+			}
+			return err
+		}
+
+		result := tx.Model(request).Where("status = ?", FriendRequestPending).Update("status", FriendRequestAccepted)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return ErrFriendRequestNotFound
+		}
+
+		friends := []Friend{
+			{UserId: request.ToId, FriendId: request.FromId, Remark: remark, ContactGroupId: contactGroupId},
+			{UserId: request.FromId, FriendId: request.ToId},
+		}
+		for i := range friends {
+			var count int64
+			if err := tx.Model(&Friend{}).Where("user_id = ? AND friend_id = ?", friends[i].UserId, friends[i].FriendId).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+			if err := tx.Create(&friends[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// 拒绝好友申请，只有接收人可以操作
+func RejectFriendRequest(id, userId int) (*FriendRequest, error) {
+	return finishFriendRequest("id = ? AND to_id = ? AND status = ?", id, userId, FriendRequestRejected)
+}
+
+// 撤回好友申请，只有申请人可以操作
+func CancelFriendRequest(id, userId int) (*FriendRequest, error) {
+	return finishFriendRequest("id = ? AND from_id = ? AND status = ?", id, userId, FriendRequestCanceled)
+}
+
+func finishFriendRequest(query string, id, userId int, status uint8) (*FriendRequest, error) {
+	request := &FriendRequest{}
+	if err := DB.Where(query, id, userId, FriendRequestPending).First(request).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrFriendRequestNotFound
+		}
+		return nil, err
+	}
+
+	result := DB.Model(request).Where("status = ?", FriendRequestPending).Update("status", status)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return nil, ErrFriendRequestNotFound
+	}
+	return request, nil
+}
+
+// 收到的待处理好友申请，离线期间收到的申请也从这里获取
+func ReceivedFriendRequests(userId int) ([]FriendRequest, error) {
+	requests := make([]FriendRequest, 0)
+	err := DB.Preload("From", selectProfile).
+		Where("to_id = ? AND status = ?", userId, FriendRequestPending).
+		Order("id DESC").Find(&requests).Error
+	return requests, err
+}
+
+// 发出的好友申请，包括已处理的
+func SentFriendRequests(userId, limit int) ([]FriendRequest, error) {
+	requests := make([]FriendRequest, 0)
+	err := DB.Preload("To", selectProfile).
+		Where("from_id = ?", userId).
+		Order("id DESC").Limit(limit).Find(&requests).Error
+	return requests, err
+}
+
+// 好友列表
+func Friends(userId int) ([]Friend, error) {
+	friends := make([]Friend, 0)
+	err := DB.Preload("User", selectProfile).Where("user_id = ?", userId).Order("id ASC").Find(&friends).Error
+	return friends, err
+}
+
+// 修改好友备注和分组
+func UpdateFriend(userId, friendId int, remark string, contactGroupId int) error {
+	if contactGroupId > 0 {
+		if _, err := FindContactGroup(userId, contactGroupId); err != nil {
+			return err
+		}
+	}
+
+	result := DB.Model(&Friend{}).Where("user_id = ? AND friend_id = ?", userId, friendId).
+		Updates(map[string]interface{}{"remark": remark, "contact_group_id": contactGroupId, "updated_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFriends
+	}
+	return nil
+}
+
+// 删除好友，双方的好友关系同时删除
+func DeleteFriend(userId, friendId int) error {
+	result := DB.Where("(user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)", userId, friendId, friendId, userId).Delete(&Friend{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFriends
+	}
+	return nil
+}
+
+// 用户的好友分组，按 sort 升序排列
+func ContactGroups(userId int) ([]ContactGroup, error) {
+	groups := make([]ContactGroup, 0)
+	err := DB.Where("user_id = ?", userId).Order("sort ASC, id ASC").Find(&groups).Error
+	return groups, err
+}
+
+// 获取用户自己的分组
+func FindContactGroup(userId, id int) (*ContactGroup, error) {
+	group := &ContactGroup{}
+	if err := DB.Where("id = ? AND user_id = ?", id, userId).First(group).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrContactGroupNotFound
+		}
+		return nil, err
+	}
+	return group, nil
+}
+
+// 新建分组，排在最后
+func CreateContactGroup(userId int, name string) (*ContactGroup, error) {
+	var maxSort int
+	if err := DB.Model(&ContactGroup{}).Where("user_id = ?", userId).Select("COALESCE(MAX(sort), 0)").Scan(&maxSort).Error; err != nil {
+		return nil, err
+	}
+
+	group := &ContactGroup{UserId: userId, Name: name, Sort: maxSort + 1}
+	if err := DB.Create(group).Error; err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// 重命名分组
+func RenameContactGroup(userId, id int, name string) error {
+	result := DB.Model(&ContactGroup{}).Where("id = ? AND user_id = ?", id, userId).Update("name", name)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrContactGroupNotFound
+	}
+	return nil
+}
+
+// 按给定的分组ID顺序重新排序，不属于该用户的ID会被忽略
+func SortContactGroups(userId int, ids []int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for i, id := range ids {
+			if err := tx.Model(&ContactGroup{}).Where("id = ? AND user_id = ?", id, userId).Update("sort", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 删除分组，组内好友移到未分组
+func DeleteContactGroup(userId, id int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", id, userId).Delete(&ContactGroup{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrContactGroupNotFound
+		}
+		return tx.Model(&Friend{}).Where("user_id = ? AND contact_group_id = ?", userId, id).Update("contact_group_id", 0).Error
+	})
+}
+
+/**
+ * 搜索用户，用户名、昵称前缀匹配，邮箱需要完全一致，避免通过模糊搜索批量获取邮箱
+ * @param string keyword 关键字
+ * @param int excludeId 排除的用户ID，一般为当前用户
+ */
+func SearchUsers(keyword string, excludeId, limit int) ([]UserProfile, error) {
+	users := make([]UserProfile, 0)
+	keyword = strings.TrimSpace(keyword)
+	if keyword == "" {
+		return users, nil
+	}
+
+	// 用 ! 作为 LIKE 的转义符，各数据库对反斜杠的处理不一致
+	like := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(keyword) + "%"
+	err := DB.Model(&User{}).Select("id", "username", "nickname").
+		Where("activate = ? AND id <> ?", UserActive, excludeId).
+		Where(DB.Where("username LIKE ? ESCAPE '!'", like).Or("nickname LIKE ? ESCAPE '!'", like).Or("email = ?", keyword)).
+		Order("id ASC").Limit(limit).Scan(&users).Error
+	return users, err
+}
@@ -0,0 +1,257 @@
+package model
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// 群成员角色
+const (
+	GroupRoleMember uint8 = 1 // 普通成员
+	GroupRoleAdmin  uint8 = 2 // 管理员
+	GroupRoleOwner  uint8 = 3 // 群主
+)
+
+var (
+	ErrNotGroupMember = errors.New("user is not a member of the group")
+	ErrGroupFull      = errors.New("group member limit exceeded")
+)
+
+// 群聊，解散后软删除，聊天记录保留
+type Group struct {
+	Id          int            `gorm:"primary_key" json:"id"`
+	Name        string         `gorm:"size:64" json:"name"`
+	Avatar      string         `gorm:"size:255" json:"avatar"`
+	Notice      string         `gorm:"size:1024" json:"notice"` // 群公告
+	OwnerId     int            `json:"owner_id"`
+	MemberCount int            `json:"member_count"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// 群成员
+type GroupMember struct {
+	Id        int       `gorm:"primary_key" json:"id"`
+	GroupId   int       `json:"group_id"`
+	UserId    int       `json:"user_id"`
+	Role      uint8     `json:"role"`
+	Muted     bool      `json:"-"` // 消息免打扰，被 @ 时仍然提醒
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	User      *User     `gorm:"foreignKey:UserId" json:"user,omitempty"`
+}
+
+// 是否为群主或管理员
+func (m *GroupMember) IsManager() bool {
+	return m.Role == GroupRoleOwner || m.Role == GroupRoleAdmin
+}
+
+/**
+ * 创建群聊，创建者成为群主，同时创建群会话
+ * @param int ownerId 群主ID
+ * @param string name 群名称
+ * @param []int memberIds 初始成员ID，不需要包含群主
+ */
+func CreateGroup(ownerId int, name string, memberIds []int) (*Group, error) {
+	group := &Group{Name: name, OwnerId: ownerId}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(group).Error; err != nil {
+			return err
+		}
+
+		members := []GroupMember{{GroupId: group.Id, UserId: ownerId, Role: GroupRoleOwner}}
+		for _, userId := range memberIds {
+			if userId != ownerId {
+				members = append(members, GroupMember{GroupId: group.Id, UserId: userId, Role: GroupRoleMember})
+			}
+		}
+		if err := tx.Create(&members).Error; err != nil {
+			return err
+		}
+
+		group.MemberCount = len(members)
+		if err := tx.Model(group).Update("member_count", group.MemberCount).Error; err != nil {
+			return err
+		}
+		return tx.Create(&Conversation{Type: ConversationGroup, GroupId: group.Id}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// 获取用户在群中的成员信息，不是成员时返回 ErrNotGroupMember
+func FindGroupMember(groupId, userId int) (*GroupMember, error) {
+	member := &GroupMember{}
+	err := DB.Where("group_id = ? AND user_id = ?", groupId, userId).First(member).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrNotGroupMember
+	}
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// 判断用户是否为群成员
+func IsGroupMember(groupId, userId int) bool {
+	_, err := FindGroupMember(groupId, userId)
+	return err == nil
+}
+
+// 群成员ID列表，用于消息扇出
+func GroupMemberIds(groupId int) ([]int, error) {
+	var ids []int
+	err := DB.Model(&GroupMember{}).Where("group_id = ?", groupId).Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// 群成员列表，按角色、入群时间排序
+func GroupMembers(groupId int) ([]GroupMember, error) {
+	members := make([]GroupMember, 0)
+	err := DB.Preload("User", selectProfile).Where("group_id = ?", groupId).Order("role DESC, id ASC").Find(&members).Error
+	return members, err
+}
+
+// 用户加入的群聊
+func UserGroups(userId int) ([]Group, error) {
+	groups := make([]Group, 0)
+	sub := DB.Model(&GroupMember{}).Select("group_id").Where("user_id = ?", userId)
+	err := DB.Where("id IN (?)", sub).Order("id DESC").Find(&groups).Error
+	return groups, err
+}
+
+/**
+ * 邀请成员入群，已在群中的用户会被忽略
+ * @param int limit 群人数上限，0 为不限制
+ * @return []int 实际新加入的用户ID
+ */
+func AddGroupMembers(groupId int, userIds []int, limit int) ([]int, error) {
+	added := make([]int, 0, len(userIds))
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var existing []int
+		if err := tx.Model(&GroupMember{}).Where("group_id = ? AND user_id IN ?", groupId, userIds).Pluck("user_id", &existing).Error; err != nil {
+			return err
+		}
+		skip := make(map[int]bool, len(existing))
+		for _, id := range existing {
+			skip[id] = true
+		}
+
+		members := make([]GroupMember, 0, len(userIds))
+		for _, userId := range userIds {
+			if !skip[userId] {
+				members = append(members, GroupMember{GroupId: groupId, UserId: userId, Role: GroupRoleMember})
+				added = append(added, userId)
+			}
+		}
+		if len(members) == 0 {
+			return nil
+		}
+		if err := tx.Create(&members).Error; err != nil {
+			return err
+		}
+
+		// 条件更新人数，并发邀请时也不会超过上限
+		query := tx.Model(&Group{}).Where("id = ?", groupId)
+		if limit > 0 {
+			query = query.Where("member_count + ? <= ?", len(members), limit)
+		}
+		result := query.Update("member_count", gorm.Expr("member_count + ?", len(members)))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return ErrGroupFull
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// 移除群成员，用于踢人和退群
+func RemoveGroupMember(groupId, userId int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("group_id = ? AND user_id = ?", groupId, userId).Delete(&GroupMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotGroupMember
+		}
+		return tx.Model(&Group{}).Where("id = ?", groupId).Update("member_count", gorm.Expr("member_count - 1")).Error
+	})
+}
+
+// 设置成员角色，只能在普通成员和管理员之间切换
+func SetGroupMemberRole(groupId, userId int, role uint8) error {
+	result := DB.Model(&GroupMember{}).
+		Where("group_id = ? AND user_id = ? AND role <> ?", groupId, userId, GroupRoleOwner).
+		Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotGroupMember
+	}
+	return nil
+}
+
+// 转让群主，原群主降为管理员
+func TransferGroupOwner(groupId, fromId, toId int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&GroupMember{}).Where("group_id = ? AND user_id = ?", groupId, toId).Update("role", GroupRoleOwner)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotGroupMember
+		}
+		if err := tx.Model(&GroupMember{}).Where("group_id = ? AND user_id = ?", groupId, fromId).Update("role", GroupRoleAdmin).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Group{}).Where("id = ?", groupId).Update("owner_id", toId).Error
+	})
+}
+
+// 解散群聊，删除全部成员关系，群本身软删除
+func DissolveGroup(groupId int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", groupId).Delete(&GroupMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Group{}, groupId).Error
+	})
+}
+
+// 获取群会话，不存在时创建
+func GroupConversation(groupId int) (*Conversation, error) {
+	conv := &Conversation{}
+	err := DB.Where(Conversation{Type: ConversationGroup, GroupId: groupId}).FirstOrCreate(conv).Error
+	if err != nil {
+		// 并发创建时唯一索引冲突，重新查询一次
+		err = DB.Where("type = ? AND group_id = ?", ConversationGroup, groupId).First(conv).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// 群里设置了消息免打扰的成员ID
+func MutedMemberIds(groupId int) ([]int, error) {
+	ids := make([]int, 0)
+	err := DB.Model(&GroupMember{}).Where("group_id = ? AND muted = ?", groupId, true).Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// 设置群消息免打扰
+func MuteGroup(groupId, userId int, muted bool) error {
+	return DB.Model(&GroupMember{}).Where("group_id = ? AND user_id = ?", groupId, userId).Update("muted", muted).Error
+}
@@ -0,0 +1,161 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"github.com/go-ini/ini"
+	"gorm.io/gorm"
+	"log"
+	"sync"
+	"time"
+)
+
+// 就绪检查接口不需要登录，不返回数据库驱动的原始错误，避免暴露地址、账号等信息，原始错误只记录到日志
+const healthError = "database is unavailable"
+
+// 数据库健康状态
+type HealthStatus struct {
+	Healthy         bool      `json:"healthy"`
+	Error           string    `json:"error,omitempty"`
+	Failures        int       `json:"failures"`         // 连续失败次数
+	CheckedAt       time.Time `json:"checked_at"`       // 最近一次检查时间
+	OpenConnections int       `json:"open_connections"` // 连接池中的连接数
+	InUse           int       `json:"in_use"`
+	Idle            int       `json:"idle"`
+}
+
+// 定时 Ping 数据库，失败时清理空闲连接并按指数退避重试，供就绪检查接口查询状态
+type HealthChecker struct {
+	db         *sql.DB
+	interval   time.Duration // 正常状态下的检查间隔
+	timeout    time.Duration // 单次 Ping 超时时间
+	maxBackoff time.Duration // 失败重试的最大间隔
+	maxIdle    int
+
+	mu     sync.RWMutex
+	status HealthStatus
+	quit   chan struct{}
+	done   chan struct{}
+}
+
+// 全局数据库健康检查，由 bootstrap 初始化
+var Checker *HealthChecker
+
+func NewHealthChecker(db *gorm.DB, cfg *ini.File) (*HealthChecker, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	section := cfg.Section(ini.DefaultSection)
+	return &HealthChecker{
+		db:         sqlDB,
+		interval:   time.Duration(section.Key("DB_PING_INTERVAL").MustInt(30)) * time.Second,
+		timeout:    time.Duration(section.Key("DB_PING_TIMEOUT").MustInt(3)) * time.Second,
+		maxBackoff: time.Duration(section.Key("DB_RECONNECT_MAX_BACKOFF").MustInt(60)) * time.Second,
+		maxIdle:    section.Key("DB_MAX_IDLE_CONNS").MustInt(10),
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// 启动健康检查，阻塞直到 Close
+func (h *HealthChecker) Run() {
+	defer close(h.done)
+
+	backoff := time.Second
+	for {
+		wait := h.interval
+		if err := h.check(); err != nil {
+			wait = backoff
+			log.Printf("数据库连接异常，%v 后重试: %v", wait, err)
+			if backoff *= 2; backoff > h.maxBackoff {
+				backoff = h.maxBackoff
+			}
+		} else {
+			backoff = time.Second
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-h.quit:
+			return
+		}
+	}
+}
+
+// 停止健康检查
+func (h *HealthChecker) Close() {
+	close(h.quit)
+	<-h.done
+}
+
+// 当前健康状态
+func (h *HealthChecker) Status() HealthStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.status
+}
+
+func (h *HealthChecker) check() error {
+	err := h.ping()
+	if err != nil {
+		// 空闲连接可能已被数据库或代理断开，清空后重新建立连接再试一次
+		h.db.SetMaxIdleConns(0)
+		h.db.SetMaxIdleConns(h.maxIdle)
+		err = h.ping()
+	}
+
+	stats := h.db.Stats()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status.CheckedAt = time.Now()
+	h.status.OpenConnections = stats.OpenConnections
+	h.status.InUse = stats.InUse
+	h.status.Idle = stats.Idle
+	if err != nil {
+		h.status.Healthy = false
+		h.status.Error = healthError
+		h.status.Failures++
+		return err
+	}
+	if h.status.Failures > 0 {
+		log.Printf("数据库连接已恢复")
+	}
+	h.status.Healthy = true
+	h.status.Error = ""
+	h.status.Failures = 0
+	return nil
+}
+
+func (h *HealthChecker) ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	return h.db.PingContext(ctx)
+}
+
+// 数据库健康状态，未启动健康检查时直接 Ping 一次
+func Health() HealthStatus {
+	if Checker != nil {
+		return Checker.Status()
+	}
+
+	status := HealthStatus{CheckedAt: time.Now()}
+	if DB == nil {
+		status.Error = "database is not initialized"
+		return status
+	}
+	sqlDB, err := DB.DB()
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		log.Printf("数据库健康检查失败: %v", err)
+		status.Error = healthError
+		return status
+	}
+	status.Healthy = true
+	return status
+}
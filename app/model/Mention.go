@@ -0,0 +1,144 @@
+package model
+
+import (
+	"gorm.io/gorm/clause"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 提及方式
+const (
+	MentionUser uint8 = 1 // @用户名
+	MentionAll  uint8 = 2 // @all，所有群成员，只有群主和管理员可以使用
+	MentionHere uint8 = 3 // @here，发送时在线的群成员
+)
+
+// @ 后面到空白或标点为止的部分，用户名本身不含这些字符时才能被提及
+var mentionPattern = regexp.MustCompile(`@([^\s@,，:：;；!！?？。、]+)`)
+
+// 群聊消息中对某个成员的提及，@all、@here 也按成员逐条记录，便于查询“提及我的”
+type Mention struct {
+	Id             int       `gorm:"primary_key" json:"id"`
+	MessageId      int       `json:"message_id"`
+	ConversationId int       `json:"conversation_id"`
+	GroupId        int       `json:"group_id"`
+	SenderId       int       `json:"sender_id"`
+	UserId         int       `json:"user_id"`
+	Kind           uint8     `json:"kind"`
+	CreatedAt      time.Time `json:"created_at"`
+	Message        *Message  `gorm:"foreignKey:MessageId" json:"message,omitempty"`
+	Sender         *User     `gorm:"foreignKey:SenderId" json:"sender,omitempty"`
+	Group          *Group    `gorm:"foreignKey:GroupId" json:"group,omitempty"`
+}
+
+// 消息内容中的提及，all、here 分别表示是否使用了 @all、@here
+type ParsedMentions struct {
+	Usernames []string
+	All       bool
+	Here      bool
+}
+
+// 解析消息内容中的提及，用户名去重，不区分 @all、@here 的大小写
+func ParseMentions(body string) ParsedMentions {
+	parsed := ParsedMentions{}
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		name := match[1]
+		switch strings.ToLower(name) {
+		case "all":
+			parsed.All = true
+		case "here":
+			parsed.Here = true
+		default:
+			if !seen[name] {
+				seen[name] = true
+				parsed.Usernames = append(parsed.Usernames, name)
+			}
+		}
+	}
+	return parsed
+}
+
+// 在群成员中按用户名查找被提及的用户ID
+func MentionedMemberIds(groupId int, usernames []string) ([]int, error) {
+	ids := make([]int, 0, len(usernames))
+	if len(usernames) == 0 {
+		return ids, nil
+	}
+	memberIds := DB.Model(&GroupMember{}).Select("user_id").Where("group_id = ?", groupId)
+	err := DB.Model(&User{}).Where("username IN ? AND id IN (?)", usernames, memberIds).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// 保存提及记录，userKinds 为被提及的用户ID => 提及方式
+func CreateMentions(msg *Message, userKinds map[int]uint8) error {
+	if len(userKinds) == 0 {
+		return nil
+	}
+	mentions := make([]Mention, 0, len(userKinds))
+	for userId, kind := range userKinds {
+		mentions = append(mentions, Mention{
+			MessageId:      msg.Id,
+			ConversationId: msg.ConversationId,
+			GroupId:        msg.GroupId,
+			SenderId:       msg.SenderId,
+			UserId:         userId,
+			Kind:           kind,
+			CreatedAt:      msg.CreatedAt,
+		})
+	}
+	return DB.CreateInBatches(mentions, 200).Error
+}
+
+/**
+ * 提及我的消息，按ID倒序分页，不包括已撤回、自己删除的消息和已退出的群
+ * @param int before 大于0时获取该提及记录之前的记录
+ * @return bool 是否还有更多记录
+ */
+func UserMentions(userId, before, limit int) ([]Mention, bool, error) {
+	groupIds := DB.Model(&GroupMember{}).Select("group_id").Where("user_id = ?", userId)
+	recalled := DB.Model(&Message{}).Select("id").Where("recalled_at IS NOT NULL")
+	query := DB.Preload("Message").Preload("Sender", selectProfile).Preload("Group").
+		Where("user_id = ? AND group_id IN (?)", userId, groupIds).
+		Where("message_id NOT IN (?) AND message_id NOT IN (?)", recalled, deletedBy(userId))
+	if before > 0 {
+		query = query.Where("id < ?", before)
+	}
+
+	mentions := make([]Mention, 0, limit+1)
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&mentions).Error; err != nil {
+		return nil, false, err
+	}
+	hasMore := len(mentions) > limit
+	if hasMore {
+		mentions = mentions[:limit]
+	}
+	return mentions, hasMore, nil
+}
+
+// 用户在多个会话中已读游标之后的提及数，会话ID => 提及数
+func UnreadMentionCounts(userId int, conversationIds []int) (map[int]int64, error) {
+	result := make(map[int]int64, len(conversationIds))
+	if len(conversationIds) == 0 {
+		return result, nil
+	}
+
+	var rows []struct {
+		ConversationId int
+		Mentions       int64
+	}
+	err := DB.Table("? AS m", clause.Table{Name: tableOf(&Mention{})}).
+		Select("m.conversation_id, COUNT(*) AS mentions").
+		Joins("LEFT JOIN ? AS r ON r.conversation_id = m.conversation_id AND r.user_id = m.user_id", clause.Table{Name: tableOf(&ReadCursor{})}).
+		Where("m.user_id = ? AND m.conversation_id IN ? AND m.message_id > COALESCE(r.read_message_id, 0)", userId, conversationIds).
+		Group("m.conversation_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		result[row.ConversationId] = row.Mentions
+	}
+	return result, nil
+}
@@ -0,0 +1,244 @@
+package model
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+var (
+	ErrNotMessageSender = errors.New("not the sender of the message")
+	ErrMessageRecalled  = errors.New("message has been recalled")
+	ErrRecallExpired    = errors.New("recall window has expired")
+	ErrNotEditable      = errors.New("message content type is not editable")
+	ErrInvalidReply     = errors.New("replied message is not in the conversation")
+	ErrBodyTooLong      = errors.New("message body is too long")
+)
+
+// 消息内容的最大字节数，MySQL TEXT 列最多保存 65535 字节，发送和编辑都按这个长度校验
+const MaxBodyLength = 65535
+
+// 消息内容类型
+const (
+	ContentText  = "text"  // 文本
+	ContentImage = "image" // 图片
+	ContentFile  = "file"  // 文件
+	ContentVoice = "voice" // 语音，附带一个语音文件
+)
+
+type Message struct {
+	Id             int            `gorm:"primary_key" json:"id"`
+	ConversationId int            `gorm:"index" json:"conversation_id"`
+	SenderId       int            `json:"sender_id"`
+	RecipientId    int            `json:"recipient_id"` // 单聊接收人
+	GroupId        int            `json:"group_id"`     // 群聊时为群ID
+	Body           string         `gorm:"type:text" json:"body"`
+	ContentType    string         `gorm:"size:32" json:"content_type"`
+	ClientId       *string        `gorm:"size:64" json:"client_id,omitempty"` // 客户端生成的消息ID，同一发送人唯一，用于重试去重
+	ReplyToId      int            `json:"reply_to_id,omitempty"`              // 引用回复的消息ID
+	ThreadId       int            `gorm:"index" json:"thread_id,omitempty"`   // 群聊话题中的消息为话题根消息的ID
+	EditedAt       *time.Time     `json:"edited_at,omitempty"`                // 最后一次编辑时间，编辑前的内容见 MessageRevision
+	RecalledAt     *time.Time     `json:"recalled_at,omitempty"`              // 撤回时间，撤回后内容清空
+	CreatedAt      time.Time      `json:"created_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+	ReplyTo        *Message       `gorm:"foreignKey:ReplyToId" json:"reply_to,omitempty"`
+	Reactions      []Reaction     `gorm:"-" json:"reactions,omitempty"` // 表情回应汇总
+	Thread         *ThreadSummary `gorm:"-" json:"thread,omitempty"`    // 以该消息为根的话题概况
+	Listened       *bool          `gorm:"-" json:"listened,omitempty"`  // 语音消息：接收人是否已听过，发送人看到的是是否有人听过
+	Attachments    []Attachment   `gorm:"foreignKey:MessageId" json:"attachments,omitempty"`
+	AttachmentIds  []int          `gorm:"-" json:"-"` // 发送时要关联的附件ID
+}
+
+/**
+ * 按消息ID游标分页获取会话的聊天记录，结果按消息ID升序排列，不包括用户自己删除的消息
+ * @param int userId 查看记录的用户
+ * @param int conversationId 会话ID
+ * @param int before 大于0时获取该消息之前的记录
+ * @param int after 大于0时获取该消息之后的记录，与 before 同时传入时以 before 为准
+ * @param int limit 每页条数
+ * @return bool 该方向上是否还有更多记录
+ */
+func MessageHistory(userId, conversationId, before, after, limit int) ([]Message, bool, error) {
+	// 群里被自己拉黑的人发的消息不显示，与实时推送保持一致
+	query := DB.Where("conversation_id = ?", conversationId).
+		Where("sender_id NOT IN (?)", blockedBy(userId)).
+		Where("id NOT IN (?)", deletedBy(userId))
+	desc := true
+	if before > 0 {
+		query = query.Where("id < ?", before)
+	} else if after > 0 {
+		query = query.Where("id > ?", after)
+		desc = false
+	}
+
+	if desc {
+		query = query.Order("id DESC")
+	} else {
+		query = query.Order("id ASC")
+	}
+
+	messages := make([]Message, 0, limit+1)
+	if err := query.Preload("ReplyTo", selectQuoted).Preload("Attachments", visibleAttachments).Limit(limit + 1).Find(&messages).Error; err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	if desc {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	if err := attachReactions(messages); err != nil {
+		return nil, false, err
+	}
+	if err := attachThreads(messages); err != nil {
+		return nil, false, err
+	}
+	if err := attachListens(userId, messages); err != nil {
+		return nil, false, err
+	}
+	return messages, hasMore, nil
+}
+
+// 保存一条单聊消息，需要填充 SenderId、RecipientId、Body、ContentType，可选 ClientId、ReplyToId
+func CreateDirectMessage(msg *Message) (*Message, error) {
+	conv, err := DirectConversation(msg.SenderId, msg.RecipientId)
+	if err != nil {
+		return nil, err
+	}
+	return saveMessage(conv, msg)
+}
+
+// 保存一条群聊消息，ThreadId 大于0时保存到该消息的话题中，其余同 CreateDirectMessage
+func CreateGroupMessage(msg *Message) (*Message, error) {
+	var (
+		conv *Conversation
+		err  error
+	)
+	if msg.ThreadId > 0 {
+		conv, err = ThreadConversation(msg.GroupId, msg.ThreadId)
+	} else {
+		conv, err = GroupConversation(msg.GroupId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return saveMessage(conv, msg)
+}
+
+// 保存消息并更新会话的最后一条消息，ClientId 为空时不去重
+func saveMessage(conv *Conversation, msg *Message) (*Message, error) {
+	if len(msg.Body) > MaxBodyLength {
+		return nil, ErrBodyTooLong
+	}
+	if msg.ReplyToId > 0 {
+		target := &Message{}
+		if err := DB.Select("id", "conversation_id").First(target, msg.ReplyToId).Error; err != nil {
+			return nil, ErrInvalidReply
+		}
+		// 只能引用同一会话中的消息，话题中还可以引用话题的根消息
+		if target.ConversationId != conv.Id && target.Id != msg.ThreadId {
+			return nil, ErrInvalidReply
+		}
+	}
+
+	var attachments []Attachment
+	if len(msg.AttachmentIds) > 0 {
+		var err error
+		if attachments, err = pendingAttachments(msg); err != nil {
+			return nil, err
+		}
+	}
+
+	msg.ConversationId = conv.Id
+	msg.CreatedAt = time.Now()
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Attachments").Create(msg).Error; err != nil {
+			return err
+		}
+		if len(attachments) > 0 {
+			if err := claimAttachments(tx, msg, attachments); err != nil {
+				return err
+			}
+			if msg.GroupId > 0 {
+				if err := reserveGroupStorage(tx, msg.GroupId, attachments); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Model(conv).Updates(map[string]interface{}{"last_message_id": msg.Id, "updated_at": time.Now()}).Error
+	})
+	if err != nil {
+		// 同一条消息并发重试时唯一索引冲突，返回已保存的消息
+		if msg.ClientId != nil {
+			if saved, findErr := FindClientMessage(msg.SenderId, *msg.ClientId); findErr == nil {
+				return saved, nil
+			}
+		}
+		return nil, err
+	}
+	msg.Attachments = attachments
+	return msg, nil
+}
+
+// 被引用的消息只返回展示引用所需的字段
+func selectQuoted(db *gorm.DB) *gorm.DB {
+	return db.Select("id", "conversation_id", "sender_id", "body", "content_type", "recalled_at", "created_at")
+}
+
+// 按客户端消息ID查找发送人已保存的消息，不存在时返回 gorm.ErrRecordNotFound
+func FindClientMessage(senderId int, clientId string) (*Message, error) {
+	msg := &Message{}
+	if err := DB.Preload("Attachments", visibleAttachments).Where("sender_id = ? AND client_id = ?", senderId, clientId).First(msg).Error; err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+/**
+ * 获取用户错过的消息，用于断线重连后补发，结果按消息ID升序排列
+ * @param int conversationId 大于0时只获取该会话，否则获取用户参与的全部会话
+ * @param int after 客户端已收到的最后一条消息ID
+ * @param int limit 每批条数
+ * @return bool 是否还有更多消息
+ */
+func MissedMessages(userId, conversationId, after, limit int) ([]Message, bool, error) {
+	query := DB.Where("id > ?", after)
+	if conversationId > 0 {
+		query = query.Where("conversation_id = ?", conversationId)
+	} else {
+		groupIds := DB.Model(&GroupMember{}).Select("group_id").Where("user_id = ?", userId)
+		conversationIds := DB.Model(&Conversation{}).Select("id").
+			Where("type = ? AND (user_id = ? OR peer_id = ?)", ConversationDirect, userId, userId).
+			Or("type IN (?, ?) AND group_id IN (?)", ConversationGroup, ConversationThread, groupIds)
+		query = query.Where("conversation_id IN (?)", conversationIds)
+	}
+
+	// 群里被自己拉黑的人发的消息不补发，与实时推送保持一致
+	query = query.Where("sender_id NOT IN (?)", blockedBy(userId)).Where("id NOT IN (?)", deletedBy(userId))
+
+	messages := make([]Message, 0, limit+1)
+	if err := query.Preload("Attachments", visibleAttachments).Order("id ASC").Limit(limit + 1).Find(&messages).Error; err != nil {
+		return nil, false, err
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	if err := attachListens(userId, messages); err != nil {
+		return nil, false, err
+	}
+	return messages, hasMore, nil
+}
+
+// 可以为空的字符串字段，空字符串保存为 NULL
+func NullableString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
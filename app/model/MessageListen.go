@@ -0,0 +1,83 @@
+package model
+
+import (
+	"errors"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var ErrNotVoiceMessage = errors.New("message is not a voice message")
+
+// 接收人收听语音消息的记录，每人每条消息只记录第一次收听
+type MessageListen struct {
+	Id        int       `gorm:"primary_key" json:"-"`
+	MessageId int       `json:"message_id"`
+	UserId    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	User      *User     `gorm:"foreignKey:UserId" json:"user,omitempty"`
+}
+
+/**
+ * 记录用户已收听语音消息，重复收听不报错
+ * @return bool 是否为第一次收听
+ */
+func MarkListened(messageId, userId int) (*MessageListen, bool, error) {
+	listen := &MessageListen{MessageId: messageId, UserId: userId, CreatedAt: time.Now()}
+	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(listen)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return listen, true, nil
+	}
+	err := DB.Where("message_id = ? AND user_id = ?", messageId, userId).First(listen).Error
+	return listen, false, err
+}
+
+// 语音消息的收听记录，包含收听人资料，按收听时间排序
+func MessageListens(messageId int) ([]MessageListen, error) {
+	listens := make([]MessageListen, 0)
+	err := DB.Preload("User", selectProfile).Where("message_id = ?", messageId).Order("id ASC").Find(&listens).Error
+	return listens, err
+}
+
+/**
+ * 给聊天记录中的语音消息附上收听状态
+ * 接收人看到的是自己是否听过，发送人看到的是是否有接收人听过
+ */
+func attachListens(userId int, messages []Message) error {
+	ids := make([]int, 0)
+	for _, m := range messages {
+		if m.ContentType == ContentVoice && m.RecalledAt == nil {
+			ids = append(ids, m.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows := make([]MessageListen, 0)
+	if err := DB.Select("message_id", "user_id").Where("message_id IN ?", ids).Find(&rows).Error; err != nil {
+		return err
+	}
+	mine := make(map[int]bool, len(rows))
+	anyone := make(map[int]bool, len(rows))
+	for _, row := range rows {
+		anyone[row.MessageId] = true
+		if row.UserId == userId {
+			mine[row.MessageId] = true
+		}
+	}
+	for i := range messages {
+		m := &messages[i]
+		if m.ContentType != ContentVoice || m.RecalledAt != nil {
+			continue
+		}
+		listened := mine[m.Id]
+		if m.SenderId == userId {
+			listened = anyone[m.Id]
+		}
+		m.Listened = &listened
+	}
+	return nil
+}
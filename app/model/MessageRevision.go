@@ -0,0 +1,123 @@
+package model
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// 消息的历史版本，每次编辑前保存一份原内容
+type MessageRevision struct {
+	Id        int       `gorm:"primary_key" json:"id"`
+	MessageId int       `json:"message_id"`
+	Body      string    `gorm:"type:text" json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 用户只对自己删除的消息，不影响会话中的其他人
+type MessageDeletion struct {
+	Id        int       `gorm:"primary_key" json:"id"`
+	MessageId int       `json:"message_id"`
+	UserId    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 用户删除的消息ID，用作子查询
+func deletedBy(userId int) *gorm.DB {
+	return DB.Model(&MessageDeletion{}).Select("message_id").Where("user_id = ?", userId)
+}
+
+// 编辑消息，只有发送人可以编辑未撤回的文本消息，编辑前的内容保存为历史版本
+func EditMessage(userId, messageId int, body string) (*Message, error) {
+	if len(body) > MaxBodyLength {
+		return nil, ErrBodyTooLong
+	}
+	msg := &Message{}
+	if err := DB.First(msg, messageId).Error; err != nil {
+		return nil, err
+	}
+	if msg.SenderId != userId {
+		return nil, ErrNotMessageSender
+	}
+	if msg.GroupId > 0 && !IsGroupMember(msg.GroupId, userId) {
+		return nil, ErrNotGroupMember
+	}
+	if msg.RecalledAt != nil {
+		return nil, ErrMessageRecalled
+	}
+	if msg.ContentType != ContentText {
+		return nil, ErrNotEditable
+	}
+	if msg.Body == body {
+		return msg, nil
+	}
+
+	now := time.Now()
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&MessageRevision{MessageId: msg.Id, Body: msg.Body, CreatedAt: now}).Error; err != nil {
+			return err
+		}
+		return tx.Model(msg).Updates(map[string]interface{}{"body": body, "edited_at": now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	msg.Body = body
+	msg.EditedAt = &now
+	return msg, nil
+}
+
+/**
+ * 撤回消息，只有发送人可以在发送后 window 时间内撤回，撤回后所有人都看不到内容，历史版本一并删除
+ * @param time.Duration window 允许撤回的时间，0 为不限制
+ */
+func RecallMessage(userId, messageId int, window time.Duration) (*Message, error) {
+	msg := &Message{}
+	if err := DB.First(msg, messageId).Error; err != nil {
+		return nil, err
+	}
+	if msg.SenderId != userId {
+		return nil, ErrNotMessageSender
+	}
+	if msg.GroupId > 0 && !IsGroupMember(msg.GroupId, userId) {
+		return nil, ErrNotGroupMember
+	}
+	if msg.RecalledAt != nil {
+		return nil, ErrMessageRecalled
+	}
+	if window > 0 && time.Since(msg.CreatedAt) > window {
+		return nil, ErrRecallExpired
+	}
+
+	now := time.Now()
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("message_id = ?", msg.Id).Delete(&MessageRevision{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(msg).Updates(map[string]interface{}{"body": "", "recalled_at": now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	msg.Body = ""
+	msg.RecalledAt = &now
+	return msg, nil
+}
+
+// 只对自己删除消息，重复删除不报错
+func DeleteMessageForUser(userId, messageId int) error {
+	var count int64
+	if err := DB.Model(&MessageDeletion{}).Where("message_id = ? AND user_id = ?", messageId, userId).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return DB.Create(&MessageDeletion{MessageId: messageId, UserId: userId, CreatedAt: time.Now()}).Error
+}
+
+// 消息的历史版本，按编辑时间升序排列
+func MessageRevisions(messageId int) ([]MessageRevision, error) {
+	revisions := make([]MessageRevision, 0)
+	err := DB.Where("message_id = ?", messageId).Order("id ASC").Find(&revisions).Error
+	return revisions, err
+}
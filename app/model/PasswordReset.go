@@ -0,0 +1,86 @@
+package model
+
+import (
+	"errors"
+	"go-chats/app/utils/helper"
+	"gorm.io/gorm"
+	"time"
+)
+
+// 重置密码令牌无效、已使用或已过期
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// 重置密码令牌，数据库只保存令牌的 SHA256 值
+type PasswordReset struct {
+	Id        int        `gorm:"primary_key" json:"id"`
+	UserId    int        `gorm:"index" json:"user_id"`
+	TokenHash string     `gorm:"size:64;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+/**
+ * 为用户生成新的重置密码令牌，之前未使用的令牌全部作废
+ * @param int userId 用户ID
+ * @param time.Duration ttl 有效期
+ * @return string 令牌明文，只用于发送给用户
+ */
+func CreatePasswordReset(userId int, ttl time.Duration) (string, error) {
+	token, err := helper.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", userId).Delete(&PasswordReset{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&PasswordReset{
+			UserId:    userId,
+			TokenHash: helper.Sha256(token),
+			ExpiresAt: time.Now().Add(ttl),
+			CreatedAt: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// 校验令牌是否有效，不会消耗令牌
+func FindPasswordReset(token string) (*PasswordReset, error) {
+	return findPasswordReset(DB, token)
+}
+
+func findPasswordReset(tx *gorm.DB, token string) (*PasswordReset, error) {
+	reset := &PasswordReset{}
+	err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", helper.Sha256(token), time.Now()).First(reset).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvalidResetToken
+		}
+		return nil, err
+	}
+	return reset, nil
+}
+
+// 在事务中消耗令牌，每个令牌只能成功使用一次，与修改密码放在同一事务中，修改失败时令牌仍然有效
+func ConsumePasswordReset(tx *gorm.DB, token string) (*PasswordReset, error) {
+	reset, err := findPasswordReset(tx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := tx.Model(&PasswordReset{}).Where("id = ? AND used_at IS NULL", reset.Id).Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return nil, ErrInvalidResetToken
+	}
+	reset.UsedAt = &now
+	return reset, nil
+}
@@ -0,0 +1,112 @@
+package model
+
+import "errors"
+
+// 各发送路径的隐私校验结果
+var (
+	ErrBlockedByPeer   = errors.New("blocked by the recipient")        // 对方把自己拉黑了
+	ErrBlockingPeer    = errors.New("the recipient is blocked")        // 自己把对方拉黑了
+	ErrPrivacyRejected = errors.New("rejected by the privacy setting") // 对方的隐私设置不允许
+)
+
+/**
+ * 校验是否可以给对方发单聊消息、发起通话邀请，查询失败时返回数据库错误，调用方按不允许处理
+ * @param int fromId 发起人
+ * @param int toId 接收人
+ */
+func CanContact(fromId, toId int) error {
+	if fromId == toId {
+		return nil
+	}
+	if blocking, err := IsBlocked(fromId, toId); err != nil {
+		return err
+	} else if blocking {
+		return ErrBlockingPeer
+	}
+	if blocked, err := IsBlocked(toId, fromId); err != nil {
+		return err
+	} else if blocked {
+		return ErrBlockedByPeer
+	}
+	return nil
+}
+
+// 校验是否可以向对方发送好友申请，受黑名单和对方的“谁可以添加我”设置限制
+func CanAddFriend(fromId int, to *User) error {
+	if err := CanContact(fromId, to.Id); err != nil {
+		return err
+	}
+
+	// 对方已经向自己发过申请，再申请会直接成为好友，不受对方隐私设置限制
+	var pending int64
+	if err := DB.Model(&FriendRequest{}).Where("from_id = ? AND to_id = ? AND status = ?", to.Id, fromId, FriendRequestPending).Count(&pending).Error; err != nil {
+		return err
+	}
+	if pending > 0 {
+		return nil
+	}
+
+	switch to.AddFriendPolicy {
+	case PrivacyNobody:
+		return ErrPrivacyRejected
+	case PrivacyFriendsOfFriends:
+		if !HasMutualFriend(fromId, to.Id) {
+			return ErrPrivacyRejected
+		}
+	}
+	return nil
+}
+
+/**
+ * 批量判断 viewerId 是否可以看到用户的在线状态和最后在线时间，两者都按用户的“谁可以看到我的最后在线时间”设置
+ * 用于首屏渲染好友列表等需要一次查询多个用户的场景
+ * @param map[int]bool blockers 拉黑了 viewerId 的用户，这些用户始终不可见
+ * @return map[int]bool 可见的用户ID
+ */
+func PresenceVisibility(viewerId int, users []User, blockers map[int]bool) (map[int]bool, error) {
+	result := make(map[int]bool, len(users))
+	ids := make([]int, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.Id)
+	}
+
+	friendIds := make([]int, 0)
+	if len(ids) > 0 {
+		if err := DB.Model(&Friend{}).Where("user_id = ? AND friend_id IN ?", viewerId, ids).Pluck("friend_id", &friendIds).Error; err != nil {
+			return nil, err
+		}
+	}
+	friends := make(map[int]bool, len(friendIds))
+	for _, id := range friendIds {
+		friends[id] = true
+	}
+
+	for _, u := range users {
+		if blockers[u.Id] {
+			continue
+		}
+		visible := true
+		if u.Id != viewerId {
+			switch u.LastSeenPolicy {
+			case PrivacyNobody:
+				visible = false
+			case PrivacyFriends:
+				visible = friends[u.Id]
+			case PrivacyFriendsOfFriends:
+				visible = friends[u.Id] || HasMutualFriend(u.Id, viewerId)
+			}
+		}
+		if visible {
+			result[u.Id] = true
+		}
+	}
+	return result, nil
+}
+
+// 判断两个用户是否有共同好友
+func HasMutualFriend(userId, otherId int) bool {
+	var count int64
+	sub := DB.Model(&Friend{}).Select("friend_id").Where("user_id = ?", otherId)
+	DB.Model(&Friend{}).Where("user_id = ? AND friend_id IN (?)", userId, sub).Count(&count)
+	return count > 0
+}
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrReactionNotFound = errors.New("reaction not found")
+
+// 用户对消息的表情回应，同一用户可以对一条消息回应多个不同的表情
+type MessageReaction struct {
+	Id        int       `gorm:"primary_key" json:"id"`
+	MessageId int       `json:"message_id"`
+	UserId    int       `json:"user_id"`
+	Emoji     string    `gorm:"size:32" json:"emoji"`
+	CreatedAt time.Time `json:"created_at"`
+	User      *User     `gorm:"foreignKey:UserId" json:"user,omitempty"`
+}
+
+// 按表情汇总的回应，UserIds 按回应时间排序
+type Reaction struct {
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	UserIds []int  `json:"user_ids"`
+	Users   []User `json:"users,omitempty"`
+}
+
+// 添加表情回应，重复添加不报错
+func AddReaction(messageId, userId int, emoji string) error {
+	var count int64
+	if err := DB.Model(&MessageReaction{}).Where("message_id = ? AND user_id = ? AND emoji = ?", messageId, userId, emoji).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return DB.Create(&MessageReaction{MessageId: messageId, UserId: userId, Emoji: emoji, CreatedAt: time.Now()}).Error
+}
+
+// 取消表情回应
+func RemoveReaction(messageId, userId int, emoji string) error {
+	result := DB.Where("message_id = ? AND user_id = ? AND emoji = ?", messageId, userId, emoji).Delete(&MessageReaction{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrReactionNotFound
+	}
+	return nil
+}
+
+// 消息的表情回应汇总，包含回应人资料，按第一次回应的时间排序
+func MessageReactions(messageId int) ([]Reaction, error) {
+	rows := make([]MessageReaction, 0)
+	if err := DB.Preload("User", selectProfile).Where("message_id = ?", messageId).Order("id ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	reactions := summarizeReactions(rows)[messageId]
+	if reactions == nil {
+		reactions = make([]Reaction, 0)
+	}
+	return reactions, nil
+}
+
+// 给聊天记录附上表情回应汇总
+func attachReactions(messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.Id)
+	}
+
+	rows := make([]MessageReaction, 0)
+	if err := DB.Where("message_id IN ?", ids).Order("id ASC").Find(&rows).Error; err != nil {
+		return err
+	}
+	summaries := summarizeReactions(rows)
+	for i := range messages {
+		messages[i].Reactions = summaries[messages[i].Id]
+	}
+	return nil
+}
+
+// 按消息、表情汇总回应，消息ID => 汇总
+func summarizeReactions(rows []MessageReaction) map[int][]Reaction {
+	result := make(map[int][]Reaction)
+	index := make(map[int]map[string]int)
+	for _, row := range rows {
+		if index[row.MessageId] == nil {
+			index[row.MessageId] = make(map[string]int)
+		}
+		i, ok := index[row.MessageId][row.Emoji]
+		if !ok {
+			i = len(result[row.MessageId])
+			index[row.MessageId][row.Emoji] = i
+			result[row.MessageId] = append(result[row.MessageId], Reaction{Emoji: row.Emoji, UserIds: make([]int, 0, 1)})
+		}
+		reaction := &result[row.MessageId][i]
+		reaction.Count++
+		reaction.UserIds = append(reaction.UserIds, row.UserId)
+		if row.User != nil {
+			reaction.Users = append(reaction.Users, *row.User)
+		}
+	}
+	return result
+}
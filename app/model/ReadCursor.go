@@ -0,0 +1,166 @@
+package model
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var ErrMessageNotInConversation = errors.New("message does not belong to the conversation")
+
+// 已送达、已读游标，消息ID在会话内递增，游标之前（含）的消息都视为已送达或已读
+const (
+	CursorDelivered = "delivered_message_id"
+	CursorRead      = "read_message_id"
+)
+
+// 用户在会话中的送达与已读位置，断线重连后用于计算未读数
+type ReadCursor struct {
+	Id                 int       `gorm:"primary_key" json:"id"`
+	ConversationId     int       `json:"conversation_id"`
+	UserId             int       `json:"user_id"`
+	DeliveredMessageId int       `json:"delivered_message_id"`
+	ReadMessageId      int       `json:"read_message_id"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	User               *User     `gorm:"foreignKey:UserId" json:"user,omitempty"`
+}
+
+// 用户在会话中的游标，不存在时创建
+func findOrCreateCursor(conversationId, userId int) (*ReadCursor, error) {
+	cursor := &ReadCursor{}
+	err := DB.Where(ReadCursor{ConversationId: conversationId, UserId: userId}).
+		Attrs(ReadCursor{UpdatedAt: time.Now()}).
+		FirstOrCreate(cursor).Error
+	if err != nil {
+		// 并发创建时唯一索引冲突，重新查询一次
+		err = DB.Where("conversation_id = ? AND user_id = ?", conversationId, userId).First(cursor).Error
+	}
+	return cursor, err
+}
+
+/**
+ * 向后移动用户在会话中的游标，游标只会前进，已读同时意味着已送达
+ * @param string column CursorDelivered 或 CursorRead
+ * @return int previous 移动前的位置
+ * @return bool advanced 是否发生了移动
+ */
+func AdvanceCursor(conversationId, userId int, column string, messageId int) (previous int, advanced bool, err error) {
+	var count int64
+	if err = DB.Model(&Message{}).Where("id = ? AND conversation_id = ?", messageId, conversationId).Count(&count).Error; err != nil {
+		return 0, false, err
+	}
+	if count == 0 {
+		return 0, false, ErrMessageNotInConversation
+	}
+
+	cursor, err := findOrCreateCursor(conversationId, userId)
+	if err != nil {
+		return 0, false, err
+	}
+	previous = cursor.DeliveredMessageId
+	if column == CursorRead {
+		previous = cursor.ReadMessageId
+	}
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&ReadCursor{}).Where("id = ? AND "+column+" < ?", cursor.Id, messageId).
+			Updates(map[string]interface{}{column: messageId, "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		advanced = result.RowsAffected > 0
+		if column == CursorRead {
+			return tx.Model(&ReadCursor{}).Where("id = ? AND delivered_message_id < ?", cursor.Id, messageId).
+				Update("delivered_message_id", messageId).Error
+		}
+		return nil
+	})
+	return previous, advanced, err
+}
+
+// 会话中 (after, upto] 区间内其他人发送的消息的发送人，用于推送回执
+func MessageSenders(conversationId, userId, after, upto int) ([]int, error) {
+	ids := make([]int, 0)
+	err := DB.Model(&Message{}).Distinct("sender_id").
+		Where("conversation_id = ? AND id > ? AND id <= ? AND sender_id <> ?", conversationId, after, upto, userId).
+		Pluck("sender_id", &ids).Error
+	return ids, err
+}
+
+// 用户在多个会话中的游标，会话ID => 游标
+func ReadCursors(userId int, conversationIds []int) (map[int]ReadCursor, error) {
+	result := make(map[int]ReadCursor, len(conversationIds))
+	if len(conversationIds) == 0 {
+		return result, nil
+	}
+	cursors := make([]ReadCursor, 0, len(conversationIds))
+	if err := DB.Where("user_id = ? AND conversation_id IN ?", userId, conversationIds).Find(&cursors).Error; err != nil {
+		return nil, err
+	}
+	for _, cursor := range cursors {
+		result[cursor.ConversationId] = cursor
+	}
+	return result, nil
+}
+
+// 单聊会话中对方的游标，用于显示自己发出的消息是否已送达、已读，会话ID => 游标
+func PeerReadCursors(userId int, conversationIds []int) (map[int]ReadCursor, error) {
+	result := make(map[int]ReadCursor, len(conversationIds))
+	if len(conversationIds) == 0 {
+		return result, nil
+	}
+	cursors := make([]ReadCursor, 0, len(conversationIds))
+	if err := DB.Where("user_id <> ? AND conversation_id IN ?", userId, conversationIds).Find(&cursors).Error; err != nil {
+		return nil, err
+	}
+	for _, cursor := range cursors {
+		result[cursor.ConversationId] = cursor
+	}
+	return result, nil
+}
+
+// 消息的送达、已读情况：会话中除发送人外游标已越过该消息的成员
+func MessageReceipts(msg *Message) ([]ReadCursor, error) {
+	cursors := make([]ReadCursor, 0)
+	err := DB.Preload("User", selectProfile).
+		Where("conversation_id = ? AND user_id <> ? AND delivered_message_id >= ?", msg.ConversationId, msg.SenderId, msg.Id).
+		Order("updated_at ASC").Find(&cursors).Error
+	return cursors, err
+}
+
+// 用户在多个会话中的未读数，只统计他人发送且在已读游标之后的消息，不统计被自己拉黑的人发的消息，会话ID => 未读数
+func UnreadCounts(userId int, conversationIds []int) (map[int]int64, error) {
+	result := make(map[int]int64, len(conversationIds))
+	if len(conversationIds) == 0 {
+		return result, nil
+	}
+
+	var rows []struct {
+		ConversationId int
+		Unread         int64
+	}
+	err := DB.Table("? AS m", clause.Table{Name: tableOf(&Message{})}).
+		Select("m.conversation_id, COUNT(*) AS unread").
+		Joins("LEFT JOIN ? AS r ON r.conversation_id = m.conversation_id AND r.user_id = ?", clause.Table{Name: tableOf(&ReadCursor{})}, userId).
+		Where("m.conversation_id IN ? AND m.sender_id <> ? AND m.deleted_at IS NULL AND m.id > COALESCE(r.read_message_id, 0)", conversationIds, userId).
+		Where("m.sender_id NOT IN (?)", blockedBy(userId)).
+		Group("m.conversation_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		result[row.ConversationId] = row.Unread
+	}
+	return result, nil
+}
+
+// 模型对应的表名（含前缀），用于需要给表起别名的查询
+func tableOf(value interface{}) string {
+	stmt := &gorm.Statement{DB: DB}
+	if err := stmt.Parse(value); err != nil {
+		return ""
+	}
+	return stmt.Schema.Table
+}
@@ -0,0 +1,314 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"go-chats/app/utils/filer"
+	"go-chats/app/utils/storage"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"strings"
+	"time"
+)
+
+// 存储用量的归属
+const (
+	StorageOwnerUser  = "user"  // 按上传人统计全部附件
+	StorageOwnerGroup = "group" // 按群统计发到群里的附件
+)
+
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// 存储配额（字节），0 为不限制，由 bootstrap 按配置设置
+var (
+	UserStorageQuota  int64
+	GroupStorageQuota int64
+)
+
+// 存储中没有数据库记录的文件保留的时间，避免删掉正在保存的附件
+const orphanGracePeriod = time.Hour
+
+/**
+ * 用户或群已占用的存储空间，按附件大小累计
+ * 内容相同的附件只保存一份文件，但每次上传都计入上传人的用量
+ */
+type StorageUsage struct {
+	Id        int       `gorm:"primary_key" json:"-"`
+	OwnerType string    `gorm:"size:16" json:"owner_type"`
+	OwnerId   int       `json:"owner_id"`
+	Bytes     int64     `json:"bytes"`
+	Files     int       `json:"files"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// 适用的存储配额（字节），0 为不限制
+func (u *StorageUsage) Quota() int64 {
+	if u.OwnerType == StorageOwnerGroup {
+		return GroupStorageQuota
+	}
+	return UserStorageQuota
+}
+
+// 再存入 size 字节后是否超过配额
+func (u *StorageUsage) Exceeds(size int64) bool {
+	quota := u.Quota()
+	return quota > 0 && u.Bytes+size > quota
+}
+
+// 查询存储用量，还没有上传过附件时返回用量为 0 的记录
+func GetStorageUsage(ownerType string, ownerId int) (*StorageUsage, error) {
+	usage := &StorageUsage{OwnerType: ownerType, OwnerId: ownerId}
+	err := DB.Where("owner_type = ? AND owner_id = ?", ownerType, ownerId).First(usage).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return usage, nil
+}
+
+/**
+ * 在事务中占用存储空间，超过配额时返回 ErrQuotaExceeded
+ * 用带条件的更新检查配额，并发上传时不会超出
+ * @param int64 held 已预留给未完成的分片上传、不能占用的空间
+ */
+func reserveStorage(tx *gorm.DB, ownerType string, ownerId int, size, held int64, files int, quota int64) error {
+	if err := createStorageUsage(tx, ownerType, ownerId); err != nil {
+		return err
+	}
+
+	query := tx.Model(&StorageUsage{}).Where("owner_type = ? AND owner_id = ?", ownerType, ownerId)
+	if quota > 0 {
+		query = query.Where("bytes + ? <= ?", size+held, quota)
+	}
+	result := query.Updates(map[string]interface{}{
+		"bytes":      gorm.Expr("bytes + ?", size),
+		"files":      gorm.Expr("files + ?", files),
+		"updated_at": time.Now(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// 还没有用量记录时创建用量为 0 的记录，已存在时不变
+func createStorageUsage(tx *gorm.DB, ownerType string, ownerId int) error {
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&StorageUsage{OwnerType: ownerType, OwnerId: ownerId}).Error
+}
+
+/**
+ * 在事务中锁定用户或群的用量记录并返回，同一归属的并发请求在此排队，直到事务结束
+ * 用更新加锁，不依赖各数据库不同的 FOR UPDATE 语法
+ */
+func lockStorageUsage(tx *gorm.DB, ownerType string, ownerId int) (*StorageUsage, error) {
+	if err := createStorageUsage(tx, ownerType, ownerId); err != nil {
+		return nil, err
+	}
+	usage := &StorageUsage{}
+	query := tx.Where("owner_type = ? AND owner_id = ?", ownerType, ownerId)
+	if err := query.Model(usage).Update("updated_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+	return usage, query.First(usage).Error
+}
+
+/**
+ * 保存附件记录并计入上传人的存储用量，超过配额时不保存
+ * 未完成的分片上传预留的空间不能占用，锁定用量记录后再统计，与创建上传任务互斥
+ */
+func CreateAttachment(a *Attachment) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockStorageUsage(tx, StorageOwnerUser, a.UploaderId); err != nil {
+			return err
+		}
+		pending, err := GetPendingUploads(tx, a.UploaderId)
+		if err != nil {
+			return err
+		}
+		if err := reserveStorage(tx, StorageOwnerUser, a.UploaderId, a.Size, pending.Bytes, 1, UserStorageQuota); err != nil {
+			return err
+		}
+		return tx.Create(a).Error
+	})
+}
+
+// 发到群里的附件计入群的存储用量，在保存消息的事务中调用
+func reserveGroupStorage(tx *gorm.DB, groupId int, attachments []Attachment) error {
+	var size int64
+	for _, a := range attachments {
+		size += a.Size
+	}
+	return reserveStorage(tx, StorageOwnerGroup, groupId, size, 0, len(attachments), GroupStorageQuota)
+}
+
+// 对账结果
+type StorageReport struct {
+	Missing   int `json:"missing"`   // 数据库中有记录但文件已丢失的附件数
+	Resized   int `json:"resized"`   // 记录的大小与文件不一致、已按文件修正的附件数
+	Orphans   int `json:"orphans"`   // 已删除的没有附件记录的文件数
+	Corrected int `json:"corrected"` // 已修正的用户和群的用量记录数
+}
+
+/**
+ * 存储对账：本地存储时用 filer.GetAllFiles 重新扫描附件目录，按文件的实际大小修正附件记录，
+ * 删除没有附件记录的文件；然后按附件记录重新计算每个用户和群的用量，修正累计时产生的偏差
+ * 对象存储不能列出文件，只重新计算用量
+ */
+func ReconcileStorage() (*StorageReport, error) {
+	report := &StorageReport{}
+	files, err := storage.AttachmentFiles()
+	if err == nil {
+		if err := reconcileFiles(files, report); err != nil {
+			return report, err
+		}
+	} else if err != storage.ErrUnsupported {
+		return report, err
+	}
+
+	err = reconcileUsage(StorageOwnerUser, func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&Attachment{}).
+			Select("uploader_id AS owner_id, SUM(size) AS bytes, COUNT(*) AS files").
+			Group("uploader_id")
+	}, report)
+	if err != nil {
+		return report, err
+	}
+	err = reconcileUsage(StorageOwnerGroup, func(tx *gorm.DB) *gorm.DB {
+		return tx.Table("? AS a", clause.Table{Name: tableOf(&Attachment{})}).
+			Joins("JOIN ? AS m ON m.id = a.message_id", clause.Table{Name: tableOf(&Message{})}).
+			Select("m.group_id AS owner_id, SUM(a.size) AS bytes, COUNT(*) AS files").
+			Where("m.group_id > 0").
+			Group("m.group_id")
+	}, report)
+	return report, err
+}
+
+// 按磁盘上的文件修正附件记录，并删除超过保留时间的无主文件
+func reconcileFiles(files map[string]*storage.Object, report *StorageReport) error {
+	referenced := make(map[string]bool)
+	var attachments []Attachment
+	err := DB.Select("id", "path", "size").FindInBatches(&attachments, 500, func(tx *gorm.DB, batch int) error {
+		for _, a := range attachments {
+			referenced[a.Path] = true
+			file, ok := files[a.Path]
+			if !ok {
+				report.Missing++
+				continue
+			}
+			if file.Size != a.Size {
+				if err := DB.Model(&Attachment{}).Where("id = ?", a.Id).
+					Updates(map[string]interface{}{"size": file.Size, "size_text": filer.FormatBytes(file.Size)}).Error; err != nil {
+					return err
+				}
+				report.Resized++
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+	if report.Missing > 0 {
+		log.Printf("存储对账: %d 个附件的文件已丢失", report.Missing)
+	}
+
+	before := time.Now().Add(-orphanGracePeriod)
+	for key, file := range files {
+		// 缩略图随原图保留
+		base := key
+		if i := strings.LastIndex(key, "-"); i > 0 && strings.HasSuffix(key, ".jpg") {
+			base = key[:i]
+		}
+		if referenced[base] || file.ModTime.After(before) {
+			continue
+		}
+		// 扫描期间可能有新保存的附件引用了这个文件，删除前再查一次
+		var count int64
+		if err := DB.Model(&Attachment{}).Where("path = ?", base).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := storage.Attachments.Delete(key); err != nil {
+			return err
+		}
+		report.Orphans++
+	}
+	return nil
+}
+
+/**
+ * 按统计结果修正累计的用量，统计中没有的记录清零
+ * 统计和累计值在同一个可重复读的事务中读取，修正时只加上两者的差值，对账期间新上传的附件计入的用量不会被覆盖
+ */
+func reconcileUsage(ownerType string, query func(tx *gorm.DB) *gorm.DB, report *StorageReport) error {
+	actual := make([]StorageUsage, 0)
+	existing := make([]StorageUsage, 0)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := query(tx).Scan(&actual).Error; err != nil {
+			return err
+		}
+		return tx.Where("owner_type = ?", ownerType).Find(&existing).Error
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	recorded := make(map[int]StorageUsage, len(existing))
+	for _, u := range existing {
+		recorded[u.OwnerId] = u
+	}
+
+	for _, u := range actual {
+		r := recorded[u.OwnerId]
+		delete(recorded, u.OwnerId)
+		if r.Bytes == u.Bytes && r.Files == u.Files {
+			continue
+		}
+		if err := adjustStorageUsage(ownerType, u.OwnerId, u.Bytes-r.Bytes, u.Files-r.Files); err != nil {
+			return err
+		}
+		report.Corrected++
+	}
+	for ownerId, r := range recorded {
+		if r.Bytes == 0 && r.Files == 0 {
+			continue
+		}
+		if err := adjustStorageUsage(ownerType, ownerId, -r.Bytes, -r.Files); err != nil {
+			return err
+		}
+		report.Corrected++
+	}
+	return nil
+}
+
+// 在累计的用量上加减，不检查配额
+func adjustStorageUsage(ownerType string, ownerId int, bytes int64, files int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := createStorageUsage(tx, ownerType, ownerId); err != nil {
+			return err
+		}
+		return tx.Model(&StorageUsage{}).Where("owner_type = ? AND owner_id = ?", ownerType, ownerId).
+			Updates(map[string]interface{}{
+				"bytes":      gorm.Expr("bytes + ?", bytes),
+				"files":      gorm.Expr("files + ?", files),
+				"updated_at": time.Now(),
+			}).Error
+	})
+}
+
+// 定期对账，阻塞运行
+func RunStorageReconciler(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		if report, err := ReconcileStorage(); err != nil {
+			log.Printf("存储对账失败: %v", err)
+		} else if report.Resized+report.Orphans+report.Corrected > 0 {
+			log.Printf("存储对账: 修正附件大小 %d 个，删除无主文件 %d 个，修正用量 %d 条", report.Resized, report.Orphans, report.Corrected)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrInvalidThread = errors.New("thread root is not a message of the group")
+
+// 话题的关注者，发起话题的消息作者和在话题中发过言的成员自动关注，关注者才会收到话题消息的推送
+type ThreadFollower struct {
+	Id             int       `gorm:"primary_key" json:"id"`
+	ConversationId int       `json:"conversation_id"`
+	UserId         int       `json:"user_id"`
+	Muted          bool      `json:"muted"` // 取消关注后不再推送，但仍可查看
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// 以某条消息为根的话题概况
+type ThreadSummary struct {
+	ConversationId int   `json:"conversation_id"`
+	ReplyCount     int64 `json:"reply_count"`
+	LastReplyId    int   `json:"last_reply_id"`
+}
+
+/**
+ * 获取群消息下的话题会话，不存在时创建
+ * 只能在群聊主会话中未撤回的消息下开启话题，话题中的消息不能再开启话题
+ */
+func ThreadConversation(groupId, rootId int) (*Conversation, error) {
+	root := &Message{}
+	if err := DB.First(root, rootId).Error; err != nil {
+		return nil, ErrInvalidThread
+	}
+	if root.GroupId != groupId || root.ThreadId > 0 || root.RecalledAt != nil {
+		return nil, ErrInvalidThread
+	}
+
+	conv := &Conversation{}
+	err := DB.Where(Conversation{Type: ConversationThread, GroupId: groupId, RootMessageId: rootId}).FirstOrCreate(conv).Error
+	if err != nil {
+		// 并发创建时唯一索引冲突，重新查询一次
+		err = DB.Where("type = ? AND group_id = ? AND root_message_id = ?", ConversationThread, groupId, rootId).First(conv).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// 查找群消息下的话题会话，不存在时返回 gorm.ErrRecordNotFound
+func FindThreadConversation(rootId int) (*Conversation, error) {
+	conv := &Conversation{}
+	if err := DB.Where("type = ? AND root_message_id = ?", ConversationThread, rootId).First(conv).Error; err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+/**
+ * 设置用户对话题的关注状态
+ * @param bool muted 是否取消关注
+ * @param bool overwrite 已有关注记录时是否覆盖，为 false 时只在没有记录时创建（用于自动关注，不改变用户的选择）
+ */
+func FollowThread(conversationId, userId int, muted, overwrite bool) error {
+	follower := &ThreadFollower{}
+	err := DB.Where(ThreadFollower{ConversationId: conversationId, UserId: userId}).
+		Attrs(ThreadFollower{Muted: muted}).
+		FirstOrCreate(follower).Error
+	if err != nil {
+		return err
+	}
+	if overwrite && follower.Muted != muted {
+		return DB.Model(follower).Update("muted", muted).Error
+	}
+	return nil
+}
+
+// 用户对话题的关注记录，没有记录时返回 nil
+func FindThreadFollower(conversationId, userId int) *ThreadFollower {
+	follower := &ThreadFollower{}
+	if err := DB.Where("conversation_id = ? AND user_id = ?", conversationId, userId).First(follower).Error; err != nil {
+		return nil
+	}
+	return follower
+}
+
+// 话题中关注且未取消关注的用户ID
+func ThreadFollowerIds(conversationId int) ([]int, error) {
+	ids := make([]int, 0)
+	err := DB.Model(&ThreadFollower{}).Where("conversation_id = ? AND muted = ?", conversationId, false).Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// 用户关注的话题会话，只包括仍在群中的，按最后活动时间倒序
+func FollowedThreads(userId int) ([]Conversation, error) {
+	conversations := make([]Conversation, 0)
+	followed := DB.Model(&ThreadFollower{}).Select("conversation_id").Where("user_id = ? AND muted = ?", userId, false)
+	groupIds := DB.Model(&GroupMember{}).Select("group_id").Where("user_id = ?", userId)
+	err := DB.Preload("LastMessage").
+		Where("type = ? AND id IN (?) AND group_id IN (?)", ConversationThread, followed, groupIds).
+		Order("updated_at DESC").
+		Find(&conversations).Error
+	return conversations, err
+}
+
+// 话题概况，根消息ID => 概况
+func ThreadSummaries(rootIds []int) (map[int]*ThreadSummary, error) {
+	result := make(map[int]*ThreadSummary, len(rootIds))
+	if len(rootIds) == 0 {
+		return result, nil
+	}
+
+	var rows []struct {
+		ConversationId int
+		ThreadId       int
+		ReplyCount     int64
+		LastReplyId    int
+	}
+	err := DB.Model(&Message{}).
+		Select("conversation_id, thread_id, COUNT(*) AS reply_count, MAX(id) AS last_reply_id").
+		Where("thread_id IN ?", rootIds).
+		Group("conversation_id, thread_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		result[row.ThreadId] = &ThreadSummary{ConversationId: row.ConversationId, ReplyCount: row.ReplyCount, LastReplyId: row.LastReplyId}
+	}
+	return result, nil
+}
+
+// 给群聊记录附上话题概况
+func attachThreads(messages []Message) error {
+	rootIds := make([]int, 0, len(messages))
+	for _, m := range messages {
+		if m.GroupId > 0 && m.ThreadId == 0 {
+			rootIds = append(rootIds, m.Id)
+		}
+	}
+	summaries, err := ThreadSummaries(rootIds)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Thread = summaries[messages[i].Id]
+	}
+	return nil
+}
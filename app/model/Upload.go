@@ -0,0 +1,286 @@
+package model
+
+import (
+	"errors"
+	"go-chats/app/utils/storage"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+var (
+	ErrUploadNotFound   = errors.New("upload does not exist or has expired")
+	ErrUploadProcessing = errors.New("upload is being processed or has finished")
+	ErrTooManyUploads   = errors.New("too many unfinished uploads")
+)
+
+// 每个用户同时未完成的分片上传数上限，0 为不限制，由 bootstrap 按配置设置
+var MaxOpenUploads int
+
+// 上传任务的状态
+const (
+	UploadUploading  = "uploading"  // 接收分片中
+	UploadProcessing = "processing" // 已请求完成，正在后台合并、校验和保存
+	UploadCompleted  = "completed"  // 已保存为附件
+	UploadFailed     = "failed"     // 合并、校验或保存失败，原因见 Error
+)
+
+// 分片上传任务，分片全部上传后合并为附件
+type Upload struct {
+	Id           int       `gorm:"primary_key" json:"id"`
+	UploaderId   int       `json:"uploader_id"`
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+	Md5          string    `json:"md5"`        // 客户端声明的整个文件的 MD5，合并后校验
+	ChunkSize    int64     `json:"chunk_size"` // 除最后一个分片外每个分片的大小
+	TotalChunks  int       `json:"total_chunks"`
+	Status       string    `gorm:"size:16" json:"status"`
+	AttachmentId int       `json:"attachment_id,omitempty"` // 完成后保存的附件ID
+	Error        string    `json:"error,omitempty"`         // 失败原因
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"` // 最后一次收到分片或状态变化的时间，超时的上传会被清理
+}
+
+// 已收到的分片
+type UploadChunk struct {
+	Id        int       `gorm:"primary_key" json:"id"`
+	UploadId  int       `json:"upload_id"`
+	Number    int       `json:"number"` // 分片序号，从 0 开始
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 第 number 个分片应有的大小，序号超出范围时返回 0
+func (u *Upload) ChunkLength(number int) int64 {
+	if number < 0 || number >= u.TotalChunks {
+		return 0
+	}
+	if number == u.TotalChunks-1 {
+		return u.Size - u.ChunkSize*int64(u.TotalChunks-1)
+	}
+	return u.ChunkSize
+}
+
+// 用户未完成（接收分片中或正在处理）的上传任务数和声明的总大小
+type PendingUploads struct {
+	Count int
+	Bytes int64
+}
+
+// 查询用户未完成的上传任务，这些任务的大小在创建时已从存储配额中预留
+func GetPendingUploads(tx *gorm.DB, userId int) (*PendingUploads, error) {
+	pending := &PendingUploads{}
+	err := tx.Model(&Upload{}).Select("COUNT(*) AS count, COALESCE(SUM(size), 0) AS bytes").
+		Where("uploader_id = ? AND status IN ?", userId, []string{UploadUploading, UploadProcessing}).
+		Scan(pending).Error
+	return pending, err
+}
+
+/**
+ * 创建上传任务，按声明的大小预留上传人的存储配额
+ * 未完成任务的大小计入已用空间，任务完成、失败或删除后自动释放，分片文件不能无限占用磁盘
+ * @return error 未完成的任务过多时返回 ErrTooManyUploads，空间不足时返回 ErrQuotaExceeded
+ */
+func CreateUpload(upload *Upload) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		usage, err := lockStorageUsage(tx, StorageOwnerUser, upload.UploaderId)
+		if err != nil {
+			return err
+		}
+		pending, err := GetPendingUploads(tx, upload.UploaderId)
+		if err != nil {
+			return err
+		}
+		if MaxOpenUploads > 0 && pending.Count >= MaxOpenUploads {
+			return ErrTooManyUploads
+		}
+		if usage.Exceeds(pending.Bytes + upload.Size) {
+			return ErrQuotaExceeded
+		}
+		return tx.Create(upload).Error
+	})
+}
+
+// 查找用户自己的上传任务，不存在时返回 ErrUploadNotFound
+func FindUpload(id, userId int) (*Upload, error) {
+	upload := &Upload{}
+	if err := DB.Where("id = ? AND uploader_id = ?", id, userId).First(upload).Error; err != nil {
+		return nil, ErrUploadNotFound
+	}
+	return upload, nil
+}
+
+// 已收到的分片序号，升序排列
+func ReceivedChunks(uploadId int) ([]int, error) {
+	numbers := make([]int, 0)
+	err := DB.Model(&UploadChunk{}).Where("upload_id = ?", uploadId).Order("number ASC").Pluck("number", &numbers).Error
+	return numbers, err
+}
+
+// 记录收到的分片并刷新上传任务的活动时间，重复上传的分片只更新大小
+func SaveChunk(upload *Upload, number int, size int64) error {
+	chunk := &UploadChunk{}
+	// 序号可能为 0，用 map 作为条件，结构体条件会忽略零值
+	err := DB.Where(map[string]interface{}{"upload_id": upload.Id, "number": number}).
+		Assign(UploadChunk{Size: size}).
+		FirstOrCreate(chunk).Error
+	if err != nil {
+		return err
+	}
+	return DB.Model(upload).Update("updated_at", time.Now()).Error
+}
+
+/**
+ * 开始在后台处理上传，只有接收分片中的任务可以开始，并发请求完成时只有一个成功
+ * @return error 已在处理或已处理完时返回 ErrUploadProcessing
+ */
+func StartUpload(upload *Upload) error {
+	result := DB.Model(&Upload{}).Where("id = ? AND status = ?", upload.Id, UploadUploading).
+		Updates(map[string]interface{}{"status": UploadProcessing, "updated_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUploadProcessing
+	}
+	upload.Status = UploadProcessing
+	return nil
+}
+
+/**
+ * 把处理完的上传保存为附件：在同一事务中结束上传任务、释放其预留的空间并计入附件的大小
+ * 创建任务时已按声明的大小预留了空间，附件不超过预留的大小时不再检查配额，避免分片全部上传后才因配额失败
+ * @return error 任务已不在处理中时返回 ErrUploadNotFound
+ */
+func CompleteUpload(upload *Upload, a *Attachment) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockStorageUsage(tx, StorageOwnerUser, upload.UploaderId); err != nil {
+			return err
+		}
+		result := tx.Model(&Upload{}).Where("id = ? AND status = ?", upload.Id, UploadProcessing).
+			Updates(map[string]interface{}{"status": UploadCompleted, "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUploadNotFound
+		}
+
+		// 超出预留的部分按其他未完成任务的预留检查配额
+		var (
+			held  int64
+			quota int64
+		)
+		if a.Size > upload.Size {
+			pending, err := GetPendingUploads(tx, upload.UploaderId)
+			if err != nil {
+				return err
+			}
+			held, quota = pending.Bytes, UserStorageQuota
+		}
+		if err := reserveStorage(tx, StorageOwnerUser, upload.UploaderId, a.Size, held, 1, quota); err != nil {
+			return err
+		}
+		if err := tx.Create(a).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Upload{}).Where("id = ?", upload.Id).Update("attachment_id", a.Id).Error
+	})
+}
+
+/**
+ * 记录后台处理的结果并删除分片，任务保留到过期清理，供客户端查询结果
+ * @param int attachmentId 成功时为保存的附件ID，失败时为0
+ * @param string message 失败原因
+ */
+func FinishUpload(upload *Upload, attachmentId int, message string) error {
+	upload.Status, upload.AttachmentId, upload.Error = UploadCompleted, attachmentId, message
+	if attachmentId == 0 {
+		upload.Status = UploadFailed
+	}
+	err := DB.Model(&Upload{}).Where("id = ?", upload.Id).Updates(map[string]interface{}{
+		"status":        upload.Status,
+		"attachment_id": upload.AttachmentId,
+		"error":         upload.Error,
+		"updated_at":    time.Now(),
+	}).Error
+	if err != nil {
+		return err
+	}
+	if err := DB.Where("upload_id = ?", upload.Id).Delete(&UploadChunk{}).Error; err != nil {
+		return err
+	}
+	return storage.RemoveChunks(upload.Id, upload.TotalChunks)
+}
+
+// 服务重启时后台处理被中断的任务恢复为接收分片中，分片还在，客户端可以重新请求完成
+func ResetProcessingUploads() error {
+	return DB.Model(&Upload{}).Where("status = ?", UploadProcessing).Update("status", UploadUploading).Error
+}
+
+// 删除上传任务及其分片文件，先删分片文件，失败时任务还在，下次清理时重试
+func DeleteUpload(upload *Upload) error {
+	if err := storage.RemoveChunks(upload.Id, upload.TotalChunks); err != nil {
+		return err
+	}
+	if err := DB.Where("upload_id = ?", upload.Id).Delete(&UploadChunk{}).Error; err != nil {
+		return err
+	}
+	return DB.Delete(&Upload{}, upload.Id).Error
+}
+
+/**
+ * 清理超过 ttl 没有活动的上传任务（正在后台处理的除外）、数据库中已没有记录的分片目录和遗留的临时文件
+ * 对象存储不能列出文件，只按上传任务删除分片
+ * @return int 清理的上传任务数
+ */
+func CollectUploads(ttl time.Duration) (int, error) {
+	before := time.Now().Add(-ttl)
+	expired := make([]Upload, 0)
+	if err := DB.Select("id", "total_chunks").Where("updated_at < ? AND status <> ?", before, UploadProcessing).Find(&expired).Error; err != nil {
+		return 0, err
+	}
+	for i := range expired {
+		if err := DeleteUpload(&expired[i]); err != nil {
+			return 0, err
+		}
+	}
+
+	dirIds, err := storage.ChunkUploadIds()
+	if err != nil && err != storage.ErrUnsupported {
+		return len(expired), err
+	}
+	if len(dirIds) > 0 {
+		existing := make([]int, 0, len(dirIds))
+		if err := DB.Model(&Upload{}).Where("id IN ?", dirIds).Pluck("id", &existing).Error; err != nil {
+			return len(expired), err
+		}
+		alive := make(map[int]bool, len(existing))
+		for _, id := range existing {
+			alive[id] = true
+		}
+		for _, id := range dirIds {
+			if !alive[id] {
+				_ = storage.RemoveChunks(id, 0)
+			}
+		}
+	}
+
+	_, err = storage.RemoveStaleTempFiles(before)
+	return len(expired), err
+}
+
+// 定期清理过期的分片上传，阻塞运行
+func RunUploadCollector(interval, ttl time.Duration) {
+	if err := ResetProcessingUploads(); err != nil {
+		log.Printf("恢复中断的分片上传失败: %v", err)
+	}
+	for {
+		if n, err := CollectUploads(ttl); err != nil {
+			log.Printf("清理分片上传失败: %v", err)
+		} else if n > 0 {
+			log.Printf("已清理 %d 个过期的分片上传", n)
+		}
+		time.Sleep(interval)
+	}
+}
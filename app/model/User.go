@@ -2,21 +2,52 @@ package model
 
 import "time"
 
+// 账号状态
+const (
+	UserDisabled   uint8 = 0 // 已禁用
+	UserActive     uint8 = 1 // 正常
+	UserUnverified uint8 = 2 // 已注册，等待邮箱验证
+)
+
+// 隐私范围
+const (
+	PrivacyEveryone         uint8 = 0 // 所有人
+	PrivacyFriends          uint8 = 1 // 仅好友
+	PrivacyFriendsOfFriends uint8 = 2 // 好友及好友的好友
+	PrivacyNobody           uint8 = 3 // 所有人都不可以
+)
+
 type User struct {
-	Id        int       `gorm:"primary_key" json:"id"`
-	Username  string    `json:"username"`
-	Password  string    `json:"password"`
-	Nickname  string    `json:"nickname"`
-	Email     string    `json:"email"`
-	Activate  uint8     `json:"activate"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	Id              int        `gorm:"primary_key" json:"id"`
+	Username        string     `json:"username"`
+	Password        string     `gorm:"size:255" json:"-"`
+	Nickname        string     `json:"nickname"`
+	Email           string     `json:"email"`
+	Activate        uint8      `json:"activate"`
+	VerifySentAt    *time.Time `json:"-"`                  // 最近一次发送验证邮件的时间，用于限制重发频率
+	SessionVersion  int        `gorm:"default:0" json:"-"` // 登录态版本号，修改密码时递增使所有已登录的Session失效
+	AddFriendPolicy uint8      `gorm:"default:0" json:"-"` // 谁可以添加我为好友：所有人、好友的好友、所有人都不可以
+	LastSeenPolicy  uint8      `gorm:"default:0" json:"-"` // 谁可以看到我的在线状态和最后在线时间：所有人、仅好友、所有人都不可以
+	LastSeenAt      *time.Time `json:"-"`                  // 最后在线时间，所有连接断开时更新
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
-func (u *User) TableName() string {
-	return "gc_users"
+func (u *User) Login() {
+
 }
 
-func (u *User) Login() {
+// 从给定ID中筛选出存在且状态正常的用户ID
+func ActiveUserIds(ids []int) ([]int, error) {
+	valid := make([]int, 0, len(ids))
+	if len(ids) == 0 {
+		return valid, nil
+	}
+	err := DB.Model(&User{}).Where("id IN ? AND activate = ?", ids, UserActive).Pluck("id", &valid).Error
+	return valid, err
+}
 
+// 记录用户的最后在线时间，不更新 updated_at
+func UpdateLastSeen(userId int, t time.Time) error {
+	return DB.Model(&User{Id: userId}).UpdateColumn("last_seen_at", t).Error
 }
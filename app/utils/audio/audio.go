@@ -0,0 +1,181 @@
+package audio
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidAudio     = errors.New("invalid or truncated audio data")
+	ErrUnsupportedCodec = errors.New("unsupported audio codec")
+)
+
+// 音量包络的点数和最大值
+const (
+	WaveformLength = 64
+	WaveformMax    = 31
+)
+
+// 封装中声明的时长与按数据包累计的时长允许的误差，最后一个数据包的时长可能没有计入
+const durationTolerance = time.Second
+
+// 语音文件的信息
+type Info struct {
+	Mime     string // audio/ogg 或 audio/webm
+	Codec    string // opus 或 vorbis
+	Duration time.Duration
+	Waveform []int // WaveformLength 个 0~WaveformMax 的值
+}
+
+// 一个编码数据包的开始时间和大小
+type frame struct {
+	start time.Duration
+	size  int
+}
+
+/**
+ * 按文件开头识别 Ogg、WebM 封装的纯音频文件，http.DetectContentType 会把它们识别为 application/ogg、video/webm
+ * @return string audio/ogg、audio/webm，不是纯音频或无法判断时返回空字符串
+ */
+func Sniff(head []byte) string {
+	if isOgg(head) {
+		if codec, _ := oggCodec(head); codec != "" {
+			return "audio/ogg"
+		}
+		return ""
+	}
+	if isWebm(head) && webmAudioOnly(head) {
+		return "audio/webm"
+	}
+	return ""
+}
+
+/**
+ * 解析 Ogg（Opus、Vorbis）或 WebM（Opus、Vorbis）语音文件的时长和音量包络，只读取封装，不解码音频
+ * 音量包络按各时间段编码数据的多少估算：可变码率编码时静音段的数据包明显更小
+ */
+func Probe(data []byte) (*Info, error) {
+	var (
+		info   *Info
+		frames []frame
+		err    error
+	)
+	switch {
+	case isOgg(data):
+		info, frames, err = probeOgg(data)
+	case isWebm(data):
+		info, frames, err = probeWebm(data)
+	default:
+		return nil, ErrInvalidAudio
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 || info.Duration <= 0 {
+		return nil, ErrInvalidAudio
+	}
+	info.Waveform = waveform(frames, info.Duration)
+	return info, nil
+}
+
+// 把数据包按开始时间分到 WaveformLength 个时间段，取每段的平均包大小并归一化
+func waveform(frames []frame, duration time.Duration) []int {
+	sums := make([]float64, WaveformLength)
+	counts := make([]int, WaveformLength)
+	for _, f := range frames {
+		i := int(int64(f.start) * WaveformLength / int64(duration))
+		if i < 0 {
+			i = 0
+		} else if i >= WaveformLength {
+			i = WaveformLength - 1
+		}
+		sums[i] += float64(f.size)
+		counts[i]++
+	}
+
+	averages := make([]float64, WaveformLength)
+	min, max := -1.0, 0.0
+	for i := range averages {
+		if counts[i] == 0 {
+			// 数据包比时间段少时沿用上一段
+			if i > 0 {
+				averages[i] = averages[i-1]
+			}
+			continue
+		}
+		averages[i] = sums[i] / float64(counts[i])
+		if min < 0 || averages[i] < min {
+			min = averages[i]
+		}
+		if averages[i] > max {
+			max = averages[i]
+		}
+	}
+	if counts[0] == 0 {
+		for i := range averages {
+			if counts[i] > 0 {
+				for j := 0; j < i; j++ {
+					averages[j] = averages[i]
+				}
+				break
+			}
+		}
+	}
+
+	values := make([]int, WaveformLength)
+	for i, average := range averages {
+		if max > min {
+			values[i] = int((average-min)/(max-min)*WaveformMax + 0.5)
+		} else {
+			// 固定码率时无法区分音量，显示为一条中线
+			values[i] = WaveformMax / 2
+		}
+	}
+	return values
+}
+
+/**
+ * 选择可信的时长：声明的时长（WebM 的 Duration、Ogg 最后一页的 granule position）可以随意改写，
+ * 与按数据包时间累计的时长相差超过 durationTolerance 时以累计的为准，避免伪造很短的时长绕过语音时长限制
+ * @param time.Duration counted 按数据包累计的时长，0 为无法累计
+ */
+func trustedDuration(declared, counted time.Duration) time.Duration {
+	if counted <= 0 {
+		return declared
+	}
+	if declared < counted-durationTolerance || declared > counted+durationTolerance {
+		return counted
+	}
+	return declared
+}
+
+/**
+ * 按 Opus 数据包的 TOC 字节计算包含的采样数（48kHz），见 RFC 6716 3.1
+ */
+func opusSamples(packet []byte) int64 {
+	if len(packet) == 0 {
+		return 0
+	}
+	config := packet[0] >> 3
+	var frameSize int64 // 以 1/400 秒（120 个采样）为单位的倍数 * 120
+	switch {
+	case config < 12: // SILK：10、20、40、60ms
+		frameSize = []int64{480, 960, 1920, 2880}[config%4]
+	case config < 16: // Hybrid：10、20ms
+		frameSize = []int64{480, 960}[config%2]
+	default: // CELT：2.5、5、10、20ms
+		frameSize = []int64{120, 240, 480, 960}[config%4]
+	}
+
+	frames := int64(1)
+	switch packet[0] & 0x03 {
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0
+		}
+		frames = int64(packet[1] & 0x3F)
+	}
+	return frameSize * frames
+}
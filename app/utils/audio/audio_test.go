@@ -0,0 +1,137 @@
+package audio
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "更新 testdata 中的 .golden 文件")
+
+// testdata 中的 .ogg、.webm 文件
+func fixtures(tb testing.TB) []string {
+	var files []string
+	for _, pattern := range []string{"testdata/*.ogg", "testdata/*.webm"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	return files
+}
+
+// 解析结果的文本形式，与 .golden 文件比较
+func describe(info *Info) string {
+	values := make([]string, len(info.Waveform))
+	for i, v := range info.Waveform {
+		values[i] = fmt.Sprint(v)
+	}
+	return fmt.Sprintf("mime: %s\ncodec: %s\nduration: %s\nwaveform: %s\n",
+		info.Mime, info.Codec, info.Duration.Round(time.Millisecond), strings.Join(values, ","))
+}
+
+/**
+ * testdata 中的语音文件与 .golden 中记录的时长和音量包络比较，修改解析逻辑后用 go test -update 重新生成
+ * opus-forged-*：声明的时长远小于实际数据，应按数据包计算；laced.webm：分帧的数据块与 Duration 接近，使用 Duration
+ */
+func TestProbeGolden(t *testing.T) {
+	files := fixtures(t)
+	if len(files) == 0 {
+		t.Fatal("no fixtures in testdata")
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := Probe(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := describe(info)
+			golden := file + ".golden"
+			if *update {
+				if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("Probe() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestSniff(t *testing.T) {
+	cases := []struct {
+		file string
+		want string
+	}{
+		{"testdata/opus.ogg", "audio/ogg"},
+		{"testdata/vorbis.ogg", "audio/ogg"},
+		{"testdata/opus.webm", "audio/webm"},
+		{"testdata/recording.webm", "audio/webm"},
+	}
+	for _, c := range cases {
+		data, err := ioutil.ReadFile(c.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Sniff(data[:512]); got != c.want {
+			t.Errorf("Sniff(%s) = %q, want %q", c.file, got, c.want)
+		}
+	}
+	if got := Sniff([]byte("OggS\x00\x02 not an audio stream")); got != "" {
+		t.Errorf("Sniff(unknown ogg) = %q", got)
+	}
+	if got := Sniff([]byte("%PDF-1.4")); got != "" {
+		t.Errorf("Sniff(pdf) = %q", got)
+	}
+}
+
+// 截断的文件按已读到的部分计算，不能报错或崩溃
+func TestProbeTruncated(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/recording.webm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := Probe(data[:len(data)/2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Duration <= 0 || info.Duration >= 3*time.Second {
+		t.Errorf("Duration = %s, want about half of 3s", info.Duration)
+	}
+	if _, err := Probe(data[:64]); err != ErrInvalidAudio {
+		t.Errorf("Probe(header only) error = %v, want ErrInvalidAudio", err)
+	}
+}
+
+func TestTrustedDuration(t *testing.T) {
+	cases := []struct {
+		declared, counted, want time.Duration
+	}{
+		{5 * time.Second, 5 * time.Second, 5 * time.Second},
+		{3 * time.Second, 2970 * time.Millisecond, 3 * time.Second},
+		{time.Second, 5 * time.Second, 5 * time.Second},
+		{time.Hour, 5 * time.Second, 5 * time.Second},
+		{0, 5 * time.Second, 5 * time.Second},
+		{5 * time.Second, 0, 5 * time.Second},
+	}
+	for _, c := range cases {
+		if got := trustedDuration(c.declared, c.counted); got != c.want {
+			t.Errorf("trustedDuration(%s, %s) = %s, want %s", c.declared, c.counted, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+//go:build go1.18
+// +build go1.18
+
+package audio
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+// 任意输入都不能崩溃，解析成功时时长和音量包络必须有效
+func FuzzProbe(f *testing.F) {
+	for _, file := range fixtures(f) {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data[:len(data)/8])
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Sniff(data)
+		info, err := Probe(data)
+		if err != nil {
+			return
+		}
+		if info.Duration <= 0 {
+			t.Errorf("Duration = %s", info.Duration)
+		}
+		if len(info.Waveform) != WaveformLength {
+			t.Fatalf("len(Waveform) = %d", len(info.Waveform))
+		}
+		for _, v := range info.Waveform {
+			if v < 0 || v > WaveformMax {
+				t.Fatalf("Waveform value %d out of range", v)
+			}
+		}
+	})
+}
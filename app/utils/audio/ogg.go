@@ -0,0 +1,134 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// Ogg 页头的固定部分长度
+const oggHeaderSize = 27
+
+func isOgg(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("OggS"))
+}
+
+// 第一页的第一个数据包是编码器的标识头
+func oggCodec(data []byte) (string, []byte) {
+	if len(data) < oggHeaderSize {
+		return "", nil
+	}
+	body := oggHeaderSize + int(data[26])
+	if body > len(data) {
+		return "", nil
+	}
+	packet := data[body:]
+	switch {
+	case bytes.HasPrefix(packet, []byte("OpusHead")):
+		return "opus", packet
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")):
+		return "vorbis", packet
+	}
+	return "", nil
+}
+
+/**
+ * 逐页读取 Ogg 文件，只处理第一个逻辑流
+ * Opus 按每个数据包的 TOC 计算时间，Vorbis 按页的 granule position 计算时间
+ */
+func probeOgg(data []byte) (*Info, []frame, error) {
+	codec, head := oggCodec(data)
+	var rate, preSkip int64
+	switch codec {
+	case "opus":
+		if len(head) < 12 {
+			return nil, nil, ErrInvalidAudio
+		}
+		rate, preSkip = 48000, int64(binary.LittleEndian.Uint16(head[10:12]))
+	case "vorbis":
+		if len(head) < 16 {
+			return nil, nil, ErrInvalidAudio
+		}
+		rate = int64(binary.LittleEndian.Uint32(head[12:16]))
+		if rate == 0 {
+			return nil, nil, ErrInvalidAudio
+		}
+	default:
+		return nil, nil, ErrUnsupportedCodec
+	}
+	// Opus 有标识头和注释头，Vorbis 还多一个编码设置头
+	headers := 2
+	if codec == "vorbis" {
+		headers = 3
+	}
+
+	var (
+		serial      = binary.LittleEndian.Uint32(data[14:18])
+		frames      []frame
+		packet      []byte
+		packets     int
+		elapsed     int64 // Opus 已累计的采样数
+		lastGranule int64
+		pageGranule int64 // Vorbis 上一页结束时的采样位置
+		offset      int
+		toDuration  = func(samples int64) time.Duration { return time.Duration(samples * int64(time.Second) / rate) }
+	)
+	for offset+oggHeaderSize <= len(data) {
+		if !bytes.Equal(data[offset:offset+4], []byte("OggS")) {
+			return nil, nil, ErrInvalidAudio
+		}
+		granule := int64(binary.LittleEndian.Uint64(data[offset+6 : offset+14]))
+		segments := int(data[offset+26])
+		body := offset + oggHeaderSize + segments
+		if body > len(data) {
+			break
+		}
+		size := 0
+		for _, l := range data[offset+oggHeaderSize : body] {
+			size += int(l)
+		}
+		if body+size > len(data) {
+			break
+		}
+		if binary.LittleEndian.Uint32(data[offset+14:offset+18]) != serial {
+			offset = body + size
+			continue
+		}
+
+		pageAudio := 0
+		position := body
+		for _, l := range data[offset+oggHeaderSize : body] {
+			packet = append(packet, data[position:position+int(l)]...)
+			position += int(l)
+			if l == 255 {
+				// 数据包跨段或跨页
+				continue
+			}
+			if packets >= headers {
+				if codec == "opus" {
+					frames = append(frames, frame{start: toDuration(elapsed), size: len(packet)})
+					elapsed += opusSamples(packet)
+				}
+				pageAudio += len(packet)
+			}
+			packets++
+			packet = packet[:0]
+		}
+
+		// granule position 为 -1 表示这一页没有结束的数据包
+		if granule >= 0 {
+			if codec == "vorbis" && pageAudio > 0 {
+				frames = append(frames, frame{start: toDuration(pageGranule), size: pageAudio})
+			}
+			pageGranule, lastGranule = granule, granule
+		}
+		offset = body + size
+	}
+
+	// Vorbis 只能按 granule position 计算时长
+	duration := toDuration(lastGranule - preSkip)
+	if codec == "opus" {
+		duration = trustedDuration(duration, toDuration(elapsed-preSkip))
+	}
+	return &Info{Mime: "audio/ogg", Codec: codec, Duration: duration}, frames, nil
+}
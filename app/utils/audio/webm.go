@@ -0,0 +1,258 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// 用到的 EBML 元素 ID，见 Matroska 规范
+const (
+	ebmlHeader     = 0x1A45DFA3
+	ebmlDocType    = 0x4282
+	mkvSegment     = 0x18538067
+	mkvInfo        = 0x1549A966
+	mkvTimecode    = 0x2AD7B1 // TimecodeScale
+	mkvDuration    = 0x4489
+	mkvTracks      = 0x1654AE6B
+	mkvTrackEntry  = 0xAE
+	mkvTrackNumber = 0xD7
+	mkvTrackType   = 0x83
+	mkvCodecID     = 0x86
+	mkvCluster     = 0x1F43B675
+	mkvClusterTime = 0xE7
+	mkvBlockGroup  = 0xA0
+	mkvBlock       = 0xA1
+	mkvSimpleBlock = 0xA3
+
+	trackTypeAudio = 2
+)
+
+// 需要进入读取子元素的容器元素，其余元素整体跳过
+var ebmlContainers = map[uint32]bool{
+	ebmlHeader:    true,
+	mkvSegment:    true,
+	mkvInfo:       true,
+	mkvTracks:     true,
+	mkvTrackEntry: true,
+	mkvCluster:    true,
+	mkvBlockGroup: true,
+}
+
+type webmTrack struct {
+	number uint64
+	kind   uint64
+	codec  string
+}
+
+// 按顺序读取到的 WebM 结构
+type webmFile struct {
+	docType   string
+	scale     int64   // TimecodeScale，纳秒
+	duration  float64 // 以 scale 为单位，0 为没有写入时长
+	tracks    []*webmTrack
+	tracksEnd int // Tracks 元素结束的位置，-1 为长度未知或还没读到
+	blocks    []webmBlock
+}
+
+type webmBlock struct {
+	track   uint64
+	time    int64 // 以 scale 为单位
+	laced   bool  // 一个数据块中有多帧
+	payload []byte
+}
+
+func isWebm(data []byte) bool {
+	return bytes.HasPrefix(data, []byte{0x1A, 0x45, 0xDF, 0xA3})
+}
+
+/**
+ * 读取 EBML 的变长整数
+ * @param bool marker 为 true 时保留长度标记位（元素 ID），否则去掉（元素长度、轨道号）
+ * @return int 占用的字节数，0 为数据不完整或格式错误
+ */
+func readVint(data []byte, marker bool) (uint64, int) {
+	if len(data) == 0 || data[0] == 0 {
+		return 0, 0
+	}
+	n := 1
+	for mask := byte(0x80); data[0]&mask == 0; mask >>= 1 {
+		n++
+	}
+	if n > len(data) {
+		return 0, 0
+	}
+	value := uint64(data[0])
+	if !marker {
+		value &= uint64(0xFF >> uint(n))
+	}
+	for _, b := range data[1:n] {
+		value = value<<8 | uint64(b)
+	}
+	return value, n
+}
+
+func readUint(data []byte) uint64 {
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+/**
+ * 顺序扫描 EBML 元素，进入容器元素读取子元素，截断的数据读到哪里算哪里
+ * MediaRecorder 录制的文件 Segment 和 Cluster 的长度是未知的，不能按长度跳过
+ */
+func parseWebm(data []byte) *webmFile {
+	file := &webmFile{scale: 1000000, tracksEnd: -1}
+	var (
+		track   *webmTrack
+		cluster int64
+	)
+	for pos := 0; pos < len(data); {
+		id, n := readVint(data[pos:], true)
+		if n == 0 || n > 4 {
+			break
+		}
+		size, m := readVint(data[pos+n:], false)
+		if m == 0 {
+			break
+		}
+		header := n + m
+		// 长度的各位全为 1 表示长度未知
+		unknown := size == uint64(1)<<uint(7*m)-1
+
+		if ebmlContainers[uint32(id)] {
+			switch id {
+			case mkvTracks:
+				if !unknown {
+					file.tracksEnd = pos + header + int(size)
+				}
+			case mkvTrackEntry:
+				track = &webmTrack{}
+				file.tracks = append(file.tracks, track)
+			}
+			pos += header
+			continue
+		}
+		if unknown || size > uint64(len(data)-pos-header) {
+			break
+		}
+		value := data[pos+header : pos+header+int(size)]
+		switch id {
+		case ebmlDocType:
+			file.docType = string(value)
+		case mkvTimecode:
+			if scale := int64(readUint(value)); scale > 0 {
+				file.scale = scale
+			}
+		case mkvDuration:
+			switch len(value) {
+			case 4:
+				file.duration = float64(math.Float32frombits(binary.BigEndian.Uint32(value)))
+			case 8:
+				file.duration = math.Float64frombits(binary.BigEndian.Uint64(value))
+			}
+		case mkvTrackNumber, mkvTrackType, mkvCodecID:
+			if track == nil {
+				break
+			}
+			switch id {
+			case mkvTrackNumber:
+				track.number = readUint(value)
+			case mkvTrackType:
+				track.kind = readUint(value)
+			default:
+				track.codec = string(value)
+			}
+		case mkvClusterTime:
+			cluster = int64(readUint(value))
+		case mkvBlock, mkvSimpleBlock:
+			// 轨道号、相对 Cluster 的 16 位时间、标记字节，之后是编码数据
+			number, k := readVint(value, false)
+			if k == 0 || len(value) < k+3 {
+				break
+			}
+			file.blocks = append(file.blocks, webmBlock{
+				track:   number,
+				time:    cluster + int64(int16(binary.BigEndian.Uint16(value[k:k+2]))),
+				laced:   value[k+2]&0x06 != 0,
+				payload: value[k+3:],
+			})
+		}
+		pos += header + int(size)
+	}
+	return file
+}
+
+// 文件开头包含完整的 Tracks 并且所有轨道都是音频
+func webmAudioOnly(head []byte) bool {
+	file := parseWebm(head)
+	if file.docType != "webm" || file.tracksEnd < 0 || file.tracksEnd > len(head) || len(file.tracks) == 0 {
+		return false
+	}
+	for _, track := range file.tracks {
+		if track.kind != trackTypeAudio {
+			return false
+		}
+	}
+	return true
+}
+
+/**
+ * 读取 WebM 中第一个音频轨道的数据块
+ * 时长按最后一个数据块的时间加上其包含的时长计算，Info 中的 Duration 与之接近时使用 Duration（分帧的数据块算不出包含的时长）
+ * MediaRecorder 录制的文件没有写入 Duration
+ */
+func probeWebm(data []byte) (*Info, []frame, error) {
+	file := parseWebm(data)
+	if file.docType != "webm" {
+		return nil, nil, ErrInvalidAudio
+	}
+	var audio *webmTrack
+	for _, track := range file.tracks {
+		if track.kind == trackTypeAudio {
+			audio = track
+			break
+		}
+	}
+	if audio == nil {
+		return nil, nil, ErrInvalidAudio
+	}
+	var codec string
+	switch audio.codec {
+	case "A_OPUS":
+		codec = "opus"
+	case "A_VORBIS":
+		codec = "vorbis"
+	default:
+		return nil, nil, ErrUnsupportedCodec
+	}
+
+	var (
+		frames []frame
+		end    time.Duration
+	)
+	for _, block := range file.blocks {
+		if block.track != audio.number {
+			continue
+		}
+		start := time.Duration(block.time * file.scale)
+		if start < 0 {
+			start = 0
+		}
+		frames = append(frames, frame{start: start, size: len(block.payload)})
+		// 有分帧（lacing）时不能按开头的 TOC 计算整个数据块的时长
+		if codec == "opus" && !block.laced {
+			start += time.Duration(opusSamples(block.payload) * int64(time.Second) / 48000)
+		}
+		if start > end {
+			end = start
+		}
+	}
+
+	duration := trustedDuration(time.Duration(file.duration*float64(file.scale)), end)
+	return &Info{Mime: "audio/webm", Codec: codec, Duration: duration}, frames, nil
+}
@@ -0,0 +1,218 @@
+package hasher
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-ini/ini"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// 密码加密算法
+type Hasher interface {
+	// 加密密码
+	Make(password string) (string, error)
+	// 校验密码是否与密文匹配，算法参数从密文中读取
+	Check(password, hashed string) bool
+	// 判断密文是否不是由当前算法和参数生成，需要重新加密
+	NeedsRehash(hashed string) bool
+}
+
+// 当前使用的加密算法，默认 bcrypt，由 Init 按配置替换
+var Default Hasher = &Bcrypt{Cost: bcrypt.DefaultCost}
+
+// 旧版本使用的无盐 MD5，仅用于校验历史密码
+var legacy Hasher = &Md5{}
+
+// 按配置初始化加密算法
+func Init(cfg *ini.File) error {
+	section := cfg.Section(ini.DefaultSection)
+	driver := strings.ToLower(section.Key("HASH_DRIVER").MustString("bcrypt"))
+
+	switch driver {
+	case "bcrypt":
+		cost := section.Key("BCRYPT_ROUNDS").MustInt(bcrypt.DefaultCost)
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return fmt.Errorf("BCRYPT_ROUNDS must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		Default = &Bcrypt{Cost: cost}
+
+	case "argon2id", "argon":
+		argon := &Argon2id{
+			Memory:  uint32(section.Key("ARGON_MEMORY").MustUint(65536)),
+			Time:    uint32(section.Key("ARGON_TIME").MustUint(4)),
+			Threads: uint8(section.Key("ARGON_THREADS").MustUint(1)),
+		}
+		if argon.Memory == 0 || argon.Time == 0 || argon.Threads == 0 {
+			return fmt.Errorf("ARGON_MEMORY, ARGON_TIME and ARGON_THREADS must be greater than 0")
+		}
+		Default = argon
+
+	default:
+		return fmt.Errorf("%v password hasher is not supported", driver)
+	}
+	return nil
+}
+
+// 使用当前算法加密密码
+func Make(password string) (string, error) {
+	return Default.Make(password)
+}
+
+/**
+ * 校验密码，兼容其他算法以及旧版本的 MD5 密文
+ * @param string password 明文密码
+ * @param string hashed 数据库中保存的密文
+ * @return bool rehash 校验通过且密文不是由当前配置生成时为 true，调用方应重新加密后保存
+ */
+func Check(password, hashed string) (ok bool, rehash bool) {
+	var h Hasher
+	switch {
+	case isBcrypt(hashed):
+		h = &Bcrypt{}
+	case isArgon2id(hashed):
+		h = &Argon2id{}
+	case isMd5(hashed):
+		h = legacy
+	default:
+		return false, false
+	}
+
+	if !h.Check(password, hashed) {
+		return false, false
+	}
+	return true, Default.NeedsRehash(hashed)
+}
+
+// bcrypt 加密
+type Bcrypt struct {
+	Cost int
+}
+
+func (b *Bcrypt) Make(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func (b *Bcrypt) Check(password, hashed string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password)) == nil
+}
+
+func (b *Bcrypt) NeedsRehash(hashed string) bool {
+	if !isBcrypt(hashed) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hashed))
+	return err != nil || cost != b.Cost
+}
+
+func isBcrypt(hashed string) bool {
+	return strings.HasPrefix(hashed, "$2a$") || strings.HasPrefix(hashed, "$2b$") || strings.HasPrefix(hashed, "$2y$")
+}
+
+// argon2id 加密，密文采用 PHC 格式：$argon2id$v=19$m=65536,t=4,p=1$<salt>$<hash>
+type Argon2id struct {
+	Memory  uint32 // 内存开销，单位 KB
+	Time    uint32 // 迭代次数
+	Threads uint8  // 并行线程数
+}
+
+const (
+	argonSaltLength = 16
+	argonKeyLength  = 32
+)
+
+func (a *Argon2id) Make(password string) (string, error) {
+	salt := make([]byte, argonSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, argonKeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a *Argon2id) Check(password, hashed string) bool {
+	params, salt, key, err := decodeArgon2id(hashed)
+	if err != nil {
+		return false
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+func (a *Argon2id) NeedsRehash(hashed string) bool {
+	params, _, _, err := decodeArgon2id(hashed)
+	return err != nil || *params != *a
+}
+
+func isArgon2id(hashed string) bool {
+	return strings.HasPrefix(hashed, "$argon2id$")
+}
+
+// 解析 PHC 格式的 argon2id 密文
+func decodeArgon2id(hashed string) (*Argon2id, []byte, []byte, error) {
+	parts := strings.Split(hashed, "$")
+	if len(parts) != 6 || !isArgon2id(hashed) {
+		return nil, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, fmt.Errorf("unsupported argon2 version")
+	}
+
+	params := &Argon2id{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return nil, nil, nil, err
+	}
+	if params.Time == 0 || params.Threads == 0 {
+		return nil, nil, nil, fmt.Errorf("invalid argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return params, salt, key, nil
+}
+
+// 旧版本的无盐 MD5，只允许校验，不再用于加密新密码
+type Md5 struct{}
+
+func (m *Md5) Make(password string) (string, error) {
+	return "", fmt.Errorf("md5 is only supported for verifying legacy passwords")
+}
+
+func (m *Md5) Check(password, hashed string) bool {
+	sum := md5.Sum([]byte(password))
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(hashed))) == 1
+}
+
+func (m *Md5) NeedsRehash(hashed string) bool {
+	return true
+}
+
+func isMd5(hashed string) bool {
+	if len(hashed) != md5.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hashed)
+	return err == nil
+}
@@ -0,0 +1,132 @@
+package hasher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-ini/ini"
+)
+
+// 测试用的低开销参数
+var (
+	fastBcrypt = &Bcrypt{Cost: 4}
+	fastArgon  = &Argon2id{Memory: 64, Time: 1, Threads: 1}
+)
+
+func mustMake(t *testing.T, h Hasher, password string) string {
+	hashed, err := h.Make(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hashed
+}
+
+func TestCheck(t *testing.T) {
+	defer func(h Hasher) { Default = h }(Default)
+	Default = fastBcrypt
+
+	bcryptHash := mustMake(t, fastBcrypt, "secret")
+	strongerBcrypt := mustMake(t, &Bcrypt{Cost: 5}, "secret")
+	argonHash := mustMake(t, fastArgon, "secret")
+	// md5("secret")
+	md5Hash := "5ebe2294ecd0e0f08eab7690d2a6ee69"
+
+	cases := []struct {
+		name     string
+		password string
+		hashed   string
+		ok       bool
+		rehash   bool
+	}{
+		{"bcrypt", "secret", bcryptHash, true, false},
+		{"bcrypt wrong password", "Secret", bcryptHash, false, false},
+		{"bcrypt other cost", "secret", strongerBcrypt, true, true},
+		{"argon2id", "secret", argonHash, true, true},
+		{"argon2id wrong password", "secret1", argonHash, false, false},
+		{"legacy md5", "secret", md5Hash, true, true},
+		{"legacy md5 upper case", "secret", strings.ToUpper(md5Hash), true, true},
+		{"legacy md5 wrong password", "secret1", md5Hash, false, false},
+		{"plain text", "secret", "secret", false, false},
+		{"empty", "", "", false, false},
+		{"broken argon2id", "secret", "$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5", false, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ok, rehash := Check(c.password, c.hashed)
+			if ok != c.ok || rehash != c.rehash {
+				t.Errorf("Check() = %v, %v, want %v, %v", ok, rehash, c.ok, c.rehash)
+			}
+		})
+	}
+}
+
+// 切换到 argon2id 后，旧的 bcrypt 和 MD5 密文登录成功时都需要重新加密
+func TestCheckUpgradesToArgon2id(t *testing.T) {
+	defer func(h Hasher) { Default = h }(Default)
+	Default = fastArgon
+
+	for _, hashed := range []string{mustMake(t, fastBcrypt, "secret"), "5ebe2294ecd0e0f08eab7690d2a6ee69"} {
+		if ok, rehash := Check("secret", hashed); !ok || !rehash {
+			t.Errorf("Check(%q) = %v, %v, want true, true", hashed, ok, rehash)
+		}
+	}
+	if ok, rehash := Check("secret", mustMake(t, fastArgon, "secret")); !ok || rehash {
+		t.Errorf("Check(current argon2id) = %v, %v, want true, false", ok, rehash)
+	}
+	stronger := &Argon2id{Memory: 128, Time: 1, Threads: 1}
+	if ok, rehash := Check("secret", mustMake(t, stronger, "secret")); !ok || !rehash {
+		t.Errorf("Check(other argon2id params) = %v, %v, want true, true", ok, rehash)
+	}
+}
+
+func TestArgon2idFormat(t *testing.T) {
+	hashed := mustMake(t, fastArgon, "secret")
+	if !strings.HasPrefix(hashed, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("unexpected hash format %q", hashed)
+	}
+	if hashed == mustMake(t, fastArgon, "secret") {
+		t.Errorf("two hashes of the same password share a salt")
+	}
+}
+
+func TestMd5CannotMake(t *testing.T) {
+	if _, err := legacy.Make("secret"); err == nil {
+		t.Errorf("Md5.Make() should fail")
+	}
+}
+
+func TestInit(t *testing.T) {
+	defer func(h Hasher) { Default = h }(Default)
+
+	cases := []struct {
+		config string
+		want   Hasher
+	}{
+		{"", &Bcrypt{Cost: 10}},
+		{"HASH_DRIVER=bcrypt\nBCRYPT_ROUNDS=12", &Bcrypt{Cost: 12}},
+		{"HASH_DRIVER=argon2id\nARGON_MEMORY=1024\nARGON_TIME=2\nARGON_THREADS=2", &Argon2id{Memory: 1024, Time: 2, Threads: 2}},
+		{"HASH_DRIVER=bcrypt\nBCRYPT_ROUNDS=2", nil},
+		{"HASH_DRIVER=argon2id\nARGON_TIME=0", nil},
+		{"HASH_DRIVER=scrypt", nil},
+	}
+	for _, c := range cases {
+		cfg, err := ini.Load([]byte(c.config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = Init(cfg)
+		if c.want == nil {
+			if err == nil {
+				t.Errorf("Init(%q) should fail", c.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Init(%q) error: %v", c.config, err)
+			continue
+		}
+		if Default.NeedsRehash(mustMake(t, c.want, "secret")) {
+			t.Errorf("Init(%q) = %#v, want %#v", c.config, Default, c.want)
+		}
+	}
+}
@@ -3,12 +3,17 @@ package helper
 import (
 	"bytes"
 	"crypto/md5"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/transform"
 	"io/ioutil"
 	"math/rand"
 	"os/exec"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -17,6 +22,41 @@ func Md5(s string) string {
 	return fmt.Sprintf("%x", md5.Sum([]byte(s)))
 }
 
+// SHA256加密
+func Sha256(s string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+}
+
+/**
+ * 解析逗号分隔的ID列表，忽略非法值和重复值
+ * @param s string 如 "1,2,3"
+ */
+func ParseIds(s string) []int {
+	ids := make([]int, 0)
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(s, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || id <= 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+/**
+ * 生成密码学安全的随机令牌，用于重置密码、激活账号等场景
+ * @param n int 随机字节数，返回的十六进制字符串长度为 2n
+ */
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := crand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 /**
  * 生成随机的字符串
  * @param n int 随机字符串长度
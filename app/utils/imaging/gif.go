@@ -0,0 +1,137 @@
+package imaging
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// GIF 的块标识
+const (
+	gifExtension      = 0x21
+	gifImage          = 0x2C
+	gifTrailer        = 0x3B
+	gifCommentLabel   = 0xFE
+	gifApplicationTag = 0xFF
+)
+
+/**
+ * 去除 GIF 中的注释扩展和应用扩展（XMP 等），只保留控制循环播放的 NETSCAPE2.0、ANIMEXTS1.0
+ * 结束标记之后附带的数据全部丢弃
+ */
+func stripGif(r *bufio.Reader, w io.Writer) error {
+	// 文件头和逻辑屏幕描述符
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.HasPrefix(header, []byte("GIF8")) {
+		return ErrInvalidImage
+	}
+	bw := bufio.NewWriter(w)
+	bw.Write(header)
+	if err := copyColorTable(r, bw, header[10]); err != nil {
+		return err
+	}
+
+	for {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return ErrInvalidImage
+		}
+		switch kind {
+		case gifExtension:
+			label, err := r.ReadByte()
+			if err != nil {
+				return ErrInvalidImage
+			}
+			keep := label != gifCommentLabel
+			var first []byte
+			if label == gifApplicationTag {
+				// 应用扩展的第一个子块是 8 字节标识加 3 字节认证码
+				if first, err = readSubBlock(r); err != nil {
+					return err
+				}
+				id := string(first[1:12])
+				keep = id == "NETSCAPE2.0" || id == "ANIMEXTS1.0"
+			}
+			out := io.Writer(ioutil.Discard)
+			if keep {
+				out = bw
+			}
+			out.Write([]byte{kind, label})
+			out.Write(first)
+			if err := copySubBlocks(r, out); err != nil {
+				return err
+			}
+
+		case gifImage:
+			// 图像描述符、局部颜色表、LZW 最小码长和图像数据
+			descriptor := make([]byte, 9)
+			if _, err := io.ReadFull(r, descriptor); err != nil {
+				return ErrInvalidImage
+			}
+			bw.WriteByte(kind)
+			bw.Write(descriptor)
+			if err := copyColorTable(r, bw, descriptor[8]); err != nil {
+				return err
+			}
+			codeSize, err := r.ReadByte()
+			if err != nil {
+				return ErrInvalidImage
+			}
+			bw.WriteByte(codeSize)
+			if err := copySubBlocks(r, bw); err != nil {
+				return err
+			}
+
+		case gifTrailer:
+			bw.WriteByte(kind)
+			return bw.Flush()
+
+		default:
+			return ErrInvalidImage
+		}
+	}
+}
+
+// 按标志字节复制全局或局部颜色表
+func copyColorTable(r io.Reader, w io.Writer, flags byte) error {
+	if flags&0x80 == 0 {
+		return nil
+	}
+	size := int64(3 << (uint(flags&0x07) + 1))
+	if n, err := io.CopyN(w, r, size); err != nil || n != size {
+		return ErrInvalidImage
+	}
+	return nil
+}
+
+// 读取一个子块，包括开头的长度字节，长度为 0 的结束块不能用这个方法读取
+func readSubBlock(r *bufio.Reader) ([]byte, error) {
+	size, err := r.ReadByte()
+	if err != nil || size < 11 {
+		return nil, ErrInvalidImage
+	}
+	block := make([]byte, 1+int(size))
+	block[0] = size
+	if _, err := io.ReadFull(r, block[1:]); err != nil {
+		return nil, ErrInvalidImage
+	}
+	return block, nil
+}
+
+// 复制子块直到长度为 0 的结束块
+func copySubBlocks(r *bufio.Reader, w io.Writer) error {
+	for {
+		size, err := r.ReadByte()
+		if err != nil {
+			return ErrInvalidImage
+		}
+		w.Write([]byte{size})
+		if size == 0 {
+			return nil
+		}
+		if _, err := io.CopyN(w, r, int64(size)); err != nil {
+			return ErrInvalidImage
+		}
+	}
+}
@@ -0,0 +1,398 @@
+package imaging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"io/ioutil"
+)
+
+var ErrInvalidImage = errors.New("invalid image data")
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// 去除元数据时丢弃的 PNG 块：EXIF、文本注释和修改时间
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "iTXt": true, "zTXt": true, "tIME": true}
+
+// StripMetadata 能去除元数据的图片类型
+func StripsMetadata(mime string) bool {
+	switch mime {
+	case "image/jpeg", "image/png", "image/webp", "image/gif":
+		return true
+	}
+	return false
+}
+
+/**
+ * 去除图片中的 EXIF（含 GPS 定位）、XMP、IPTC 和注释等元数据，不重新编码，画质无损
+ * JPEG 保留 JFIF、ICC 色彩配置和 Adobe 段，丢弃 EOI 之后附带的数据，原图有旋转方向时写入只含方向的最小 EXIF，避免显示时方向错误
+ * @param string mime 处理 image/jpeg、image/png、image/webp 和 image/gif，其他类型原样复制
+ * @return int orientation EXIF 中的旋转方向，1 为正常，没有时为 1
+ */
+func StripMetadata(r io.Reader, w io.Writer, mime string) (orientation int, err error) {
+	switch mime {
+	case "image/jpeg":
+		return stripJpeg(bufio.NewReader(r), w)
+	case "image/png":
+		return 1, stripPng(r, w)
+	case "image/webp":
+		return 1, stripWebp(r, w)
+	case "image/gif":
+		return 1, stripGif(bufio.NewReader(r), w)
+	default:
+		_, err = io.Copy(w, r)
+		return 1, err
+	}
+}
+
+func stripJpeg(r *bufio.Reader, w io.Writer) (int, error) {
+	orientation, segments, err := readJpegHeader(r)
+	if err != nil {
+		return 0, err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write([]byte{0xFF, 0xD8})
+	if orientation != 1 {
+		bw.Write(orientationSegment(orientation))
+	}
+	segments.WriteTo(bw)
+	if err := copyScans(r, bw); err != nil {
+		return 0, err
+	}
+	return orientation, bw.Flush()
+}
+
+/**
+ * 复制扫描数据直到 EOI，渐进式 JPEG 各次扫描之间的段按同样的规则过滤
+ * EOI 之后的数据全部丢弃：手机拍摄的照片在其后附带 MPF 副图，副图中有完整的 EXIF 和 GPS
+ * 没有 EOI 的截断图片复制到文件结尾
+ */
+func copyScans(r *bufio.Reader, w *bufio.Writer) error {
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if b != 0xFF {
+			w.WriteByte(b)
+			continue
+		}
+
+		marker := byte(0xFF)
+		for marker == 0xFF {
+			if marker, err = r.ReadByte(); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+		switch {
+		case marker == 0x00 || (marker >= 0xD0 && marker <= 0xD7):
+			// 扫描数据中转义的 0xFF 和 RST 标记
+			w.Write([]byte{0xFF, marker})
+		case marker == 0xD9:
+			w.Write([]byte{0xFF, 0xD9})
+			return nil
+		default:
+			size, data, err := readSegment(r)
+			if err != nil {
+				return err
+			}
+			if keepSegment(marker, data) {
+				w.Write([]byte{0xFF, marker})
+				binary.Write(w, binary.BigEndian, size)
+				w.Write(data)
+			}
+		}
+	}
+}
+
+// 读取段的长度和内容
+func readSegment(r *bufio.Reader) (uint16, []byte, error) {
+	var size uint16
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil || size < 2 {
+		return 0, nil, ErrInvalidImage
+	}
+	data := make([]byte, size-2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, ErrInvalidImage
+	}
+	return size, data, nil
+}
+
+/**
+ * 是否保留该段：APP0 只保留 JFIF，APP2 只保留 ICC 色彩配置（MPF 索引等丢弃），APP14 只保留 Adobe 色彩变换，
+ * 其余 APP 段（EXIF、XMP、IPTC 等）和注释丢弃
+ */
+func keepSegment(marker byte, data []byte) bool {
+	switch {
+	case marker == 0xE0:
+		return bytes.HasPrefix(data, []byte("JFIF\x00"))
+	case marker == 0xE2:
+		return bytes.HasPrefix(data, []byte("ICC_PROFILE\x00"))
+	case marker == 0xEE:
+		return bytes.HasPrefix(data, []byte("Adobe"))
+	case marker >= 0xE1 && marker <= 0xEF, marker == 0xFE:
+		return false
+	}
+	return true
+}
+
+// 读取 JPEG 扫描数据之前的部分，返回旋转方向和去除元数据后的各段（含 SOS 段）
+func readJpegHeader(r *bufio.Reader) (int, *bytes.Buffer, error) {
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(r, soi); err != nil || soi[0] != 0xFF || soi[1] != 0xD8 {
+		return 0, nil, ErrInvalidImage
+	}
+
+	orientation := 1
+	segments := &bytes.Buffer{}
+	for {
+		marker, err := readMarker(r)
+		if err != nil {
+			return 0, nil, err
+		}
+		// 无长度的独立标记
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			segments.Write([]byte{0xFF, marker})
+			continue
+		}
+
+		size, data, err := readSegment(r)
+		if err != nil {
+			return 0, nil, err
+		}
+		if marker == 0xE1 && bytes.HasPrefix(data, []byte("Exif\x00\x00")) {
+			orientation = exifOrientation(data[6:])
+		}
+		if !keepSegment(marker, data) {
+			continue
+		}
+
+		segments.Write([]byte{0xFF, marker})
+		_ = binary.Write(segments, binary.BigEndian, size)
+		segments.Write(data)
+		if marker == 0xDA {
+			return orientation, segments, nil
+		}
+	}
+}
+
+// 读取下一个标记，跳过标记前的填充字节
+func readMarker(r *bufio.Reader) (byte, error) {
+	b, err := r.ReadByte()
+	if err != nil || b != 0xFF {
+		return 0, ErrInvalidImage
+	}
+	for {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, ErrInvalidImage
+		}
+		if b != 0xFF {
+			return b, nil
+		}
+	}
+}
+
+// 从 EXIF 的 TIFF 数据中读取 IFD0 的 Orientation（0x0112），读取失败时返回 1
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			value := int(order.Uint16(tiff[entry+8:]))
+			if value >= 1 && value <= 8 {
+				return value
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// 只含 Orientation 一项的 APP1 EXIF 段
+func orientationSegment(orientation int) []byte {
+	tiff := []byte{
+		'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08, // 大端序，IFD0 偏移为 8
+		0x00, 0x01, // 1 项
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, byte(orientation), 0x00, 0x00, // Orientation，SHORT
+		0x00, 0x00, 0x00, 0x00, // 没有下一个 IFD
+	}
+	data := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0x00, 0x00}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(data)+2))
+	return append(segment, data...)
+}
+
+func stripPng(r io.Reader, w io.Writer) error {
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, signature); err != nil || !bytes.Equal(signature, pngSignature) {
+		return ErrInvalidImage
+	}
+	if _, err := w.Write(signature); err != nil {
+		return err
+	}
+
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return ErrInvalidImage
+		}
+		length := int64(binary.BigEndian.Uint32(header[:4]))
+		chunkType := string(header[4:8])
+		// 数据和 CRC
+		body := io.LimitReader(r, length+4)
+		if pngMetadataChunks[chunkType] {
+			if _, err := io.Copy(ioutil.Discard, body); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if n, err := io.Copy(w, body); err != nil || n != length+4 {
+			return ErrInvalidImage
+		}
+		if chunkType == "IEND" {
+			return nil
+		}
+	}
+}
+
+// 读取 JPEG 中的旋转方向，没有时返回 1
+func Orientation(r io.Reader) int {
+	orientation, _, err := readJpegHeader(bufio.NewReader(r))
+	if err != nil {
+		return 1
+	}
+	return orientation
+}
+
+// 旋转方向 5~8 时宽高互换
+func DisplaySize(width, height, orientation int) (int, int) {
+	if orientation >= 5 && orientation <= 8 {
+		return height, width
+	}
+	return width, height
+}
+
+// 把图片绘制到白色背景的 RGBA 图上，透明部分变为白色
+func Flatten(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Over)
+	return dst
+}
+
+/**
+ * 等比缩小到长边不超过 size，按区域取平均值，原图更小时原样返回
+ */
+func Fit(src *image.RGBA, size int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if sw <= size && sh <= size {
+		return src
+	}
+	dw, dh := size, sh*size/sw
+	if sh > sw {
+		dw, dh = sw*size/sh, size
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, (y+1)*sh/dh
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, (x+1)*sw/dw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r, g, b, a = r+int(p[0]), g+int(p[1]), b+int(p[2]), a+int(p[3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// 按 EXIF 旋转方向把图片转正
+func Orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := DisplaySize(sw, sh, orientation)
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < sh; y++ {
+		for x := 0; x < sw; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // 水平翻转
+				dx, dy = sw-1-x, y
+			case 3: // 旋转 180°
+				dx, dy = sw-1-x, sh-1-y
+			case 4: // 垂直翻转
+				dx, dy = x, sh-1-y
+			case 5: // 沿左上-右下对角线翻转
+				dx, dy = y, x
+			case 6: // 顺时针旋转 90°
+				dx, dy = sh-1-y, x
+			case 7: // 沿右上-左下对角线翻转
+				dx, dy = sh-1-y, sw-1-x
+			case 8: // 逆时针旋转 90°
+				dx, dy = y, sw-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,202 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"io"
+	"testing"
+)
+
+// 编码一张小图，返回 SOI 之后的部分
+func encodeJpeg(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for x := 0; x < 16; x++ {
+		img.Set(x, x%8, color.RGBA{R: 200, A: 255})
+	}
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()[2:]
+}
+
+func segment(marker byte, data string) []byte {
+	s := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(s[2:], uint16(len(data)+2))
+	return append(s, data...)
+}
+
+// 带方向和 GPS 的 EXIF
+func exifSegment(orientation int) []byte {
+	tiff := "MM\x00\x2A\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00" + string(rune(orientation)) + "\x00\x00\x00\x00\x00\x00"
+	return segment(0xE1, "Exif\x00\x00"+tiff+"GPSLatitude=31.2304")
+}
+
+func TestStripJpegMetadata(t *testing.T) {
+	body := encodeJpeg(t)
+	secondary := append([]byte{0xFF, 0xD8}, exifSegment(1)...)
+	secondary = append(secondary, body...)
+
+	cases := []struct {
+		name        string
+		parts       [][]byte
+		orientation int
+		keep        []string
+	}{
+		{"exif", [][]byte{exifSegment(1), body}, 1, nil},
+		{"orientation", [][]byte{exifSegment(6), body}, 6, nil},
+		{"comment and xmp", [][]byte{segment(0xFE, "GPSLatitude"), segment(0xE1, "http://ns.adobe.com/xap/1.0/\x00GPSLatitude"), body}, 1, nil},
+		{"mpf and trailing image", [][]byte{exifSegment(1), segment(0xE2, "MPF\x00GPSLatitude"), body, secondary}, 1, nil},
+		{"trailing garbage", [][]byte{body, []byte("Exif GPSLatitude")}, 1, nil},
+		{"icc profile", [][]byte{segment(0xE2, "ICC_PROFILE\x00\x01\x01profile"), body}, 1, []string{"ICC_PROFILE"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			in := []byte{0xFF, 0xD8}
+			for _, part := range c.parts {
+				in = append(in, part...)
+			}
+			out := &bytes.Buffer{}
+			orientation, err := StripMetadata(bytes.NewReader(in), out, "image/jpeg")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if orientation != c.orientation {
+				t.Errorf("orientation = %d, want %d", orientation, c.orientation)
+			}
+			for _, leaked := range []string{"GPSLatitude", "MPF\x00"} {
+				if bytes.Contains(out.Bytes(), []byte(leaked)) {
+					t.Errorf("output still contains %q", leaked)
+				}
+			}
+			// 有旋转方向时只写回一个只含方向的 EXIF
+			want := 0
+			if c.orientation != 1 {
+				want = 1
+			}
+			if n := bytes.Count(out.Bytes(), []byte("Exif")); n != want {
+				t.Errorf("output has %d Exif segments, want %d", n, want)
+			}
+			for _, kept := range c.keep {
+				if !bytes.Contains(out.Bytes(), []byte(kept)) {
+					t.Errorf("output lost %q", kept)
+				}
+			}
+			if !bytes.HasSuffix(out.Bytes(), []byte{0xFF, 0xD9}) {
+				t.Errorf("output does not end with EOI")
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(out.Bytes())); err != nil {
+				t.Errorf("output is not a valid JPEG: %v", err)
+			}
+		})
+	}
+}
+
+func TestStripPngMetadata(t *testing.T) {
+	in := append([]byte{}, pngSignature...)
+	chunk := func(kind, data string) []byte {
+		c := make([]byte, 4)
+		binary.BigEndian.PutUint32(c, uint32(len(data)))
+		return append(append(c, kind+data...), 0, 0, 0, 0)
+	}
+	in = append(in, chunk("IHDR", "0123456789abc")...)
+	in = append(in, chunk("tEXt", "GPSLatitude")...)
+	in = append(in, chunk("eXIf", "MM GPSLatitude")...)
+	in = append(in, chunk("IEND", "")...)
+
+	out := &bytes.Buffer{}
+	if _, err := StripMetadata(bytes.NewReader(in), out, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(out.Bytes(), []byte("GPSLatitude")) {
+		t.Errorf("output still contains metadata")
+	}
+	if !bytes.Contains(out.Bytes(), []byte("IHDR")) || !bytes.Contains(out.Bytes(), []byte("IEND")) {
+		t.Errorf("output lost image chunks")
+	}
+}
+
+func TestStripWebpMetadata(t *testing.T) {
+	chunk := func(kind, data string) []byte {
+		c := append([]byte(kind), 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(c[4:], uint32(len(data)))
+		c = append(c, data...)
+		if len(data)%2 == 1 {
+			c = append(c, 0)
+		}
+		return c
+	}
+	var body []byte
+	body = append(body, chunk("VP8X", "\x0c\x00\x00\x00\x0f\x00\x00\x0f\x00\x00")...)
+	body = append(body, chunk("VP8L", "\x2f\x0f\xc0\x03\x00")...)
+	body = append(body, chunk("EXIF", "MM GPSLatitude=31.2304")...)
+	body = append(body, chunk("XMP ", "<x:xmpmeta>GPSLatitude</x:xmpmeta>")...)
+	in := append([]byte("RIFF\x00\x00\x00\x00WEBP"), body...)
+	binary.LittleEndian.PutUint32(in[4:8], uint32(len(body)+4))
+
+	// 不能 Seek 的输入读入内存后处理，结果相同
+	for name, r := range map[string]io.Reader{"seeker": bytes.NewReader(in), "reader": struct{ io.Reader }{bytes.NewReader(in)}} {
+		out := &bytes.Buffer{}
+		if _, err := StripMetadata(r, out, "image/webp"); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got := out.Bytes()
+		if bytes.Contains(got, []byte("GPSLatitude")) {
+			t.Errorf("%s: output still contains metadata", name)
+		}
+		if size := binary.LittleEndian.Uint32(got[4:8]); int(size) != len(got)-8 {
+			t.Errorf("%s: RIFF size = %d, want %d", name, size, len(got)-8)
+		}
+		if got[20]&(webpExifFlag|webpXmpFlag) != 0 {
+			t.Errorf("%s: VP8X still flags metadata: %#x", name, got[20])
+		}
+		if !bytes.Contains(got, chunk("VP8L", "\x2f\x0f\xc0\x03\x00")) {
+			t.Errorf("%s: output lost the image chunk", name)
+		}
+	}
+
+	if _, err := StripMetadata(bytes.NewReader(in[:30]), &bytes.Buffer{}, "image/webp"); err != ErrInvalidImage {
+		t.Errorf("truncated webp error = %v, want ErrInvalidImage", err)
+	}
+}
+
+func TestStripGifMetadata(t *testing.T) {
+	palette := color.Palette{color.White, color.Black}
+	frame := image.NewPaletted(image.Rect(0, 0, 4, 4), palette)
+	frame.SetColorIndex(1, 1, 1)
+	buf := &bytes.Buffer{}
+	if err := gif.EncodeAll(buf, &gif.GIF{Image: []*image.Paletted{frame, frame}, Delay: []int{10, 10}, LoopCount: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 在循环播放的扩展之后插入注释和 XMP 扩展
+	netscape := []byte("\x21\xff\x0bNETSCAPE2.0\x03\x01\x03\x00\x00")
+	i := bytes.Index(buf.Bytes(), netscape)
+	if i < 0 {
+		t.Fatal("encoded gif has no loop extension")
+	}
+	i += len(netscape)
+	comment := []byte("\x21\xfe\x0bGPSLatitude\x00")
+	xmp := []byte("\x21\xff\x0bXMP DataXMP\x0bGPSLatitude\x00")
+	in := append(append(append(append([]byte{}, buf.Bytes()[:i]...), comment...), xmp...), buf.Bytes()[i:]...)
+	in = append(in, "trailing GPSLatitude"...)
+
+	out := &bytes.Buffer{}
+	if _, err := StripMetadata(bytes.NewReader(in), out, "image/gif"); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(out.Bytes(), []byte("GPSLatitude")) {
+		t.Errorf("output still contains metadata")
+	}
+	decoded, err := gif.DecodeAll(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Image) != 2 || decoded.LoopCount != 3 {
+		t.Errorf("decoded %d frames with loop count %d, want 2 and 3", len(decoded.Image), decoded.LoopCount)
+	}
+}
@@ -0,0 +1,120 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+)
+
+// VP8X 扩展头中表示带有 EXIF、XMP 块的标志位
+const (
+	webpExifFlag = 0x08
+	webpXmpFlag  = 0x04
+)
+
+// 去除元数据时丢弃的 WebP 块
+var webpMetadataChunks = map[string]bool{"EXIF": true, "XMP ": true}
+
+type webpChunk struct {
+	kind string
+	size int64 // 数据长度，不含奇数长度时补齐的一个字节
+}
+
+/**
+ * 去除 WebP（RIFF 容器）中的 EXIF、XMP 块，并清除 VP8X 中对应的标志位
+ * RIFF 头中记录了整个文件的长度，先扫描一遍块头计算去除后的长度，不能 Seek 的输入先读入内存
+ */
+func stripWebp(r io.Reader, w io.Writer) error {
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		rs = bytes.NewReader(data)
+	}
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(rs, header); err != nil || string(header[:4]) != "RIFF" || string(header[8:]) != "WEBP" {
+		return ErrInvalidImage
+	}
+	chunks, err := webpChunks(rs, int64(binary.LittleEndian.Uint32(header[4:8]))-4)
+	if err != nil {
+		return err
+	}
+	riffSize := int64(4)
+	for _, c := range chunks {
+		if !webpMetadataChunks[c.kind] {
+			riffSize += 8 + c.size + c.size%2
+		}
+	}
+	if _, err := rs.Seek(start+12, io.SeekStart); err != nil {
+		return err
+	}
+
+	binary.LittleEndian.PutUint32(header[4:8], uint32(riffSize))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	chunkHeader := make([]byte, 8)
+	for _, c := range chunks {
+		if _, err := io.ReadFull(rs, chunkHeader); err != nil {
+			return ErrInvalidImage
+		}
+		body := io.LimitReader(rs, c.size+c.size%2)
+		if webpMetadataChunks[c.kind] {
+			if _, err := io.Copy(ioutil.Discard, body); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := w.Write(chunkHeader); err != nil {
+			return err
+		}
+		if c.kind == "VP8X" {
+			data, err := ioutil.ReadAll(body)
+			if err != nil || len(data) == 0 {
+				return ErrInvalidImage
+			}
+			data[0] &^= webpExifFlag | webpXmpFlag
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+			continue
+		}
+		if n, err := io.Copy(w, body); err != nil || n != c.size+c.size%2 {
+			return ErrInvalidImage
+		}
+	}
+	return nil
+}
+
+// 读取 RIFF 中的全部块头，length 为 WEBP 标识之后的长度，之后附带的数据忽略
+func webpChunks(r io.ReadSeeker, length int64) ([]webpChunk, error) {
+	chunks := make([]webpChunk, 0, 4)
+	header := make([]byte, 8)
+	for length >= 8 {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, ErrInvalidImage
+		}
+		c := webpChunk{kind: string(header[:4]), size: int64(binary.LittleEndian.Uint32(header[4:]))}
+		padded := c.size + c.size%2
+		if 8+padded > length {
+			return nil, ErrInvalidImage
+		}
+		if _, err := r.Seek(padded, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, c)
+		length -= 8 + padded
+	}
+	if len(chunks) == 0 {
+		return nil, ErrInvalidImage
+	}
+	return chunks, nil
+}
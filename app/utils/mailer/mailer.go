@@ -0,0 +1,177 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"github.com/go-ini/ini"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// 加密方式
+const (
+	EncryptionNone     = "none"     // 明文，适合本地调试用的 SMTP 服务（如 MailHog）
+	EncryptionTLS      = "tls"      // 隐式 TLS，一般为 465 端口
+	EncryptionStartTLS = "starttls" // 先明文连接再升级为 TLS，一般为 587 端口
+)
+
+type Config struct {
+	Host        string
+	Port        int
+	Username    string
+	Password    string
+	Encryption  string
+	FromAddress string
+	FromName    string
+	Timeout     time.Duration
+}
+
+type Mailer struct {
+	config Config
+}
+
+// 全局邮件发送器，由 bootstrap 初始化
+var Default *Mailer
+
+// 按配置初始化邮件发送器
+func Init(cfg *ini.File) error {
+	section := cfg.Section(ini.DefaultSection)
+	config := Config{
+		Host:        section.Key("MAIL_HOST").MustString("127.0.0.1"),
+		Port:        section.Key("MAIL_PORT").MustInt(25),
+		Username:    section.Key("MAIL_USERNAME").MustString(""),
+		Password:    section.Key("MAIL_PASSWORD").MustString(""),
+		Encryption:  strings.ToLower(section.Key("MAIL_ENCRYPTION").MustString(EncryptionNone)),
+		FromAddress: section.Key("MAIL_FROM_ADDRESS").MustString(""),
+		FromName:    section.Key("MAIL_FROM_NAME").MustString(section.Key("APP_NAME").MustString("go-chats")),
+		Timeout:     time.Duration(section.Key("MAIL_TIMEOUT").MustInt(10)) * time.Second,
+	}
+
+	switch config.Encryption {
+	case EncryptionNone, EncryptionTLS, EncryptionStartTLS:
+	default:
+		return fmt.Errorf("%v mail encryption is not supported", config.Encryption)
+	}
+
+	Default = New(config)
+	return nil
+}
+
+func New(config Config) *Mailer {
+	return &Mailer{config: config}
+}
+
+// 使用全局邮件发送器发送 HTML 邮件
+func Send(to, subject, body string) error {
+	if Default == nil {
+		return fmt.Errorf("mailer is not initialized")
+	}
+	return Default.Send(to, subject, body)
+}
+
+/**
+ * 发送 HTML 邮件
+ * @param string to 收件人地址
+ * @param string subject 邮件主题
+ * @param string body 邮件正文（HTML）
+ */
+func (m *Mailer) Send(to, subject, body string) error {
+	from := mail.Address{Name: m.config.FromName, Address: m.config.FromAddress}
+	if _, err := mail.ParseAddress(to); err != nil {
+		return fmt.Errorf("invalid recipient address %q: %v", to, err)
+	}
+
+	client, err := m.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if m.config.Username != "" {
+		auth := smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("smtp auth failed: %v", err)
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(m.build(from, to, subject, body)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// 建立 SMTP 连接，按配置处理 TLS
+func (m *Mailer) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.config.Host, fmt.Sprintf("%d", m.config.Port))
+	tlsConfig := &tls.Config{ServerName: m.config.Host}
+	dialer := &net.Dialer{Timeout: m.config.Timeout}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if m.config.Encryption == EncryptionTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("smtp connect failed: %v", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(m.config.Timeout))
+
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	if m.config.Encryption == EncryptionStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			_ = client.Close()
+			return nil, fmt.Errorf("smtp starttls failed: %v", err)
+		}
+	}
+	return client, nil
+}
+
+// 组装邮件内容，主题和正文使用 UTF-8 编码
+func (m *Mailer) build(from mail.Address, to, subject, body string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("From: %s\r\n", from.String()))
+	buf.WriteString(fmt.Sprintf("To: %s\r\n", to))
+	buf.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject)))
+	buf.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+	buf.WriteString("\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,172 @@
+package mailer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 假 SMTP 服务收到的内容
+type received struct {
+	auth string
+	from string
+	rcpt string
+	data string
+}
+
+/**
+ * 启动只接受一个连接的假 SMTP 服务
+ * @param string rcptReply 对 RCPT 命令的回复，返回 550 时模拟收件人被拒绝
+ */
+func fakeSMTP(t *testing.T, rcptReply string) (int, <-chan received) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(chan received, 1)
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		text := textproto.NewConn(conn)
+		got := received{}
+		defer func() { result <- got }()
+		_ = text.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch command {
+			case "EHLO", "HELO":
+				_ = text.PrintfLine("250-localhost\r\n250 AUTH PLAIN")
+			case "AUTH":
+				got.auth = line
+				_ = text.PrintfLine("235 2.7.0 Authentication successful")
+			case "MAIL":
+				got.from = line
+				_ = text.PrintfLine("250 OK")
+			case "RCPT":
+				got.rcpt = line
+				_ = text.PrintfLine("%s", rcptReply)
+			case "DATA":
+				_ = text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+				data, err := ioutil.ReadAll(text.DotReader())
+				if err != nil {
+					return
+				}
+				got.data = string(data)
+				_ = text.PrintfLine("250 OK")
+			case "QUIT":
+				_ = text.PrintfLine("221 Bye")
+				return
+			default:
+				_ = text.PrintfLine("250 OK")
+			}
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, result
+}
+
+func testConfig(port int) Config {
+	return Config{
+		Host:        "127.0.0.1",
+		Port:        port,
+		Username:    "user",
+		Password:    "pass",
+		Encryption:  EncryptionNone,
+		FromAddress: "noreply@example.com",
+		FromName:    "聊天室",
+		Timeout:     5 * time.Second,
+	}
+}
+
+func TestSend(t *testing.T) {
+	port, result := fakeSMTP(t, "250 OK")
+	body := "<p>" + strings.Repeat("验证你的邮箱 ", 20) + "</p>"
+	if err := New(testConfig(port)).Send("alice@example.com", "邮箱验证", body); err != nil {
+		t.Fatal(err)
+	}
+	got := <-result
+
+	wantAuth := "AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00user\x00pass"))
+	if got.auth != wantAuth {
+		t.Errorf("auth = %q, want %q", got.auth, wantAuth)
+	}
+	if got.from != "MAIL FROM:<noreply@example.com>" && !strings.HasPrefix(got.from, "MAIL FROM:<noreply@example.com> ") {
+		t.Errorf("from = %q", got.from)
+	}
+	if got.rcpt != "RCPT TO:<alice@example.com>" {
+		t.Errorf("rcpt = %q", got.rcpt)
+	}
+
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(got.data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "邮箱验证" {
+		t.Errorf("subject = %q, %v", subject, err)
+	}
+	from, err := msg.Header.AddressList("From")
+	if err != nil || len(from) != 1 || from[0].Name != "聊天室" || from[0].Address != "noreply@example.com" {
+		t.Errorf("from header = %v, %v", from, err)
+	}
+	if ct := msg.Header.Get("Content-Type"); ct != "text/html; charset=UTF-8" {
+		t.Errorf("content type = %q", ct)
+	}
+	raw, _ := ioutil.ReadAll(msg.Body)
+	for _, line := range strings.Split(strings.TrimRight(string(raw), "\n"), "\n") {
+		if len(line) > 76 {
+			t.Errorf("body line longer than 76 characters: %d", len(line))
+		}
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.NewReplacer("\r", "", "\n", "").Replace(string(raw)))
+	if err != nil || string(decoded) != body {
+		t.Errorf("body = %q, %v", decoded, err)
+	}
+}
+
+func TestSendRejectedRecipient(t *testing.T) {
+	port, result := fakeSMTP(t, "550 5.1.1 No such user")
+	err := New(testConfig(port)).Send("nobody@example.com", "subject", "body")
+	if err == nil || !strings.Contains(err.Error(), "No such user") {
+		t.Errorf("Send() error = %v, want rejected recipient", err)
+	}
+	if got := <-result; got.data != "" {
+		t.Errorf("message data sent after the recipient was rejected")
+	}
+}
+
+func TestSendInvalidRecipient(t *testing.T) {
+	// 地址不合法时不连接服务器
+	m := New(testConfig(1))
+	if err := m.Send("not an address", "subject", "body"); err == nil || !strings.Contains(err.Error(), "invalid recipient") {
+		t.Errorf("Send() error = %v, want invalid recipient", err)
+	}
+}
+
+func TestSendConnectFailed(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	if err := New(testConfig(port)).Send("alice@example.com", "subject", "body"); err == nil || !strings.Contains(err.Error(), "smtp connect failed") {
+		t.Errorf("Send() error = %v, want connect failure", err)
+	}
+}
@@ -0,0 +1,85 @@
+package signer
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/go-ini/ini"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("signature expired")
+)
+
+// 签名密钥，由 Init 从 APP_KEY 读取
+var key []byte
+
+// 按配置初始化签名密钥，未配置 APP_KEY 时生成随机密钥，重启后之前签发的令牌全部失效
+func Init(cfg *ini.File) error {
+	appKey := cfg.Section(ini.DefaultSection).Key("APP_KEY").MustString("")
+	if appKey != "" {
+		key = []byte(appKey)
+		return nil
+	}
+
+	log.Println("APP_KEY 未配置，使用随机密钥，重启服务后已签发的链接将失效")
+	key = make([]byte, 32)
+	_, err := rand.Read(key)
+	return err
+}
+
+/**
+ * 生成带有效期的签名令牌，令牌内容未加密，不要放入敏感数据
+ * @param string purpose 用途，不同用途的令牌不能混用
+ * @param string payload 令牌携带的数据
+ * @param time.Time expiresAt 过期时间
+ */
+func Sign(purpose, payload string, expiresAt time.Time) string {
+	data := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s|%d", payload, expiresAt.Unix())))
+	return data + "." + signature(purpose, data)
+}
+
+// 校验令牌的签名和有效期，返回令牌携带的数据
+func Verify(purpose, token string) (string, error) {
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return "", ErrInvalidSignature
+	}
+
+	data, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(signature(purpose, data))) {
+		return "", ErrInvalidSignature
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	j := strings.LastIndex(string(raw), "|")
+	if j < 0 {
+		return "", ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(string(raw[j+1:]), 10, 64)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	if time.Now().Unix() > expires {
+		return "", ErrExpired
+	}
+	return string(raw[:j]), nil
+}
+
+func signature(purpose, data string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose + ":" + data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,56 @@
+package signer
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	defer func(k []byte) { key = k }(key)
+	key = []byte("test-key")
+
+	valid := Sign("reset", "42|a@b.c", time.Now().Add(time.Hour))
+	data := valid[:strings.LastIndex(valid, ".")]
+	forged := base64.RawURLEncoding.EncodeToString([]byte("1|a@b.c|9999999999"))
+	// 改动签名的第一个字符
+	flipped := []byte(valid)
+	flipped[len(data)+1] ^= 1
+
+	cases := []struct {
+		name    string
+		purpose string
+		token   string
+		payload string
+		err     error
+	}{
+		{"valid", "reset", valid, "42|a@b.c", nil},
+		{"expired", "reset", Sign("reset", "42", time.Now().Add(-time.Second)), "", ErrExpired},
+		{"other purpose", "verify", valid, "", ErrInvalidSignature},
+		{"tampered payload", "reset", forged + valid[len(data):], "", ErrInvalidSignature},
+		{"tampered signature", "reset", string(flipped), "", ErrInvalidSignature},
+		{"truncated signature", "reset", valid[:len(valid)-1], "", ErrInvalidSignature},
+		{"no signature", "reset", data, "", ErrInvalidSignature},
+		{"empty", "reset", "", "", ErrInvalidSignature},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			payload, err := Verify(c.purpose, c.token)
+			if err != c.err || payload != c.payload {
+				t.Errorf("Verify() = %q, %v, want %q, %v", payload, err, c.payload, c.err)
+			}
+		})
+	}
+}
+
+// 更换密钥后之前签发的令牌全部失效
+func TestVerifyOtherKey(t *testing.T) {
+	defer func(k []byte) { key = k }(key)
+	key = []byte("old-key")
+	token := Sign("reset", "42", time.Now().Add(time.Hour))
+	key = []byte("new-key")
+	if _, err := Verify("reset", token); err != ErrInvalidSignature {
+		t.Errorf("Verify() error = %v, want %v", err, ErrInvalidSignature)
+	}
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrNotExist    = errors.New("storage: object does not exist")
+	ErrUnsupported = errors.New("storage: operation not supported by driver")
+)
+
+/**
+ * 存储驱动，文件按 key（以 / 分隔的相对路径）保存
+ * 本地磁盘只适合单实例部署，多实例部署时使用 S3 兼容的对象存储
+ */
+type Driver interface {
+	// 保存文件，已存在时覆盖；size 为内容长度，mime 为空时使用 application/octet-stream
+	Put(key string, r io.Reader, size int64, mime string) error
+	// 读取文件，不存在时返回 ErrNotExist，调用方负责关闭
+	Get(key string) (io.ReadCloser, error)
+	// 文件信息，不存在时返回 ErrNotExist
+	Stat(key string) (*Object, error)
+	// 删除文件，不存在时不报错
+	Delete(key string) error
+	/**
+	 * 生成有效期内可直接下载的地址，不支持时返回 ErrUnsupported
+	 * @param string mime 下载时的 Content-Type，为空时使用保存时的类型
+	 * @param string disposition 下载时的 Content-Disposition，可以为空
+	 */
+	SignedURL(key string, expires time.Duration, mime, disposition string) (string, error)
+}
+
+// 存储中的文件信息
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"go-chats/app/utils/filer"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 本地磁盘存储，文件保存在 root 目录下
+type Local struct {
+	root string
+}
+
+// 创建本地磁盘存储，目录不存在时自动创建
+func NewLocal(root string) (*Local, error) {
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &Local{root: root}, nil
+}
+
+// 文件在磁盘上的路径，key 中的 .. 不会越出根目录
+func (l *Local) Path(key string) string {
+	return filepath.Join(l.root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+// 先写入同目录下的临时文件再改名，读取方不会看到写了一半的文件
+func (l *Local) Put(key string, r io.Reader, size int64, mime string) error {
+	target := l.Path(key)
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(target), ".put-")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), target)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// 把同一磁盘上的临时文件直接改名到 key，省去一次复制
+func (l *Local) Rename(tmpPath, key string) error {
+	target := l.Path(key)
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, target)
+}
+
+// 把文件的修改时间更新为当前时间
+func (l *Local) Touch(key string) error {
+	now := time.Now()
+	if err := os.Chtimes(l.Path(key), now, now); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotExist
+		}
+		return err
+	}
+	return nil
+}
+
+// 返回的 *os.File 支持 Seek，下载时可以按 Range 分段返回
+func (l *Local) Get(key string) (io.ReadCloser, error) {
+	if !filer.IsFile(l.Path(key)) {
+		return nil, ErrNotExist
+	}
+	return os.Open(l.Path(key))
+}
+
+func (l *Local) Stat(key string) (*Object, error) {
+	stat, err := os.Stat(l.Path(key))
+	if err != nil || stat.IsDir() {
+		return nil, ErrNotExist
+	}
+	return &Object{Key: key, Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+func (l *Local) Delete(key string) error {
+	if err := os.Remove(l.Path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+/**
+ * 用 filer.GetAllFiles 扫描目录下的全部文件
+ * @param []string skip 跳过的顶层目录
+ * @return map[string]*Object 以 key 为键
+ */
+func (l *Local) Files(skip ...string) (map[string]*Object, error) {
+	paths, err := filer.GetAllFiles(l.root)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*Object, len(paths))
+	for _, p := range paths {
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			continue
+		}
+		key := filepath.ToSlash(rel)
+		if skipped(key, skip) {
+			continue
+		}
+		if object, err := l.Stat(key); err == nil {
+			files[key] = object
+		}
+	}
+	return files, nil
+}
+
+func skipped(key string, dirs []string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(key, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// 本地文件由应用自己读取后返回，没有可直接下载的地址
+func (l *Local) SignedURL(key string, expires time.Duration, mime, disposition string) (string, error) {
+	return "", ErrUnsupported
+}
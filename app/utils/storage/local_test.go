@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	l, err := NewLocal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := "hello local"
+	if err := l.Put("ab/abcdef", strings.NewReader(content), int64(len(content)), ""); err != nil {
+		t.Fatal(err)
+	}
+	object, err := l.Stat("ab/abcdef")
+	if err != nil || object.Size != int64(len(content)) || object.Key != "ab/abcdef" {
+		t.Fatalf("Stat() = %+v, %v", object, err)
+	}
+	r, err := l.Get("ab/abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(data) != content {
+		t.Errorf("Get() = %q, want %q", data, content)
+	}
+
+	// 覆盖已有文件
+	if err := l.Put("ab/abcdef", strings.NewReader("new"), 3, ""); err != nil {
+		t.Fatal(err)
+	}
+	if object, _ := l.Stat("ab/abcdef"); object == nil || object.Size != 3 {
+		t.Errorf("Put() did not overwrite the file: %+v", object)
+	}
+
+	// 临时文件直接改名到目标位置
+	tmp := filepath.Join(root, "tmp", "upload-1")
+	if err := os.MkdirAll(filepath.Dir(tmp), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(tmp, []byte("renamed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Rename(tmp, "cd/cdef"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("temp file still exists after Rename()")
+	}
+
+	files, err := l.Files("tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files["ab/abcdef"] == nil || files["cd/cdef"] == nil {
+		t.Errorf("Files() = %v", files)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(l.Path("cd/cdef"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Touch("cd/cdef"); err != nil {
+		t.Fatal(err)
+	}
+	if object, _ := l.Stat("cd/cdef"); object == nil || object.ModTime.Before(time.Now().Add(-time.Minute)) {
+		t.Errorf("Touch() did not update the modification time: %+v", object)
+	}
+	if err := l.Touch("missing"); err != ErrNotExist {
+		t.Errorf("Touch() of a missing file error = %v, want ErrNotExist", err)
+	}
+
+	if err := l.Delete("ab/abcdef"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Stat("ab/abcdef"); err != ErrNotExist {
+		t.Errorf("Stat() after delete error = %v, want ErrNotExist", err)
+	}
+	if _, err := l.Get("ab/abcdef"); err != ErrNotExist {
+		t.Errorf("Get() after delete error = %v, want ErrNotExist", err)
+	}
+	if err := l.Delete("ab/abcdef"); err != nil {
+		t.Errorf("Delete() of a missing file error = %v", err)
+	}
+	if _, err := l.SignedURL("cd/cdef", time.Minute, "", ""); err != ErrUnsupported {
+		t.Errorf("SignedURL() error = %v, want ErrUnsupported", err)
+	}
+}
+
+// key 中的 .. 不能越出根目录
+func TestLocalPathStaysInRoot(t *testing.T) {
+	root := t.TempDir()
+	l, err := NewLocal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"../secret", "a/../../secret", "/etc/passwd"} {
+		p := l.Path(key)
+		if rel, err := filepath.Rel(root, p); err != nil || strings.HasPrefix(rel, "..") {
+			t.Errorf("Path(%q) = %s escapes the root", key, p)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/go-ini/ini"
+	"go-chats/app/utils/filer"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// 附件的本地工作目录，由 Init 从 ATTACHMENT_DIR 读取，存放上传中的临时文件和分片，不对外公开访问
+var dir string
+
+var (
+	// 聊天附件的存储，不对外公开，只能通过 /attachments/:id 鉴权下载
+	Attachments Driver
+	// 公开文件的存储，通过 /storage/ 地址访问
+	Public Driver
+	// 下载时是否跳转到存储的预签名地址，否则由应用读取后返回
+	redirect bool
+	// 预签名地址的有效期
+	urlExpire time.Duration
+)
+
+// 本地驱动可以直接把临时文件改名到目标位置，省去一次复制
+type renamer interface {
+	Rename(tmpPath, key string) error
+}
+
+// 本地驱动可以刷新文件的修改时间，对账时按修改时间判断无主文件是否还在保留期内
+type toucher interface {
+	Touch(key string) error
+}
+
+/**
+ * 按配置初始化存储，STORAGE_DRIVER 为 local 时附件保存在 ATTACHMENT_DIR、公开文件在 STORAGE_DIR
+ * 为 s3 时两者保存在同一个 bucket 的 attachments/ 和 public/ 下
+ */
+func Init(cfg *ini.File) error {
+	section := cfg.Section(ini.DefaultSection)
+	dir = section.Key("ATTACHMENT_DIR").MustString("./storage/app/attachments")
+	if err := os.MkdirAll(filepath.Join(dir, "tmp"), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "chunks"), os.ModePerm); err != nil {
+		return err
+	}
+	redirect = section.Key("S3_REDIRECT").MustBool(true)
+	urlExpire = time.Duration(section.Key("S3_URL_EXPIRE").MustInt(10)) * time.Minute
+
+	switch driver := section.Key("STORAGE_DRIVER").MustString("local"); driver {
+	case "local":
+		attachments, err := NewLocal(dir)
+		if err != nil {
+			return err
+		}
+		public, err := NewLocal(section.Key("STORAGE_DIR").MustString("/storage/app/public"))
+		if err != nil {
+			return err
+		}
+		Attachments, Public = attachments, public
+	case "s3":
+		config := S3Config{
+			Endpoint:  section.Key("S3_ENDPOINT").MustString(""),
+			Region:    section.Key("S3_REGION").MustString("us-east-1"),
+			Bucket:    section.Key("S3_BUCKET").MustString(""),
+			AccessKey: section.Key("S3_ACCESS_KEY").MustString(""),
+			SecretKey: section.Key("S3_SECRET_KEY").MustString(""),
+			PathStyle: section.Key("S3_PATH_STYLE").MustBool(true),
+		}
+		config.Prefix = "attachments/"
+		attachments, err := NewS3(config)
+		if err != nil {
+			return err
+		}
+		config.Prefix = "public/"
+		public, err := NewS3(config)
+		if err != nil {
+			return err
+		}
+		Attachments, Public = attachments, public
+	default:
+		return fmt.Errorf("storage: unknown STORAGE_DRIVER %q", driver)
+	}
+	return nil
+}
+
+// 在工作目录下创建临时文件，上传内容先写入临时文件，校验通过后再调用 Put 保存
+func TempFile() (*os.File, error) {
+	return ioutil.TempFile(filepath.Join(dir, "tmp"), "upload-")
+}
+
+/**
+ * 按内容保存临时文件，以 MD5 作为文件名，内容相同的文件只保存一份
+ * @param string tmpPath 临时文件路径，保存后临时文件被移走或删除
+ * @return string key 文件在附件存储中的 key
+ * @return string checksum 文件的 MD5
+ */
+func Put(tmpPath string) (key, checksum string, err error) {
+	checksum, err = filer.Md5(tmpPath)
+	if err != nil {
+		return "", "", err
+	}
+	key, err = PutAs(tmpPath, checksum)
+	return key, checksum, err
+}
+
+/**
+ * 按已校验过的 MD5 保存临时文件，避免大文件重复计算
+ * 文件已存在时刷新修改时间，避免附件记录保存前被对账当作过期的无主文件删除
+ */
+func PutAs(tmpPath, checksum string) (key string, err error) {
+	key = checksum[:2] + "/" + checksum
+	if _, err = Attachments.Stat(key); err == nil {
+		if t, ok := Attachments.(toucher); ok {
+			if err = t.Touch(key); err != nil {
+				return "", err
+			}
+		}
+		return key, os.Remove(tmpPath)
+	} else if err != ErrNotExist {
+		return "", err
+	}
+	if r, ok := Attachments.(renamer); ok {
+		return key, r.Rename(tmpPath, key)
+	}
+
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpPath)
+	defer f.Close()
+	size, err := filer.Size(tmpPath)
+	if err != nil {
+		return "", err
+	}
+	return key, Attachments.Put(key, f, size, "")
+}
+
+// 按指定的 key 保存附件的衍生文件（如缩略图），已存在时覆盖
+func Write(key string, data []byte, mime string) error {
+	return Attachments.Put(key, bytes.NewReader(data), int64(len(data)), mime)
+}
+
+// 读取附件存储中的文件
+func Open(key string) (io.ReadCloser, error) {
+	return Attachments.Get(key)
+}
+
+// 本地附件存储中的全部文件（不含上传中的临时文件和分片），对象存储返回 ErrUnsupported
+func AttachmentFiles() (map[string]*Object, error) {
+	local, ok := Attachments.(*Local)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return local.Files("tmp", "chunks")
+}
+
+/**
+ * 可以直接下载文件的预签名地址，驱动不支持或配置了由应用返回文件时返回空字符串
+ * @param string mime 下载时的 Content-Type
+ * @param string disposition 下载时的 Content-Disposition
+ */
+func RedirectURL(d Driver, key, mime, disposition string) (string, error) {
+	if !redirect {
+		return "", nil
+	}
+	u, err := d.SignedURL(key, urlExpire, mime, disposition)
+	if err == ErrUnsupported {
+		return "", nil
+	}
+	return u, err
+}
+
+// 分片在附件存储中的 key，使用对象存储时多个实例共用分片，同一上传任务的请求不必转发到同一实例
+func chunkKey(uploadId, number int) string {
+	return "chunks/" + strconv.Itoa(uploadId) + "/" + strconv.Itoa(number)
+}
+
+/**
+ * 保存分片上传的一个分片，先写入本地临时文件再保存到附件存储，中途断开不会留下不完整的分片
+ * 同一分片重复上传时覆盖
+ * @return int64 分片的实际大小
+ */
+func PutChunk(uploadId, number int, r io.Reader) (int64, error) {
+	tmp, err := TempFile()
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	size, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	key := chunkKey(uploadId, number)
+	if rn, ok := Attachments.(renamer); ok {
+		return size, rn.Rename(tmp.Name(), key)
+	}
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return size, Attachments.Put(key, f, size, "")
+}
+
+/**
+ * 按序号从附件存储读取分片并合并到临时文件，分片编号从 0 开始
+ * @return string 合并后的临时文件路径，由调用方保存或删除
+ */
+func MergeChunks(uploadId, total int) (string, error) {
+	tmp, err := TempFile()
+	if err != nil {
+		return "", err
+	}
+	for number := 0; number < total; number++ {
+		if err = appendChunk(tmp, chunkKey(uploadId, number)); err != nil {
+			break
+		}
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+func appendChunk(w io.Writer, key string) error {
+	r, err := Attachments.Get(key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+/**
+ * 删除分片上传的全部分片
+ * @param int total 上传任务的分片数，对象存储不能按目录删除，逐个删除序号范围内的分片
+ */
+func RemoveChunks(uploadId, total int) error {
+	if _, ok := Attachments.(*Local); ok {
+		return os.RemoveAll(filepath.Join(dir, "chunks", strconv.Itoa(uploadId)))
+	}
+	for number := 0; number < total; number++ {
+		if err := Attachments.Delete(chunkKey(uploadId, number)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 本地存储中有分片的上传ID，用于清理数据库中已没有记录的分片，对象存储不能列出文件，返回 ErrUnsupported
+func ChunkUploadIds() ([]int, error) {
+	if _, ok := Attachments.(*Local); !ok {
+		return nil, ErrUnsupported
+	}
+	dirs, err := filer.GetDirFiles(filepath.Join(dir, "chunks"), 1)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(dirs))
+	for _, d := range dirs {
+		if id, err := strconv.Atoi(filepath.Base(d)); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// 删除修改时间早于 before 的临时文件，这些文件是进程异常退出时遗留的
+func RemoveStaleTempFiles(before time.Time) (int, error) {
+	files, err := filer.GetDirFiles(filepath.Join(dir, "tmp"), 0)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, f := range files {
+		if stat, err := os.Stat(f); err == nil && stat.ModTime().Before(before) {
+			if os.Remove(f) == nil {
+				removed++
+			}
+		}
+	}
+	return removed, nil
+}
@@ -6,17 +6,27 @@ import (
 	"fmt"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-contrib/sessions/redis"
 	"github.com/gin-gonic/gin"
 	"github.com/go-ini/ini"
 	"go-chats/app/global/variable"
+	"go-chats/app/http/middleware"
+	"go-chats/app/hub"
+	"go-chats/app/media"
 	"go-chats/app/model"
 	"go-chats/app/utils/filer"
+	"go-chats/app/utils/hasher"
+	"go-chats/app/utils/helper"
+	"go-chats/app/utils/mailer"
+	"go-chats/app/utils/signer"
+	"go-chats/app/utils/storage"
 	"go-chats/routers"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -24,6 +34,9 @@ import (
 type Bootstrap struct{}
 
 func Init(e *gin.Engine, cfg *ini.File) {
+	// 保存全局配置
+	variable.Config = cfg
+
 	// 自定义日志格式
 	LoggerWithFormatter(e)
 
@@ -33,11 +46,29 @@ func Init(e *gin.Engine, cfg *ini.File) {
 	// 初始化数据库连接
 	InitDB(cfg)
 
+	// 初始化密码加密算法
+	InitHasher(cfg)
+
+	// 初始化邮件发送
+	InitMailer(cfg)
+
+	// 初始化签名密钥
+	InitSigner(cfg)
+
+	// 初始化文件存储
+	InitStorage(cfg)
+
 	// 加载模板
 	LoadHTMLGlob(e)
 
 	// 启用Session
-	EnableSession(e)
+	EnableSession(e, cfg)
+
+	// 启动WebSocket消息中心
+	InitHub()
+
+	// 启动图片处理队列
+	InitMedia(cfg)
 
 	// 初始化路由
 	routers.InitRouter(e)
@@ -54,11 +85,7 @@ func MappingDirectory(engine *gin.Engine, cfg *ini.File) {
 	}
 	engine.StaticFS("/static", http.Dir(staticDir))
 
-	storageDir := cfg.Section(ini.DefaultSection).Key("STORAGE_DIR").MustString("/storage/app/public")
-	if !filer.IsDir(storageDir) {
-		_ = os.MkdirAll(storageDir, os.ModePerm)
-	}
-	engine.StaticFS("/storage", http.Dir(storageDir))
+	// /storage 下的公开文件可能在对象存储中，由 StorageController 处理
 }
 
 // 自定义日志格式
@@ -128,11 +155,16 @@ func (b *Bootstrap) listenSignal(ctx context.Context, srv *http.Server) {
 
 	<-sig // 接收到信号量
 	log.Println("正在关闭服务器 ...")
-	timeoutCtx, _ := context.WithTimeout(ctx, 1 * time.Second) // 设置超过N秒所有程序未闲置也会硬终止服务
+	timeoutCtx, cancel := context.WithTimeout(ctx, 1 * time.Second) // 设置超过N秒所有程序未闲置也会硬终止服务
+	defer cancel()
 	if err := srv.Shutdown(timeoutCtx); err != nil {
 		log.Fatal("服务器关闭:", err)
 	}
 
+	// Shutdown 不会处理已被接管的 WebSocket 连接，需要单独关闭
+	hub.Default.Close()
+	model.Checker.Close()
+
 	select {
 	case <-timeoutCtx.Done():
 		// 捕获ctx.Done()  5秒超时。
@@ -143,7 +175,74 @@ func (b *Bootstrap) listenSignal(ctx context.Context, srv *http.Server) {
 
 // 初始化数据库连接
 func InitDB(cfg *ini.File) {
-	_, _ = model.InitDB(cfg)
+	db, err := model.InitDB(cfg)
+	if err != nil {
+		log.Fatalf("数据库初始化失败: %v", err)
+	}
+
+	// 定时检查数据库连接
+	model.Checker, err = model.NewHealthChecker(db, cfg)
+	if err != nil {
+		log.Fatalf("数据库初始化失败: %v", err)
+	}
+	go model.Checker.Run()
+}
+
+// 启动WebSocket消息中心
+func InitHub() {
+	hub.Default = hub.NewHub()
+	go hub.Default.Run()
+}
+
+// 启动图片处理队列，处理完成后通知会话成员更新缩略图
+func InitMedia(cfg *ini.File) {
+	media.Default = media.NewProcessor(cfg)
+	media.Default.OnProcessed = hub.Default.AttachmentProcessed
+	go media.Default.Resume()
+}
+
+// 初始化密码加密算法
+func InitHasher(cfg *ini.File) {
+	if err := hasher.Init(cfg); err != nil {
+		log.Fatalf("密码加密算法配置错误: %v", err)
+	}
+}
+
+// 初始化邮件发送
+func InitMailer(cfg *ini.File) {
+	if err := mailer.Init(cfg); err != nil {
+		log.Fatalf("邮件配置错误: %v", err)
+	}
+}
+
+// 初始化签名密钥
+func InitSigner(cfg *ini.File) {
+	if err := signer.Init(cfg); err != nil {
+		log.Fatalf("签名密钥初始化失败: %v", err)
+	}
+}
+
+// 初始化文件存储
+func InitStorage(cfg *ini.File) {
+	if err := storage.Init(cfg); err != nil {
+		log.Fatalf("文件存储初始化失败: %v", err)
+	}
+
+	section := cfg.Section(ini.DefaultSection)
+	model.UserStorageQuota = section.Key("USER_STORAGE_QUOTA").MustInt64(1024) << 20
+	model.GroupStorageQuota = section.Key("GROUP_STORAGE_QUOTA").MustInt64(10240) << 20
+	model.VoiceMaxDuration = section.Key("VOICE_MAX_DURATION").MustInt(60) * 1000
+	model.VoiceMaxSize = section.Key("VOICE_MAX_SIZE").MustInt64(2048) << 10
+	model.MaxOpenUploads = section.Key("UPLOAD_MAX_OPEN").MustInt(5)
+
+	// 每小时清理一次超时未完成的分片上传
+	ttl := time.Duration(section.Key("UPLOAD_EXPIRE").MustInt(24)) * time.Hour
+	go model.RunUploadCollector(time.Hour, ttl)
+
+	// 定期对账，修正存储用量的偏差
+	if interval := section.Key("STORAGE_RECONCILE_INTERVAL").MustInt(24); interval > 0 {
+		go model.RunStorageReconciler(time.Duration(interval) * time.Hour)
+	}
 }
 
 // 加载模板
@@ -152,12 +251,106 @@ func LoadHTMLGlob(r *gin.Engine) {
 }
 
 // 启用Session
-func EnableSession(r *gin.Engine) {
+func EnableSession(r *gin.Engine, cfg *ini.File) {
 	gob.Register(variable.UserSessionData{}) // 跨路由存取复杂结构的session数据，需要注册数据类型
-	store := cookie.NewStore([]byte("secret"))
-	// store.Options(sessions.Options{
-	// 	MaxAge: int(30 * time.Minute), // 30min
-	// 	Path:   "/",
-	// })
-	r.Use(sessions.Sessions("session", store))
+	section := cfg.Section(ini.DefaultSection)
+
+	store, err := newSessionStore(cfg)
+	if err != nil {
+		log.Fatalf("Session初始化失败: %v", err)
+	}
+
+	sameSite := http.SameSiteLaxMode
+	switch strings.ToLower(section.Key("SESSION_SAME_SITE").MustString("lax")) {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+
+	options := sessions.Options{
+		Path:     section.Key("SESSION_PATH").MustString("/"),
+		Domain:   section.Key("SESSION_DOMAIN").MustString(""),
+		MaxAge:   section.Key("SESSION_LIFETIME").MustInt(120) * 60,
+		Secure:   section.Key("SESSION_SECURE").MustBool(false),
+		HttpOnly: section.Key("SESSION_HTTP_ONLY").MustBool(true),
+		SameSite: sameSite,
+	}
+	store.Options(options)
+	middleware.SessionOptions = options
+	r.Use(sessions.Sessions(section.Key("SESSION_NAME").MustString("session"), store))
+}
+
+// 按 SESSION_DRIVER 创建Session存储，cookie 为客户端存储，redis 为服务端存储，注销后可立即失效
+func newSessionStore(cfg *ini.File) (sessions.Store, error) {
+	section := cfg.Section(ini.DefaultSection)
+	keyPairs, err := sessionKeyPairs(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	driver := strings.ToLower(section.Key("SESSION_DRIVER").MustString("cookie"))
+	switch driver {
+	case "cookie":
+		return cookie.NewStore(keyPairs...), nil
+
+	case "redis":
+		addr := fmt.Sprintf("%s:%s", section.Key("REDIS_HOST").MustString("127.0.0.1"), section.Key("REDIS_PORT").MustString("6379"))
+		store, err := redis.NewStoreWithDB(
+			section.Key("SESSION_REDIS_POOL").MustInt(10),
+			"tcp",
+			addr,
+			section.Key("REDIS_PASSWORD").MustString(""),
+			section.Key("REDIS_DB").MustString("0"),
+			keyPairs...,
+		)
+		if err != nil {
+			return nil, err
+		}
+		prefix := fmt.Sprintf("%s:session:", section.Key("APP_NAME").MustString("go-chats"))
+		if err := redis.SetKeyPrefix(store, prefix); err != nil {
+			return nil, err
+		}
+		return store, nil
+
+	default:
+		return nil, fmt.Errorf("%v session driver is not supported", driver)
+	}
+}
+
+/**
+ * 读取Session签名和加密密钥，支持多个密钥轮换：第一个密钥用于签名新的Session，其余密钥只用于校验旧Session
+ * SESSION_KEYS 为逗号分隔的签名密钥，未配置时使用 APP_KEY
+ * SESSION_ENCRYPTION_KEYS 为逗号分隔的加密密钥（可选），与签名密钥按顺序一一对应，长度必须为16、24或32字节
+ */
+func sessionKeyPairs(cfg *ini.File) ([][]byte, error) {
+	section := cfg.Section(ini.DefaultSection)
+	authKeys := section.Key("SESSION_KEYS").Strings(",")
+	if len(authKeys) == 0 {
+		if appKey := section.Key("APP_KEY").MustString(""); appKey != "" {
+			authKeys = []string{appKey}
+		}
+	}
+	if len(authKeys) == 0 {
+		log.Println("SESSION_KEYS 和 APP_KEY 均未配置，使用随机密钥，重启服务后所有用户需要重新登录")
+		randomKey, err := helper.RandomToken(32)
+		if err != nil {
+			return nil, err
+		}
+		authKeys = []string{randomKey}
+	}
+
+	encryptionKeys := section.Key("SESSION_ENCRYPTION_KEYS").Strings(",")
+	keyPairs := make([][]byte, 0, len(authKeys)*2)
+	for i, authKey := range authKeys {
+		var encryptionKey []byte
+		if i < len(encryptionKeys) {
+			encryptionKey = []byte(encryptionKeys[i])
+			if l := len(encryptionKey); l != 16 && l != 24 && l != 32 {
+				return nil, fmt.Errorf("SESSION_ENCRYPTION_KEYS #%d must be 16, 24 or 32 bytes", i+1)
+			}
+		}
+		keyPairs = append(keyPairs, []byte(authKey), encryptionKey)
+	}
+	return keyPairs, nil
 }
@@ -0,0 +1,85 @@
+package bootstrap
+
+import (
+	"fmt"
+	"github.com/go-ini/ini"
+	"go-chats/app/model"
+	"go-chats/database/migrations"
+)
+
+const migrateUsage = `Usage: go-chats migrate <command>
+
+Commands:
+  up      执行全部未执行的迁移
+  down    回滚最后一个批次的迁移
+  status  查看迁移执行状态`
+
+/**
+ * 数据库迁移命令：go-chats migrate up|down|status
+ * @param []string args migrate 之后的命令行参数
+ * @return int 进程退出码
+ */
+func Migrate(cfg *ini.File, args []string) int {
+	if len(args) != 1 {
+		fmt.Println(migrateUsage)
+		return 2
+	}
+
+	db, err := model.Open(cfg)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	migrator := migrations.New(db)
+
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up()
+		for _, version := range done {
+			fmt.Printf("Migrated:    %s\n", version)
+		}
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		if len(done) == 0 {
+			fmt.Println("Nothing to migrate.")
+		}
+
+	case "down":
+		done, err := migrator.Down()
+		for _, version := range done {
+			fmt.Printf("Rolled back: %s\n", version)
+		}
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		if len(done) == 0 {
+			fmt.Println("Nothing to rollback.")
+		}
+
+	case "status":
+		list, err := migrator.Status()
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		fmt.Printf("%-4s  %-5s  %s\n", "Ran", "Batch", "Migration")
+		for _, status := range list {
+			ran, batch := "No", "-"
+			if status.Ran {
+				ran, batch = "Yes", fmt.Sprintf("%d", status.Batch)
+			}
+			fmt.Printf("%-4s  %-5s  %s\n", ran, batch, status.Version)
+		}
+
+	default:
+		fmt.Println(migrateUsage)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,49 @@
+package bootstrap
+
+import (
+	"fmt"
+	"github.com/go-ini/ini"
+	"go-chats/app/model"
+	"go-chats/app/utils/storage"
+)
+
+const storageUsage = `Usage: go-chats storage <command>
+
+Commands:
+  reconcile  重新扫描附件存储，修正附件大小和每个用户、群的存储用量，删除无主文件`
+
+/**
+ * 存储维护命令：go-chats storage reconcile
+ * @param []string args storage 之后的命令行参数
+ * @return int 进程退出码
+ */
+func Storage(cfg *ini.File, args []string) int {
+	if len(args) != 1 || args[0] != "reconcile" {
+		fmt.Println(storageUsage)
+		return 2
+	}
+
+	db, err := model.InitDB(cfg)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	if err := storage.Init(cfg); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	report, err := model.ReconcileStorage()
+	fmt.Printf("Missing files:     %d\n", report.Missing)
+	fmt.Printf("Resized:           %d\n", report.Resized)
+	fmt.Printf("Orphans removed:   %d\n", report.Orphans)
+	fmt.Printf("Usage corrected:   %d\n", report.Corrected)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	type User struct {
+		Id             int    `gorm:"primaryKey"`
+		Username       string `gorm:"size:64;not null;uniqueIndex"`
+		Password       string `gorm:"size:255;not null"`
+		Nickname       string `gorm:"size:64;not null"`
+		Email          string `gorm:"size:191;not null;index"`
+		Activate       uint8  `gorm:"not null;default:0"`
+		VerifySentAt   *time.Time
+		SessionVersion int `gorm:"not null;default:0"`
+		CreatedAt      time.Time
+		UpdatedAt      time.Time
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000001_create_users_table",
+		Up: func(tx *gorm.DB) error {
+			// 早期版本的用户表是手工建的，已存在时只补齐缺少的字段，并加长存放 MD5 的密码字段
+			if tx.Migrator().HasTable(&User{}) {
+				if err := addMissingColumns(tx, &User{}); err != nil {
+					return err
+				}
+				return widenColumn(tx, &User{}, "password", 255)
+			}
+			return tx.Migrator().CreateTable(&User{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&User{})
+		},
+	})
+}
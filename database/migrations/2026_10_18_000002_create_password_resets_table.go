@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	type PasswordReset struct {
+		Id        int       `gorm:"primaryKey"`
+		UserId    int       `gorm:"not null;index"`
+		TokenHash string    `gorm:"size:64;not null;uniqueIndex"`
+		ExpiresAt time.Time `gorm:"not null"`
+		UsedAt    *time.Time
+		CreatedAt time.Time
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000002_create_password_resets_table",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&PasswordReset{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&PasswordReset{})
+		},
+	})
+}
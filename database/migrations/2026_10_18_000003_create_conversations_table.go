@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	type Conversation struct {
+		Id            int   `gorm:"primaryKey"`
+		Type          uint8 `gorm:"not null"`
+		UserId        int   `gorm:"not null;default:0"`
+		PeerId        int   `gorm:"not null;default:0"`
+		GroupId       int   `gorm:"not null;default:0"`
+		LastMessageId int   `gorm:"not null;default:0"`
+		CreatedAt     time.Time
+		UpdatedAt     time.Time
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000003_create_conversations_table",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&Conversation{}); err != nil {
+				return err
+			}
+			return createIndex(tx, &Conversation{}, "members", true, "type", "user_id", "peer_id", "group_id")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&Conversation{})
+		},
+	})
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	type Message struct {
+		Id             int    `gorm:"primaryKey"`
+		ConversationId int    `gorm:"not null;index"`
+		SenderId       int    `gorm:"not null"`
+		RecipientId    int    `gorm:"not null;default:0"`
+		GroupId        int    `gorm:"not null;default:0"`
+		Body           string `gorm:"type:text"`
+		ContentType    string `gorm:"size:32;not null"`
+		CreatedAt      time.Time
+		DeletedAt      gorm.DeletedAt `gorm:"index"`
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000004_create_messages_table",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&Message{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&Message{})
+		},
+	})
+}
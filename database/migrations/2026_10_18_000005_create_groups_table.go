@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	type Group struct {
+		Id          int    `gorm:"primaryKey"`
+		Name        string `gorm:"size:64;not null"`
+		Avatar      string `gorm:"size:255;not null;default:''"`
+		Notice      string `gorm:"size:1024;not null;default:''"`
+		OwnerId     int    `gorm:"not null;index"`
+		MemberCount int    `gorm:"not null;default:0"`
+		CreatedAt   time.Time
+		UpdatedAt   time.Time
+		DeletedAt   gorm.DeletedAt `gorm:"index"`
+	}
+
+	type GroupMember struct {
+		Id        int   `gorm:"primaryKey"`
+		GroupId   int   `gorm:"not null"`
+		UserId    int   `gorm:"not null;index"`
+		Role      uint8 `gorm:"not null;default:1"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000005_create_groups_table",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&Group{}, &GroupMember{}); err != nil {
+				return err
+			}
+			return createIndex(tx, &GroupMember{}, "member", true, "group_id", "user_id")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&GroupMember{}, &Group{})
+		},
+	})
+}
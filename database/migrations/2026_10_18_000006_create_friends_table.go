@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	type FriendRequest struct {
+		Id        int    `gorm:"primaryKey"`
+		FromId    int    `gorm:"not null;index"`
+		ToId      int    `gorm:"not null;index"`
+		Message   string `gorm:"size:255;not null;default:''"`
+		Status    uint8  `gorm:"not null;default:0"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+
+	type Friend struct {
+		Id             int    `gorm:"primaryKey"`
+		UserId         int    `gorm:"not null"`
+		FriendId       int    `gorm:"not null;index"`
+		Remark         string `gorm:"size:64;not null;default:''"`
+		ContactGroupId int    `gorm:"not null;default:0"`
+		CreatedAt      time.Time
+		UpdatedAt      time.Time
+	}
+
+	type ContactGroup struct {
+		Id        int    `gorm:"primaryKey"`
+		UserId    int    `gorm:"not null;index"`
+		Name      string `gorm:"size:32;not null"`
+		Sort      int    `gorm:"not null;default:0"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000006_create_friends_table",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&FriendRequest{}, &Friend{}, &ContactGroup{}); err != nil {
+				return err
+			}
+			return createIndex(tx, &Friend{}, "pair", true, "user_id", "friend_id")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&ContactGroup{}, &Friend{}, &FriendRequest{})
+		},
+	})
+}
@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	type Block struct {
+		Id        int `gorm:"primaryKey"`
+		UserId    int `gorm:"not null"`
+		BlockedId int `gorm:"not null;index"`
+		CreatedAt time.Time
+	}
+
+	type User struct {
+		AddFriendPolicy uint8 `gorm:"not null;default:0"`
+		LastSeenPolicy  uint8 `gorm:"not null;default:0"`
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000007_create_blocks_table",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&Block{}); err != nil {
+				return err
+			}
+			if err := createIndex(tx, &Block{}, "pair", true, "user_id", "blocked_id"); err != nil {
+				return err
+			}
+			return addMissingColumns(tx, &User{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropColumns(tx, &User{}, "add_friend_policy", "last_seen_policy"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&Block{})
+		},
+	})
+}
@@ -0,0 +1,22 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	type User struct {
+		LastSeenAt *time.Time
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000008_add_last_seen_to_users",
+		Up: func(tx *gorm.DB) error {
+			return addMissingColumns(tx, &User{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &User{}, "last_seen_at")
+		},
+	})
+}
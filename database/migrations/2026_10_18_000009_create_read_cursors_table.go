@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	type ReadCursor struct {
+		Id                 int `gorm:"primaryKey"`
+		ConversationId     int `gorm:"not null"`
+		UserId             int `gorm:"not null;index"`
+		DeliveredMessageId int `gorm:"not null;default:0"`
+		ReadMessageId      int `gorm:"not null;default:0"`
+		UpdatedAt          time.Time
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000009_create_read_cursors_table",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&ReadCursor{}); err != nil {
+				return err
+			}
+			return createIndex(tx, &ReadCursor{}, "member", true, "conversation_id", "user_id")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&ReadCursor{})
+		},
+	})
+}
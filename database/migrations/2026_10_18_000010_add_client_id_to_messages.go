@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+func init() {
+	type Message struct {
+		SenderId int
+		ClientId *string `gorm:"size:64"`
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000010_add_client_id_to_messages",
+		Up: func(tx *gorm.DB) error {
+			if err := addMissingColumns(tx, &Message{}); err != nil {
+				return err
+			}
+			return createIndex(tx, &Message{}, "client", true, "sender_id", "client_id")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropIndex(tx, &Message{}, "client"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &Message{}, "client_id")
+		},
+	})
+}
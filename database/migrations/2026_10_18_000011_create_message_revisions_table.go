@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	type Message struct {
+		EditedAt   *time.Time
+		RecalledAt *time.Time
+	}
+
+	type MessageRevision struct {
+		Id        int    `gorm:"primaryKey"`
+		MessageId int    `gorm:"not null;index"`
+		Body      string `gorm:"type:text"`
+		CreatedAt time.Time
+	}
+
+	type MessageDeletion struct {
+		Id        int `gorm:"primaryKey"`
+		MessageId int `gorm:"not null"`
+		UserId    int `gorm:"not null"`
+		CreatedAt time.Time
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000011_create_message_revisions_table",
+		Up: func(tx *gorm.DB) error {
+			if err := addMissingColumns(tx, &Message{}); err != nil {
+				return err
+			}
+			if err := tx.Migrator().CreateTable(&MessageRevision{}, &MessageDeletion{}); err != nil {
+				return err
+			}
+			return createIndex(tx, &MessageDeletion{}, "member", true, "user_id", "message_id")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&MessageDeletion{}, &MessageRevision{}); err != nil {
+				return err
+			}
+			return dropColumns(tx, &Message{}, "edited_at", "recalled_at")
+		},
+	})
+}
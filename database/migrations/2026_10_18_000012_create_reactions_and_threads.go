@@ -0,0 +1,92 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	type Message struct {
+		ReplyToId int `gorm:"not null;default:0"`
+		ThreadId  int `gorm:"not null;default:0"`
+	}
+
+	type Conversation struct {
+		RootMessageId int `gorm:"not null;default:0"`
+	}
+
+	type MessageReaction struct {
+		Id        int    `gorm:"primaryKey"`
+		MessageId int    `gorm:"not null"`
+		UserId    int    `gorm:"not null"`
+		Emoji     string `gorm:"size:32;not null"`
+		CreatedAt time.Time
+	}
+
+	type ThreadFollower struct {
+		Id             int  `gorm:"primaryKey"`
+		ConversationId int  `gorm:"not null"`
+		UserId         int  `gorm:"not null;index"`
+		Muted          bool `gorm:"not null;default:false"`
+		CreatedAt      time.Time
+		UpdatedAt      time.Time
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000012_create_reactions_and_threads",
+		Up: func(tx *gorm.DB) error {
+			if err := addMissingColumns(tx, &Message{}); err != nil {
+				return err
+			}
+			if err := createIndex(tx, &Message{}, "thread_id", false, "thread_id"); err != nil {
+				return err
+			}
+
+			// 话题会话以根消息区分，同一个群可以有多个话题会话
+			if err := addMissingColumns(tx, &Conversation{}); err != nil {
+				return err
+			}
+			if err := dropIndex(tx, &Conversation{}, "members"); err != nil {
+				return err
+			}
+			if err := createIndex(tx, &Conversation{}, "members", true, "type", "user_id", "peer_id", "group_id", "root_message_id"); err != nil {
+				return err
+			}
+
+			if err := tx.Migrator().CreateTable(&MessageReaction{}, &ThreadFollower{}); err != nil {
+				return err
+			}
+			if err := createIndex(tx, &MessageReaction{}, "member", true, "message_id", "user_id", "emoji"); err != nil {
+				return err
+			}
+			return createIndex(tx, &ThreadFollower{}, "member", true, "conversation_id", "user_id")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&ThreadFollower{}, &MessageReaction{}); err != nil {
+				return err
+			}
+
+			// 回滚前删除话题会话及其消息，否则恢复的唯一索引无法创建
+			if err := tx.Where("thread_id > 0").Delete(&Message{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("root_message_id > 0").Delete(&Conversation{}).Error; err != nil {
+				return err
+			}
+			if err := dropIndex(tx, &Conversation{}, "members"); err != nil {
+				return err
+			}
+			if err := createIndex(tx, &Conversation{}, "members", true, "type", "user_id", "peer_id", "group_id"); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &Conversation{}, "root_message_id"); err != nil {
+				return err
+			}
+
+			if err := dropIndex(tx, &Message{}, "thread_id"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &Message{}, "reply_to_id", "thread_id")
+		},
+	})
+}
@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	type GroupMember struct {
+		Muted bool `gorm:"not null;default:false"`
+	}
+
+	type Mention struct {
+		Id             int   `gorm:"primaryKey"`
+		MessageId      int   `gorm:"not null"`
+		ConversationId int   `gorm:"not null"`
+		GroupId        int   `gorm:"not null"`
+		SenderId       int   `gorm:"not null"`
+		UserId         int   `gorm:"not null"`
+		Kind           uint8 `gorm:"not null"`
+		CreatedAt      time.Time
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000013_create_mentions_table",
+		Up: func(tx *gorm.DB) error {
+			if err := addMissingColumns(tx, &GroupMember{}); err != nil {
+				return err
+			}
+			if err := tx.Migrator().CreateTable(&Mention{}); err != nil {
+				return err
+			}
+			if err := createIndex(tx, &Mention{}, "user", false, "user_id", "id"); err != nil {
+				return err
+			}
+			return createIndex(tx, &Mention{}, "message_user", true, "message_id", "user_id")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&Mention{}); err != nil {
+				return err
+			}
+			return dropColumns(tx, &GroupMember{}, "muted")
+		},
+	})
+}
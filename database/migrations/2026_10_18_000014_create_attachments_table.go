@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	type Attachment struct {
+		Id             int    `gorm:"primaryKey"`
+		UploaderId     int    `gorm:"not null;index"`
+		MessageId      int    `gorm:"not null;default:0;index"`
+		ConversationId int    `gorm:"not null;default:0"`
+		Name           string `gorm:"size:255;not null"`
+		Size           int64  `gorm:"not null"`
+		SizeText       string `gorm:"size:32;not null"`
+		Mime           string `gorm:"size:128;not null"`
+		Md5            string `gorm:"size:32;not null;index"`
+		Path           string `gorm:"size:255;not null"`
+		CreatedAt      time.Time
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000014_create_attachments_table",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&Attachment{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&Attachment{})
+		},
+	})
+}
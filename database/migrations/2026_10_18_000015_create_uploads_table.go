@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	type Upload struct {
+		Id          int    `gorm:"primaryKey"`
+		UploaderId  int    `gorm:"not null;index"`
+		Name        string `gorm:"size:255;not null"`
+		Size        int64  `gorm:"not null"`
+		Md5         string `gorm:"size:32;not null"`
+		ChunkSize   int64  `gorm:"not null"`
+		TotalChunks int    `gorm:"not null"`
+		CreatedAt   time.Time
+		UpdatedAt   time.Time `gorm:"index"`
+	}
+
+	type UploadChunk struct {
+		Id        int   `gorm:"primaryKey"`
+		UploadId  int   `gorm:"not null"`
+		Number    int   `gorm:"not null"`
+		Size      int64 `gorm:"not null"`
+		CreatedAt time.Time
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000015_create_uploads_table",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&Upload{}, &UploadChunk{}); err != nil {
+				return err
+			}
+			return createIndex(tx, &UploadChunk{}, "number", true, "upload_id", "number")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&UploadChunk{}, &Upload{})
+		},
+	})
+}
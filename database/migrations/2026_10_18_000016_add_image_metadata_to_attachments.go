@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	type Attachment struct {
+		Width          int    `gorm:"not null;default:0"`
+		Height         int    `gorm:"not null;default:0"`
+		Blurhash       string `gorm:"size:64;not null;default:''"`
+		ThumbnailSizes string `gorm:"size:64;not null;default:''"`
+		ProcessedAt    *time.Time
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000016_add_image_metadata_to_attachments",
+		Up: func(tx *gorm.DB) error {
+			return addMissingColumns(tx, &Attachment{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &Attachment{}, "width", "height", "blurhash", "thumbnail_sizes", "processed_at")
+		},
+	})
+}
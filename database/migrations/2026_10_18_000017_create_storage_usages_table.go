@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	type StorageUsage struct {
+		Id        int    `gorm:"primaryKey"`
+		OwnerType string `gorm:"size:16;not null"`
+		OwnerId   int    `gorm:"not null"`
+		Bytes     int64  `gorm:"not null;default:0"`
+		Files     int    `gorm:"not null;default:0"`
+		UpdatedAt time.Time
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000017_create_storage_usages_table",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&StorageUsage{}); err != nil {
+				return err
+			}
+			return createIndex(tx, &StorageUsage{}, "owner", true, "owner_type", "owner_id")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&StorageUsage{})
+		},
+	})
+}
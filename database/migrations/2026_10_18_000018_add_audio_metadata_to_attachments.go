@@ -0,0 +1,20 @@
+package migrations
+
+import "gorm.io/gorm"
+
+func init() {
+	type Attachment struct {
+		Duration int    `gorm:"not null;default:0"`
+		Waveform string `gorm:"size:255;not null;default:''"`
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000018_add_audio_metadata_to_attachments",
+		Up: func(tx *gorm.DB) error {
+			return addMissingColumns(tx, &Attachment{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &Attachment{}, "duration", "waveform")
+		},
+	})
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+func init() {
+	type MessageListen struct {
+		Id        int `gorm:"primaryKey"`
+		MessageId int `gorm:"not null"`
+		UserId    int `gorm:"not null"`
+		CreatedAt time.Time
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000019_create_message_listens_table",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&MessageListen{}); err != nil {
+				return err
+			}
+			return createIndex(tx, &MessageListen{}, "member", true, "message_id", "user_id")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&MessageListen{})
+		},
+	})
+}
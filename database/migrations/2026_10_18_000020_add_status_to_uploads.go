@@ -0,0 +1,21 @@
+package migrations
+
+import "gorm.io/gorm"
+
+func init() {
+	type Upload struct {
+		Status       string `gorm:"size:16;not null;default:'uploading'"`
+		AttachmentId int    `gorm:"not null;default:0"`
+		Error        string `gorm:"size:255;not null;default:''"`
+	}
+
+	Register(&Migration{
+		Version: "2026_10_18_000020_add_status_to_uploads",
+		Up: func(tx *gorm.DB) error {
+			return addMissingColumns(tx, &Upload{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &Upload{}, "status", "attachment_id", "error")
+		},
+	})
+}
@@ -0,0 +1,193 @@
+package migrations
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-ini/ini"
+	"go-chats/app/model"
+	"gorm.io/gorm"
+)
+
+// 打开内存 SQLite，只用一个连接，关闭前数据库一直存在
+func openMemory(t *testing.T) *gorm.DB {
+	cfg, err := ini.Load([]byte("DB_CONNECTION=sqlite\nDB_DATABASE=:memory:\nDB_PREFIX=gc_\nDB_LOG_LEVEL=silent\nDB_MAX_OPEN_CONNS=1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := model.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+/**
+ * 表的列和索引，用于比较两次迁移后的结构是否一致
+ * 不直接比较 sqlite_master 中的建表语句，SQLite 删除列重建表后语句的格式会变
+ */
+func schemaOf(t *testing.T, db *gorm.DB) map[string]string {
+	var tables []string
+	if err := db.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'").Scan(&tables).Error; err != nil {
+		t.Fatal(err)
+	}
+	schema := make(map[string]string, len(tables))
+	for _, table := range tables {
+		var columns []struct {
+			Name      string
+			Type      string
+			Notnull   int
+			DfltValue *string
+			Pk        int
+		}
+		if err := db.Raw("PRAGMA table_info(`" + table + "`)").Scan(&columns).Error; err != nil {
+			t.Fatal(err)
+		}
+		defs := make([]string, 0, len(columns))
+		for _, c := range columns {
+			def := fmt.Sprintf("%s %s notnull=%d pk=%d", c.Name, strings.ToLower(c.Type), c.Notnull, c.Pk)
+			if c.DfltValue != nil {
+				def += " default=" + *c.DfltValue
+			}
+			defs = append(defs, def)
+		}
+		schema[table] = strings.Join(defs, ", ")
+
+		var indexes []struct {
+			Name   string
+			Unique int
+		}
+		if err := db.Raw("PRAGMA index_list(`" + table + "`)").Scan(&indexes).Error; err != nil {
+			t.Fatal(err)
+		}
+		for _, index := range indexes {
+			var cols []string
+			if err := db.Raw("SELECT name FROM pragma_index_info(?) ORDER BY seqno", index.Name).Scan(&cols).Error; err != nil {
+				t.Fatal(err)
+			}
+			schema[index.Name] = fmt.Sprintf("%s unique=%d (%s)", table, index.Unique, strings.Join(cols, ", "))
+		}
+	}
+	return schema
+}
+
+func TestUpDownUp(t *testing.T) {
+	db := openMemory(t)
+	migrator := New(db)
+
+	done, err := migrator.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(All()) {
+		t.Fatalf("Up() ran %d migrations, want %d", len(done), len(All()))
+	}
+	first := schemaOf(t, db)
+	for _, table := range []string{"gc_users", "gc_messages", "gc_attachments", "gc_uploads", "gc_storage_usages", "gc_message_listens"} {
+		if _, ok := first[table]; !ok {
+			t.Errorf("table %s was not created", table)
+		}
+	}
+	if done, err := migrator.Up(); err != nil || len(done) != 0 {
+		t.Errorf("second Up() = %v, %v, want nothing to migrate", done, err)
+	}
+
+	done, err = migrator.Down()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(All()) {
+		t.Fatalf("Down() rolled back %d migrations, want %d", len(done), len(All()))
+	}
+	for name := range schemaOf(t, db) {
+		if name != "gc_schema_migrations" && !strings.HasPrefix(name, "idx_gc_schema_migrations") {
+			t.Errorf("%s still exists after rolling back", name)
+		}
+	}
+
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if second := schemaOf(t, db); !reflect.DeepEqual(first, second) {
+		t.Errorf("schema after up/down/up differs from the first up")
+		for name, sql := range first {
+			if second[name] != sql {
+				t.Logf("%s:\n  first:  %s\n  second: %s", name, sql, second[name])
+			}
+		}
+	}
+}
+
+// 每个迁移单独回滚再执行，回滚后的结构应与执行前一致
+func TestEachMigrationRollsBack(t *testing.T) {
+	db := openMemory(t)
+	for _, migration := range All() {
+		before := schemaOf(t, db)
+		if err := db.Transaction(migration.Up); err != nil {
+			t.Fatalf("%s up: %v", migration.Version, err)
+		}
+		after := schemaOf(t, db)
+		if err := db.Transaction(migration.Down); err != nil {
+			t.Fatalf("%s down: %v", migration.Version, err)
+		}
+		if rolledBack := schemaOf(t, db); !reflect.DeepEqual(before, rolledBack) {
+			t.Errorf("%s down does not restore the previous schema", migration.Version)
+			for name, sql := range before {
+				if rolledBack[name] != sql {
+					t.Logf("%s:\n  before: %s\n  after:  %s", name, sql, rolledBack[name])
+				}
+			}
+			for name, sql := range rolledBack {
+				if _, ok := before[name]; !ok {
+					t.Logf("%s left behind: %s", name, sql)
+				}
+			}
+		}
+		if err := db.Transaction(migration.Up); err != nil {
+			t.Fatalf("%s up again: %v", migration.Version, err)
+		}
+		if again := schemaOf(t, db); !reflect.DeepEqual(after, again) {
+			t.Errorf("%s up after down creates a different schema", migration.Version)
+		}
+	}
+}
+
+// 回滚只回滚最后一个批次
+func TestDownRollsBackLastBatch(t *testing.T) {
+	db := openMemory(t)
+	migrator := New(db)
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	last := All()[len(All())-1]
+	if err := db.Where("version = ?", last.Version).Delete(&SchemaMigration{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Transaction(last.Down); err != nil {
+		t.Fatal(err)
+	}
+	if done, err := migrator.Up(); err != nil || len(done) != 1 || done[0] != last.Version {
+		t.Fatalf("Up() = %v, %v, want only %s", done, err, last.Version)
+	}
+
+	done, err := migrator.Down()
+	if err != nil || len(done) != 1 || done[0] != last.Version {
+		t.Errorf("Down() = %v, %v, want only %s", done, err, last.Version)
+	}
+	status, err := migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if s.Ran != (s.Version != last.Version) {
+			t.Errorf("%s ran = %v after rolling back the last batch", s.Version, s.Ran)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package migrations
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+	"time"
+)
+
+// 一次数据库结构变更，Version 使用 年_月_日_序号_描述 的格式，按字符串顺序执行
+type Migration struct {
+	Version string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// 迁移执行记录，表名为 {DB_PREFIX}schema_migrations
+type SchemaMigration struct {
+	Id        int       `gorm:"primaryKey"`
+	Version   string    `gorm:"size:191;not null;uniqueIndex"`
+	Batch     int       `gorm:"not null"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// 迁移状态
+type Status struct {
+	Version string
+	Ran     bool
+	Batch   int
+}
+
+// 已注册的迁移，每个迁移文件在 init 中调用 Register 注册
+var registry = map[string]*Migration{}
+
+func Register(m *Migration) {
+	if _, ok := registry[m.Version]; ok {
+		panic(fmt.Sprintf("migration %s is already registered", m.Version))
+	}
+	registry[m.Version] = m
+}
+
+// 按版本号排序的全部迁移
+func All() []*Migration {
+	list := make([]*Migration, 0, len(registry))
+	for _, m := range registry {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+	return list
+}
+
+type Migrator struct {
+	db *gorm.DB
+}
+
+func New(db *gorm.DB) *Migrator {
+	return &Migrator{db: db}
+}
+
+// 执行全部未执行的迁移，本次执行的迁移记为同一批次，返回执行过的版本
+func (m *Migrator) Up() ([]string, error) {
+	ran, err := m.ran()
+	if err != nil {
+		return nil, err
+	}
+
+	batch := 1
+	for _, record := range ran {
+		if record.Batch >= batch {
+			batch = record.Batch + 1
+		}
+	}
+
+	var done []string
+	for _, migration := range All() {
+		if _, ok := ran[migration.Version]; ok {
+			continue
+		}
+
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: migration.Version, Batch: batch, CreatedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migrate %s failed: %v", migration.Version, err)
+		}
+		done = append(done, migration.Version)
+	}
+	return done, nil
+}
+
+// 回滚最后一个批次的迁移，按执行顺序倒序回滚，返回回滚过的版本
+func (m *Migrator) Down() ([]string, error) {
+	ran, err := m.ran()
+	if err != nil {
+		return nil, err
+	}
+
+	last := 0
+	for _, record := range ran {
+		if record.Batch > last {
+			last = record.Batch
+		}
+	}
+
+	migrations := All()
+	var done []string
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if record, ok := ran[migration.Version]; !ok || record.Batch != last {
+			continue
+		}
+
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Where("version = ?", migration.Version).Delete(&SchemaMigration{}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("rollback %s failed: %v", migration.Version, err)
+		}
+		done = append(done, migration.Version)
+	}
+
+	// 执行记录中存在但代码里已经找不到的迁移无法回滚，需要人工处理
+	for version, record := range ran {
+		if record.Batch == last {
+			if _, ok := registry[version]; !ok {
+				return done, fmt.Errorf("rollback %s failed: migration not found", version)
+			}
+		}
+	}
+	return done, nil
+}
+
+// 全部迁移的执行状态
+func (m *Migrator) Status() ([]Status, error) {
+	ran, err := m.ran()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Status
+	for _, migration := range All() {
+		record, ok := ran[migration.Version]
+		list = append(list, Status{Version: migration.Version, Ran: ok, Batch: record.Batch})
+	}
+	return list, nil
+}
+
+// 读取已执行的迁移，记录表不存在时自动创建
+func (m *Migrator) ran() (map[string]SchemaMigration, error) {
+	if !m.db.Migrator().HasTable(&SchemaMigration{}) {
+		if err := m.db.Migrator().CreateTable(&SchemaMigration{}); err != nil {
+			return nil, err
+		}
+	}
+
+	var records []SchemaMigration
+	if err := m.db.Order("id").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	ran := make(map[string]SchemaMigration, len(records))
+	for _, record := range records {
+		ran[record.Version] = record
+	}
+	return ran, nil
+}
+
+// 获取模型对应的表名（已包含 DB_PREFIX 前缀）
+func tableName(tx *gorm.DB, value interface{}) (string, error) {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(value); err != nil {
+		return "", err
+	}
+	return stmt.Schema.Table, nil
+}
+
+/**
+ * 创建多列索引，索引名为 idx_{表名}_{name}，保证多个前缀的实例共用一个库时索引名不冲突
+ * @param interface{} value 迁移中定义的表结构
+ * @param string name 索引名后缀
+ * @param bool unique 是否唯一索引
+ * @param []string columns 索引列
+ */
+func createIndex(tx *gorm.DB, value interface{}, name string, unique bool, columns ...string) error {
+	table, err := tableName(tx, value)
+	if err != nil {
+		return err
+	}
+
+	cols := make([]interface{}, 0, len(columns))
+	for _, column := range columns {
+		cols = append(cols, clause.Column{Name: column})
+	}
+
+	sql := "CREATE INDEX ? ON ? ?"
+	if unique {
+		sql = "CREATE UNIQUE INDEX ? ON ? ?"
+	}
+	return tx.Exec(sql, clause.Column{Name: fmt.Sprintf("idx_%s_%s", table, name)}, clause.Table{Name: table}, cols).Error
+}
+
+// 删除 createIndex 创建的索引
+func dropIndex(tx *gorm.DB, value interface{}, name string) error {
+	table, err := tableName(tx, value)
+	if err != nil {
+		return err
+	}
+	return tx.Migrator().DropIndex(value, fmt.Sprintf("idx_%s_%s", table, name))
+}
+
+/**
+ * 删除字段，字段上的索引需要先删除
+ * gorm 的 sqlite 驱动通过重建表来删除字段，表上的其他索引会一起丢失，所以删除前记下建索引的语句，删除后重新创建
+ */
+func dropColumns(tx *gorm.DB, value interface{}, columns ...string) error {
+	table, err := tableName(tx, value)
+	if err != nil {
+		return err
+	}
+
+	var indexes []string
+	if tx.Dialector.Name() == "sqlite" {
+		err = tx.Raw("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table).Scan(&indexes).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, column := range columns {
+		if err := tx.Migrator().DropColumn(value, column); err != nil {
+			return err
+		}
+	}
+	for _, sql := range indexes {
+		if err := tx.Exec(sql).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 给已存在的表补齐缺少的字段，不修改已有字段，兼容迁移系统之前手工建表的数据库
+func addMissingColumns(tx *gorm.DB, value interface{}) error {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(value); err != nil {
+		return err
+	}
+
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName == "" || tx.Migrator().HasColumn(value, field.DBName) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(value, field.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 已存在的字段长度小于 size 时按迁移中的定义修改字段，无法获取长度的数据库（如 sqlite）不处理
+func widenColumn(tx *gorm.DB, value interface{}, column string, size int64) error {
+	columnTypes, err := tx.Migrator().ColumnTypes(value)
+	if err != nil {
+		return err
+	}
+
+	for _, columnType := range columnTypes {
+		if columnType.Name() != column {
+			continue
+		}
+		if length, ok := columnType.Length(); ok && length > 0 && length < size {
+			return tx.Migrator().AlterColumn(value, column)
+		}
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-ini/ini"
 	"go-chats/bootstrap"
+	"os"
 )
 
 func main() {
@@ -16,6 +17,16 @@ func main() {
 		return
 	}
 
+	// 数据库迁移命令：go-chats migrate up|down|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(bootstrap.Migrate(cfg, os.Args[2:]))
+	}
+
+	// 存储维护命令：go-chats storage reconcile
+	if len(os.Args) > 1 && os.Args[1] == "storage" {
+		os.Exit(bootstrap.Storage(cfg, os.Args[2:]))
+	}
+
 	// 设置GIN运行模式，默认是 debug 开发模式，release 为生产模式, test 为测试模式
 	gin.SetMode(cfg.Section(ini.DefaultSection).Key("RUN_MODE").MustString(""))
 
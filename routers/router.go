@@ -8,15 +8,83 @@ import (
 
 func InitRouter(r *gin.Engine) {
 
-	r.Any("/test", (&controller.PublicController{}).Test)                    // 测试
-	r.Any("/login", (&controller.PublicController{}).Login)                  // 登录
-	r.Any("/register", (&controller.PublicController{}).Register)            // 注册
-	r.Any("/reset-password", (&controller.PublicController{}).ResetPassword) // 找回密码
+	r.Any("/test", (&controller.PublicController{}).Test)                               // 测试
+	r.Any("/login", (&controller.PublicController{}).Login)                             // 登录
+	r.Any("/register", (&controller.PublicController{}).Register)                       // 注册
+	r.Any("/reset-password", (&controller.PublicController{}).ResetPassword)            // 找回密码
+	r.Any("/set-password", (&controller.PublicController{}).SetPassword)                // 设置新密码
+	r.GET("/verify-email", (&controller.PublicController{}).VerifyEmail)                // 邮箱验证
+	r.POST("/resend-verification", (&controller.PublicController{}).ResendVerification) // 重发验证邮件
+	r.GET("/health", (&controller.HealthController{}).Live)                             // 存活检查
+	r.GET("/ready", (&controller.HealthController{}).Ready)                             // 就绪检查
+	r.GET("/storage/*path", (&controller.StorageController{}).Show)                     // 公开文件
+	r.HEAD("/storage/*path", (&controller.StorageController{}).Show)                    // 公开文件
 
 	authorized := r.Group("/")
 	authorized.Use(middleware.Auth())
 	{
-		r.GET("logout", (&controller.PublicController{}).Logout)                 // 登录
-		r.GET("index", middleware.Auth(), (&controller.IndexController{}).Index) // 主页
+		r.GET("logout", (&controller.PublicController{}).Logout)                     // 登录
+		r.GET("index", middleware.AuthPage(), (&controller.IndexController{}).Index) // 主页
+		authorized.GET("ws", (&controller.ChatController{}).Ws)                      // WebSocket连接
+		authorized.GET("messages", (&controller.ChatController{}).History)           // 聊天记录
+
+		authorized.GET("conversations", (&controller.ConversationController{}).Index)               // 会话列表
+		authorized.GET("messages/:id/receipts", (&controller.ChatController{}).Receipts)            // 消息的送达、已读情况
+		authorized.POST("messages/:id", (&controller.ChatController{}).Edit)                        // 编辑消息
+		authorized.POST("messages/:id/recall", (&controller.ChatController{}).Recall)               // 撤回消息
+		authorized.DELETE("messages/:id", (&controller.ChatController{}).Delete)                    // 删除消息（仅自己）
+		authorized.GET("messages/:id/revisions", (&controller.ChatController{}).Revisions)          // 编辑历史
+		authorized.GET("messages/:id/reactions", (&controller.ChatController{}).Reactions)          // 表情回应
+		authorized.POST("messages/:id/reactions", (&controller.ChatController{}).React)             // 添加表情回应
+		authorized.DELETE("messages/:id/reactions", (&controller.ChatController{}).Unreact)         // 取消表情回应
+		authorized.POST("messages/:id/listened", (&controller.ChatController{}).Listened)           // 标记语音消息已收听
+		authorized.GET("messages/:id/thread", (&controller.ThreadController{}).Show)                // 话题概况
+		authorized.POST("messages/:id/thread/follow", (&controller.ThreadController{}).Follow)      // 关注话题
+		authorized.POST("messages/:id/thread/unfollow", (&controller.ThreadController{}).Unfollow)  // 取消关注话题
+		authorized.GET("threads", (&controller.ThreadController{}).Index)                           // 我关注的话题
+		authorized.GET("mentions", (&controller.MentionController{}).Index)                         // 提及我的消息
+		authorized.POST("attachments", (&controller.AttachmentController{}).Upload)                 // 上传附件
+		authorized.GET("attachments/:id", (&controller.AttachmentController{}).Show)                // 下载附件
+		authorized.GET("attachments/:id/thumbnail", (&controller.AttachmentController{}).Thumbnail) // 图片缩略图
+		authorized.POST("uploads", (&controller.UploadController{}).Create)                         // 创建分片上传
+		authorized.GET("uploads/:id", (&controller.UploadController{}).Show)                        // 分片上传进度
+		authorized.PUT("uploads/:id/chunks/:number", (&controller.UploadController{}).Chunk)        // 上传分片
+		authorized.POST("uploads/:id/complete", (&controller.UploadController{}).Complete)          // 完成分片上传
+		authorized.DELETE("uploads/:id", (&controller.UploadController{}).Destroy)                  // 取消分片上传
+		authorized.GET("usage", (&controller.StorageController{}).Usage)                            // 存储空间用量
+
+		authorized.GET("groups", (&controller.GroupController{}).Index)                              // 我的群聊
+		authorized.POST("groups", (&controller.GroupController{}).Create)                            // 创建群聊
+		authorized.GET("groups/:id", (&controller.GroupController{}).Show)                           // 群详情
+		authorized.POST("groups/:id", (&controller.GroupController{}).Update)                        // 修改群资料
+		authorized.DELETE("groups/:id", (&controller.GroupController{}).Dissolve)                    // 解散群聊
+		authorized.POST("groups/:id/members", (&controller.GroupController{}).Invite)                // 邀请成员
+		authorized.DELETE("groups/:id/members/:user_id", (&controller.GroupController{}).Remove)     // 移除成员
+		authorized.POST("groups/:id/members/:user_id/role", (&controller.GroupController{}).SetRole) // 设置管理员
+		authorized.POST("groups/:id/transfer", (&controller.GroupController{}).Transfer)             // 转让群主
+		authorized.POST("groups/:id/leave", (&controller.GroupController{}).Leave)                   // 退出群聊
+		authorized.POST("groups/:id/mute", (&controller.GroupController{}).Mute)                     // 消息免打扰
+
+		authorized.GET("users/search", (&controller.FriendController{}).Search)                      // 搜索用户
+		authorized.GET("friends", (&controller.FriendController{}).Index)                            // 好友列表
+		authorized.POST("friends/:id", (&controller.FriendController{}).Update)                      // 修改好友备注、分组
+		authorized.DELETE("friends/:id", (&controller.FriendController{}).Delete)                    // 删除好友
+		authorized.GET("friend-requests", (&controller.FriendController{}).Requests)                 // 好友申请列表
+		authorized.POST("friend-requests", (&controller.FriendController{}).SendRequest)             // 发送好友申请
+		authorized.POST("friend-requests/:id/accept", (&controller.FriendController{}).Accept)       // 同意好友申请
+		authorized.POST("friend-requests/:id/reject", (&controller.FriendController{}).Reject)       // 拒绝好友申请
+		authorized.POST("friend-requests/:id/cancel", (&controller.FriendController{}).Cancel)       // 撤回好友申请
+		authorized.GET("contact-groups", (&controller.FriendController{}).ContactGroups)             // 好友分组列表
+		authorized.POST("contact-groups", (&controller.FriendController{}).CreateContactGroup)       // 新建分组
+		authorized.PUT("contact-groups", (&controller.FriendController{}).SortContactGroups)         // 调整分组顺序
+		authorized.POST("contact-groups/:id", (&controller.FriendController{}).RenameContactGroup)   // 重命名分组
+		authorized.DELETE("contact-groups/:id", (&controller.FriendController{}).DeleteContactGroup) // 删除分组
+
+		authorized.GET("blocks", (&controller.PrivacyController{}).Blocks)           // 黑名单
+		authorized.POST("blocks", (&controller.PrivacyController{}).Block)           // 拉黑用户
+		authorized.DELETE("blocks/:id", (&controller.PrivacyController{}).Unblock)   // 移出黑名单
+		authorized.GET("privacy", (&controller.PrivacyController{}).Settings)        // 隐私设置
+		authorized.POST("privacy", (&controller.PrivacyController{}).UpdateSettings) // 修改隐私设置
+		authorized.GET("presence", (&controller.PresenceController{}).Index)         // 批量查询在线状态
 	}
 }